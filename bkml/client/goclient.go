@@ -13,10 +13,11 @@ import (
 
 // Client is an API client for the devweek-k65i Encore application.
 type Client struct {
-	Blog  BlogClient
-	Bytes BytesClient
-	Email EmailClient
-	Url   UrlClient
+	Blog    BlogClient
+	Bytes   BytesClient
+	Email   EmailClient
+	Twitter TwitterClient
+	Url     UrlClient
 }
 
 // BaseURL is the base URL for calling the Encore application's API.
@@ -56,10 +57,11 @@ func New(target BaseURL, options ...Option) (*Client, error) {
 	}
 
 	return &Client{
-		Blog:  &blogClient{base},
-		Bytes: &bytesClient{base},
-		Email: &emailClient{base},
-		Url:   &urlClient{base},
+		Blog:    &blogClient{base},
+		Bytes:   &bytesClient{base},
+		Email:   &emailClient{base},
+		Twitter: &twitterClient{base},
+		Url:     &urlClient{base},
 	}, nil
 }
 
@@ -91,6 +93,13 @@ func WithAuthFunc(tokenGenerator func(ctx context.Context) (string, error)) Opti
 	}
 }
 
+type BlogAPIToken struct {
+	ID       int64      `json:"id"`
+	Name     string     `json:"name"` // the device the token is used on
+	Created  time.Time  `json:"created"`
+	LastUsed *time.Time `json:"last_used" qs:"last_used"`
+}
+
 type BlogBlogPostFull struct {
 	ID                   string    `json:"id"`
 	UUID                 string    `json:"uuid"`
@@ -130,9 +139,26 @@ type BlogCategory struct {
 	Summary  string `json:"summary"`
 }
 
+type BlogCreateTokenParams struct {
+	// Name is the device the token is for, like "phone".
+	Name string `json:"name"`
+}
+
+type BlogCreateTokenResponse struct {
+	ID      int64     `json:"id"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+
+	// Token is the API token. It is only ever returned here.
+	Token string `json:"token"`
+}
+
 type BlogGetBlogPostsParams struct {
 	Limit  int `json:"limit"`
 	Offset int `json:"offset"`
+
+	// Since lists only posts published at or after it, if set.
+	Since time.Time `json:"since"`
 }
 
 type BlogGetBlogPostsResponse struct {
@@ -150,6 +176,10 @@ type BlogGetTagsResponse struct {
 	Tags  []BlogTag `json:"tags"`
 }
 
+type BlogListTokensResponse struct {
+	Tokens []*BlogAPIToken `json:"tokens"`
+}
+
 type BlogPageFull struct {
 	ID                   string    `json:"id"`
 	UUID                 string    `json:"uuid"`
@@ -184,6 +214,16 @@ type BlogPageFull struct {
 	Tags                 []BlogTag `json:"tags"`
 }
 
+type BlogPromoteParams struct {
+
+	// Schedule decides how the promotion should be scheduled.
+	// Valid values are "auto" for scheduling it at a suitable time
+	// based on the current posting schedule, and "now" to schedule it immediately.
+	Schedule BlogScheduleType
+}
+
+type BlogScheduleType = string
+
 type BlogTag struct {
 	Name               string    `json:"slug_name"`
 	Slug               string    `json:"slug"`
@@ -210,11 +250,14 @@ type BlogClient interface {
 	// CreateTag creates a new blog post.
 	CreateCategory(ctx context.Context, params BlogCategory) error
 
+	// CreateToken creates a long-lived API token for a device.
+	CreateToken(ctx context.Context, params BlogCreateTokenParams) (BlogCreateTokenResponse, error)
+
 	// GetBlogPost retrieves a blog post by slug.
 	GetBlogPost(ctx context.Context, slug string) (BlogBlogPostFull, error)
 
 	// GetBlogPosts retrieves a list of blog posts with
-	// optional limit and offset.
+	// optional limit, offset and publication time.
 	GetBlogPosts(ctx context.Context, params BlogGetBlogPostsParams) (BlogGetBlogPostsResponse, error)
 
 	// GetCategories retrieves a list of categories
@@ -238,12 +281,22 @@ type BlogClient interface {
 	// GetTagsBySlug retrieves a list of tags for a post
 	GetTagsByPost(ctx context.Context, slug string) (BlogGetTagsResponse, error)
 
+	// ListTokens lists the API tokens.
+	ListTokens(ctx context.Context) (BlogListTokensResponse, error)
+
 	// Post receives incoming post CRUD webhooks from ghost.
 	PageHook(ctx context.Context, request *http.Request) (*http.Response, error)
 
 	// Post receives incoming post CRUD webhooks from ghost.
 	PostHook(ctx context.Context, request *http.Request) (*http.Response, error)
 
+	// Promote schedules the promotion of a blog post on Twitter.
+	// Emailing it to subscribers is done by email.PromotePost.
+	Promote(ctx context.Context, slug string, params BlogPromoteParams) error
+
+	// RevokeToken revokes an API token, for example when a device is lost.
+	RevokeToken(ctx context.Context, id int64) error
+
 	// Post receives incoming post CRUD webhooks from ghost.
 	TagHook(ctx context.Context, request *http.Request) (*http.Response, error)
 }
@@ -259,6 +312,12 @@ func (c *blogClient) CreateCategory(ctx context.Context, params BlogCategory) er
 	return callAPI(ctx, c.base, "POST", "/blog.CreateCategory", params, nil)
 }
 
+// CreateToken creates a long-lived API token for a device.
+func (c *blogClient) CreateToken(ctx context.Context, params BlogCreateTokenParams) (resp BlogCreateTokenResponse, err error) {
+	err = callAPI(ctx, c.base, "POST", "/tokens", params, &resp)
+	return resp, err
+}
+
 // GetBlogPost retrieves a blog post by slug.
 func (c *blogClient) GetBlogPost(ctx context.Context, slug string) (resp BlogBlogPostFull, err error) {
 	err = callAPI(ctx, c.base, "GET", fmt.Sprintf("/blog/%s", slug), nil, &resp)
@@ -266,11 +325,12 @@ func (c *blogClient) GetBlogPost(ctx context.Context, slug string) (resp BlogBlo
 }
 
 // GetBlogPosts retrieves a list of blog posts with
-// optional limit and offset.
+// optional limit, offset and publication time.
 func (c *blogClient) GetBlogPosts(ctx context.Context, params BlogGetBlogPostsParams) (resp BlogGetBlogPostsResponse, err error) {
 	queryString := url.Values{
 		"limit":  []string{fmt.Sprint(params.Limit)},
 		"offset": []string{fmt.Sprint(params.Offset)},
+		"since":  []string{params.Since.Format(time.RFC3339)},
 	}
 	err = callAPI(ctx, c.base, "GET", fmt.Sprintf("/blog?%s", queryString.Encode()), nil, &resp)
 	return resp, err
@@ -318,6 +378,12 @@ func (c *blogClient) GetTagsByPost(ctx context.Context, slug string) (resp BlogG
 	return resp, err
 }
 
+// ListTokens lists the API tokens.
+func (c *blogClient) ListTokens(ctx context.Context) (resp BlogListTokensResponse, err error) {
+	err = callAPI(ctx, c.base, "GET", "/tokens", nil, &resp)
+	return resp, err
+}
+
 // Post receives incoming post CRUD webhooks from ghost.
 func (c *blogClient) PageHook(ctx context.Context, request *http.Request) (*http.Response, error) {
 	path, err := url.Parse("/blog.PageHook")
@@ -342,6 +408,17 @@ func (c *blogClient) PostHook(ctx context.Context, request *http.Request) (*http
 	return c.base.Do(request)
 }
 
+// Promote schedules the promotion of a blog post on Twitter.
+// Emailing it to subscribers is done by email.PromotePost.
+func (c *blogClient) Promote(ctx context.Context, slug string, params BlogPromoteParams) error {
+	return callAPI(ctx, c.base, "POST", fmt.Sprintf("/blog/%s/promote", slug), params, nil)
+}
+
+// RevokeToken revokes an API token, for example when a device is lost.
+func (c *blogClient) RevokeToken(ctx context.Context, id int64) error {
+	return callAPI(ctx, c.base, "DELETE", fmt.Sprintf("/tokens/%d", id), nil, nil)
+}
+
 // Post receives incoming post CRUD webhooks from ghost.
 func (c *blogClient) TagHook(ctx context.Context, request *http.Request) (*http.Response, error) {
 	path, err := url.Parse("/blog.TagHook")
@@ -354,23 +431,71 @@ func (c *blogClient) TagHook(ctx context.Context, request *http.Request) (*http.
 	return c.base.Do(request)
 }
 
+type BytesArchiveCountsParams struct {
+	// Tag counts only bytes with the blog tag with this slug.
+	Tag string `json:"tag"`
+}
+
+type BytesArchiveCountsResponse struct {
+	// Months are the months with any bytes published, newest first.
+	Months []*BytesMonthCount `json:"months"`
+}
+
+type BytesArchiveParams struct {
+	Year  int `json:"year"`
+	Month int `json:"month"` // 1-12, or 0 for the whole year
+
+	// Tag lists only bytes with the blog tag with this slug.
+	Tag string `json:"tag"`
+}
+
+type BytesArchiveResponse struct {
+	Year  int         `json:"year"`
+	Month int         `json:"month"`
+	Bytes []BytesByte `json:"bytes"`
+}
+
 type BytesByte struct {
 	ID      int64     `json:"id"`
 	Title   string    `json:"title"`
 	Summary string    `json:"summary"`
 	URL     string    `json:"url"`
 	Created time.Time `json:"created"`
+
+	ImageURL     string `json:"image_url" qs:"image_url"`         // image shown on the byte's card
+	SiteName     string `json:"site_name" qs:"site_name"`         // name of the site the URL is on
+	CanonicalURL string `json:"canonical_url" qs:"canonical_url"` // canonical URL of the linked page
+
+	Tags []string `json:"tags"` // slugs of the byte's blog tags
+
+	// Link is the result of the latest check of URL, or nil if it hasn't been checked.
+	Link *LinkcheckStatus `json:"link"`
 }
 
 type BytesListParams struct {
 	Limit  int `json:"limit"`
 	Offset int `json:"offset"`
+
+	// Broken lists only bytes whose links were broken when last checked.
+	Broken bool `json:"broken"`
+
+	// Tag lists only bytes with the blog tag with this slug.
+	Tag string `json:"tag"`
+
+	// Since lists only bytes published at or after it, if set.
+	Since time.Time `json:"since"`
 }
 
 type BytesListResponse struct {
 	Bytes []BytesByte `json:"bytes"`
 }
 
+type BytesMonthCount struct {
+	Year  int `json:"year"`
+	Month int `json:"month"` // 1-12
+	Count int `json:"count"`
+}
+
 type BytesPromoteParams struct {
 
 	// Schedule decides how the promotion should be scheduled.
@@ -383,6 +508,17 @@ type BytesPublishParams struct {
 	Title   string `json:"title"`
 	Summary string `json:"summary"`
 	URL     string `json:"url"`
+
+	ImageURL     string `json:"image_url" qs:"image_url"`         // image shown on the byte's card
+	SiteName     string `json:"site_name" qs:"site_name"`         // name of the site the URL is on
+	CanonicalURL string `json:"canonical_url" qs:"canonical_url"` // canonical URL of the linked page
+
+	// Unfurl fetches the page at URL and fills in any of the fields
+	// above that are empty from its Open Graph metadata.
+	Unfurl bool `json:"unfurl"`
+
+	// Tags are the slugs of blog tags to tag the byte with.
+	Tags []string `json:"tags"`
 }
 
 type BytesPublishResponse struct {
@@ -391,9 +527,39 @@ type BytesPublishResponse struct {
 
 type BytesScheduleType = string
 
+type BytesUpdateParams struct {
+	Title        *string `json:"title"`
+	Summary      *string `json:"summary"`
+	URL          *string `json:"url"`
+	ImageURL     *string `json:"image_url" qs:"image_url"`
+	SiteName     *string `json:"site_name" qs:"site_name"`
+	CanonicalURL *string `json:"canonical_url" qs:"canonical_url"`
+
+	// Tags replaces the byte's tags with the blog tags with these slugs.
+	// An empty list removes all tags.
+	Tags *[]string `json:"tags"`
+}
+
 // BytesClient Provides you access to call public and authenticated APIs on bytes. The concrete implementation is bytesClient.
 // It is setup as an interface allowing you to use GoMock to create mock implementations during tests.
 type BytesClient interface {
+	// Archive lists the bytes published in a month or year, newest first.
+	// It isn't under /bytes since a fixed path there would conflict with Get.
+	Archive(ctx context.Context, params BytesArchiveParams) (BytesArchiveResponse, error)
+
+	// ArchiveCounts counts the bytes published per month, so the
+	// archive can be rendered without fetching every byte.
+	ArchiveCounts(ctx context.Context, params BytesArchiveCountsParams) (BytesArchiveCountsResponse, error)
+
+	// Delete deletes a byte and its tags.
+	Delete(ctx context.Context, id int64) error
+
+	// Feed serves the latest bytes as an RSS feed at /feed/bytes/rss
+	// or a JSON Feed at /feed/bytes/json. The query parameter "tag"
+	// limits the feed to bytes with the blog tag with that slug.
+	// It isn't under /bytes since a fixed path there would conflict with Get.
+	Feed(ctx context.Context, format string, request *http.Request) (*http.Response, error)
+
 	// Get retrieves a byte.
 	Get(ctx context.Context, id int64) (BytesByte, error)
 
@@ -403,8 +569,24 @@ type BytesClient interface {
 	// Promote schedules the promotion a byte.
 	Promote(ctx context.Context, id int64, params BytesPromoteParams) error
 
-	// Publish publishes a byte.
+	// Publish publishes a byte. Publishing a URL that has already been
+	// published updates its byte with the non-empty values and adds the tags.
 	Publish(ctx context.Context, params BytesPublishParams) (BytesPublishResponse, error)
+
+	// Share publishes a byte from a form POST, as sent by a Web Share Target
+	// or a bookmarklet. The form fields are "url", "title", "text" (the selected
+	// text, used as the summary) and optionally "tags" (comma-separated tag slugs).
+	// Whatever isn't given is unfurled from the page.
+	//
+	// It is the only endpoint that accepts API tokens rather than the password,
+	// so a token on a phone or in a browser can't do anything but share bytes.
+	// Browsers can't add an Authorization header to form posts, so the token
+	// can be given in the "token" field instead. It isn't accepted in the query
+	// string, where it would end up in logs, browser history and referrers.
+	Share(ctx context.Context, request *http.Request) (*http.Response, error)
+
+	// Update updates a byte. Changing its URL clears the result of the last link check.
+	Update(ctx context.Context, id int64, params BytesUpdateParams) (BytesByte, error)
 }
 
 type bytesClient struct {
@@ -413,6 +595,47 @@ type bytesClient struct {
 
 var _ BytesClient = (*bytesClient)(nil)
 
+// Archive lists the bytes published in a month or year, newest first.
+// It isn't under /bytes since a fixed path there would conflict with Get.
+func (c *bytesClient) Archive(ctx context.Context, params BytesArchiveParams) (resp BytesArchiveResponse, err error) {
+	queryString := url.Values{
+		"month": []string{fmt.Sprint(params.Month)},
+		"tag":   []string{params.Tag},
+		"year":  []string{fmt.Sprint(params.Year)},
+	}
+	err = callAPI(ctx, c.base, "GET", fmt.Sprintf("/archive/bytes?%s", queryString.Encode()), nil, &resp)
+	return resp, err
+}
+
+// ArchiveCounts counts the bytes published per month, so the
+// archive can be rendered without fetching every byte.
+func (c *bytesClient) ArchiveCounts(ctx context.Context, params BytesArchiveCountsParams) (resp BytesArchiveCountsResponse, err error) {
+	queryString := url.Values{"tag": []string{params.Tag}}
+	err = callAPI(ctx, c.base, "GET", fmt.Sprintf("/archive/bytes/counts?%s", queryString.Encode()), nil, &resp)
+	return resp, err
+}
+
+// Delete deletes a byte and its tags.
+func (c *bytesClient) Delete(ctx context.Context, id int64) error {
+	return callAPI(ctx, c.base, "DELETE", fmt.Sprintf("/bytes/%d", id), nil, nil)
+}
+
+// Feed serves the latest bytes as an RSS feed at /feed/bytes/rss
+// or a JSON Feed at /feed/bytes/json. The query parameter "tag"
+// limits the feed to bytes with the blog tag with that slug.
+// It isn't under /bytes since a fixed path there would conflict with Get.
+func (c *bytesClient) Feed(ctx context.Context, format string, request *http.Request) (*http.Response, error) {
+	path, err := url.Parse(fmt.Sprintf("/feed/bytes/%s", format))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse api url: %w", err)
+	}
+	path.RawQuery = request.URL.RawQuery
+	request = request.WithContext(ctx)
+	request.URL = path
+
+	return c.base.Do(request)
+}
+
 // Get retrieves a byte.
 func (c *bytesClient) Get(ctx context.Context, id int64) (resp BytesByte, err error) {
 	err = callAPI(ctx, c.base, "GET", fmt.Sprintf("/bytes/%d", id), nil, &resp)
@@ -422,8 +645,11 @@ func (c *bytesClient) Get(ctx context.Context, id int64) (resp BytesByte, err er
 // List lists published bytes.
 func (c *bytesClient) List(ctx context.Context, params BytesListParams) (resp BytesListResponse, err error) {
 	queryString := url.Values{
+		"broken": []string{fmt.Sprint(params.Broken)},
 		"limit":  []string{fmt.Sprint(params.Limit)},
 		"offset": []string{fmt.Sprint(params.Offset)},
+		"since":  []string{params.Since.Format(time.RFC3339)},
+		"tag":    []string{params.Tag},
 	}
 	err = callAPI(ctx, c.base, "GET", fmt.Sprintf("/bytes?%s", queryString.Encode()), nil, &resp)
 	return resp, err
@@ -434,28 +660,225 @@ func (c *bytesClient) Promote(ctx context.Context, id int64, params BytesPromote
 	return callAPI(ctx, c.base, "POST", fmt.Sprintf("/bytes/%d/promote", id), params, nil)
 }
 
-// Publish publishes a byte.
+// Publish publishes a byte. Publishing a URL that has already been
+// published updates its byte with the non-empty values and adds the tags.
 func (c *bytesClient) Publish(ctx context.Context, params BytesPublishParams) (resp BytesPublishResponse, err error) {
 	err = callAPI(ctx, c.base, "POST", "/bytes", params, &resp)
 	return resp, err
 }
 
-type EmailSubscribeParams struct {
+// Share publishes a byte from a form POST, as sent by a Web Share Target
+// or a bookmarklet. The form fields are "url", "title", "text" (the selected
+// text, used as the summary) and optionally "tags" (comma-separated tag slugs).
+// Whatever isn't given is unfurled from the page.
+//
+// It is the only endpoint that accepts API tokens rather than the password,
+// so a token on a phone or in a browser can't do anything but share bytes.
+// Browsers can't add an Authorization header to form posts, so the token
+// can be given in the "token" field instead. It isn't accepted in the query
+// string, where it would end up in logs, browser history and referrers.
+func (c *bytesClient) Share(ctx context.Context, request *http.Request) (*http.Response, error) {
+	path, err := url.Parse("/share/bytes")
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse api url: %w", err)
+	}
+	request = request.WithContext(ctx)
+	request.URL = path
+
+	return c.base.Do(request)
+}
+
+// Update updates a byte. Changing its URL clears the result of the last link check.
+func (c *bytesClient) Update(ctx context.Context, id int64, params BytesUpdateParams) (resp BytesByte, err error) {
+	err = callAPI(ctx, c.base, "PATCH", fmt.Sprintf("/bytes/%d", id), params, &resp)
+	return resp, err
+}
+
+type EmailAddSubscriberParams struct {
 	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+type EmailCampaign struct {
+	ID          int64               `json:"id"`
+	TemplateID  string              `json:"template_id" qs:"template_id"`
+	Segment     *EmailSegment       `json:"segment"` // Segment is the segment the campaign was sent to. It is nil if it was sent to all subscribers.
+	CreatedAt   time.Time           `json:"created_at" qs:"created_at"`
+	CancelledAt *time.Time          `json:"cancelled_at" qs:"cancelled_at"` // nil if not cancelled
+	Stats       *EmailCampaignStats `json:"stats"`
+}
+
+type EmailCampaignStats struct {
+	Scheduled    int `json:"scheduled"`    // total number of messages
+	Pending      int `json:"pending"`      // not yet sent, failed or cancelled
+	Sent         int `json:"sent"`         // successfully sent
+	Failed       int `json:"failed"`       // given up on after failing to send
+	Cancelled    int `json:"cancelled"`    // cancelled before being sent
+	Opened       int `json:"opened"`       // opened by the recipient
+	Unsubscribed int `json:"unsubscribed"` // led to the recipient unsubscribing
+}
+
+type EmailCancelCampaignResponse struct {
+	NumCancelled int `json:"num_cancelled" qs:"num_cancelled"` // number of messages cancelled
+}
+
+type EmailConfirmParams struct {
+	Token string `json:"token"` // Token is the confirmation token from the confirmation email.
+}
+
+type EmailGetPreferencesParams struct {
+	Token string `json:"token"` // Token is the preferences token from an email.
+}
+
+type EmailImportSubscriber struct {
+	Email   string     `json:"email"`
+	Name    string     `json:"name"`
+	OptInAt *time.Time `json:"optin_at" qs:"optin_at"` // OptInAt is when the subscriber opted in. It defaults to the current time.
+}
+
+type EmailImportSubscribersParams struct {
+	Source      string                  `json:"source"` // Source records where the subscribers opted in, such as the name of another newsletter.
+	Subscribers []EmailImportSubscriber `json:"subscribers"`
+}
+
+type EmailImportSubscribersResponse struct {
+	NumImported int `json:"num_imported" qs:"num_imported"` // number of new subscribers
+}
+
+type EmailListCampaignsParams struct {
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+}
+
+type EmailListCampaignsResponse struct {
+	Campaigns []EmailCampaign `json:"campaigns"`
+}
+
+type EmailListSubscribersParams struct {
+	Query  string `json:"query"` // Query optionally filters subscribers by a substring of their email or name.
+	All    bool   `json:"all"`   // All includes subscribers that have opted out or are pending.
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+}
+
+type EmailListSubscribersResponse struct {
+	Subscribers []EmailSubscriber `json:"subscribers"`
+}
+
+type EmailPreferences struct {
+	Email     string       `json:"email"`
+	Topics    []string     `json:"topics"`    // Topics are the slugs of the topics the subscriber has chosen. If empty the subscriber receives emails about every topic.
+	Available []EmailTopic `json:"available"` // Available are the topics that can be chosen.
+}
+
+type EmailPreviewTemplateParams struct {
+	EmailAddress string `json:"email_address" qs:"email_address"` // EmailAddress is the address to render the preview for.
+}
+
+type EmailPreviewTemplateResponse struct {
+	Subject  string `json:"subject"`
+	BodyText string `json:"body_text" qs:"body_text"`
+	BodyHTML string `json:"body_html" qs:"body_html"`
+}
+
+type EmailPromotePostParams struct {
+	SendAt *time.Time `json:"send_at" qs:"send_at"` // SendAt is the time to send the email. If nil it defaults to the current time.
+}
+
+type EmailResendCampaignResponse struct {
+	NumScheduled int `json:"num_scheduled" qs:"num_scheduled"` // number of messages scheduled again
+}
+
+type EmailScheduleResponse struct {
+	MessageIDs []int64 `json:"message_i_ds" qs:"message_i_ds"` // MessageIDs are the ids for the messages that were scheduled.
+	CampaignID int64   `json:"campaign_id" qs:"campaign_id"`   // CampaignID is the campaign the messages are part of, if any.
+}
+
+type EmailSegment struct {
+	Topics []string `json:"topics"` // Topics are the tag slugs the email is about. The email is sent to subscribers of any of the topics, as well as to subscribers who haven't chosen any topics.
+}
+
+type EmailSubscriber struct {
+	Email        string      `json:"email"`
+	Name         string      `json:"name"`
+	OptIn        bool        `json:"optin" qs:"optin"`
+	OptInChanged time.Time   `json:"optin_changed" qs:"optin_changed"`
+	OptInSource  string      `json:"optin_source" qs:"optin_source"` // how the subscriber opted in, such as "website" or "import"
+	Pending      bool        `json:"pending"`                        // awaiting confirmation
+	Unsubscribes []time.Time `json:"unsubscribes"`                   // Unsubscribes are the times the subscriber unsubscribed, newest first.
+}
+
+type EmailTopic struct {
+	Slug string `json:"slug"`
+	Name string `json:"name"`
 }
 
 type EmailUnsubscribeParams struct {
 	Token string `json:"token"` // Token is the unsubscribe token in to the email.
 }
 
+type EmailUpdatePreferencesParams struct {
+	Token  string   `json:"token"`  // Token is the preferences token from an email.
+	Topics []string `json:"topics"` // Topics are the slugs of the topics to receive emails about, replacing any previous choice. Empty means every topic.
+}
+
 // EmailClient Provides you access to call public and authenticated APIs on email. The concrete implementation is emailClient.
 // It is setup as an interface allowing you to use GoMock to create mock implementations during tests.
 type EmailClient interface {
+	// AddSubscriber subscribes an address directly, without requiring confirmation.
+	// It reports AlreadyExists if the address is known, even if it has unsubscribed,
+	// since adding it must not resubscribe someone who has unsubscribed.
+	AddSubscriber(ctx context.Context, params EmailAddSubscriberParams) error
+
+	// CancelCampaign cancels the messages in a campaign that have not been sent yet.
+	CancelCampaign(ctx context.Context, id int64) (EmailCancelCampaignResponse, error)
+
+	// Confirm confirms a pending subscription to the email newsletter.
+	Confirm(ctx context.Context, params EmailConfirmParams) error
+
+	// GetCampaign returns a campaign and its stats.
+	GetCampaign(ctx context.Context, id int64) (EmailCampaign, error)
+
+	// GetPreferences returns the email preferences of a subscriber.
+	GetPreferences(ctx context.Context, params EmailGetPreferencesParams) (EmailPreferences, error)
+
+	// ImportSubscribers bulk-loads opted-in subscribers.
+	// Addresses that already exist are left untouched, so that imports
+	// never resubscribe someone who has unsubscribed.
+	ImportSubscribers(ctx context.Context, params EmailImportSubscribersParams) (EmailImportSubscribersResponse, error)
+
+	// ListCampaigns lists campaigns and their stats, newest first.
+	ListCampaigns(ctx context.Context, params EmailListCampaignsParams) (EmailListCampaignsResponse, error)
+
+	// ListSubscribers lists and searches newsletter subscribers.
+	ListSubscribers(ctx context.Context, params EmailListSubscribersParams) (EmailListSubscribersResponse, error)
+
+	// PreviewTemplate renders an email template as it would be sent to a given address.
+	// The unsubscribe link in the preview is not valid.
+	PreviewTemplate(ctx context.Context, id string, params EmailPreviewTemplateParams) (EmailPreviewTemplateResponse, error)
+
+	// PromotePost emails a blog post to the subscribers of its tags.
+	PromotePost(ctx context.Context, slug string, params EmailPromotePostParams) (EmailScheduleResponse, error)
+
+	// RemoveSubscriber permanently removes a subscriber and their message history.
+	RemoveSubscriber(ctx context.Context, email string) error
+
+	// ResendCampaign schedules the failed messages in a campaign to be sent again.
+	// Recipients that are no longer opted in are skipped.
+	ResendCampaign(ctx context.Context, id int64) (EmailResendCampaignResponse, error)
+
 	// Subscribe subscribes to the email newsletter for a given email.
-	Subscribe(ctx context.Context, params EmailSubscribeParams) error
+	// The subscription is pending until it is confirmed using the link
+	// in the confirmation email that is sent to the address.
+	// It takes SubscribeParams as JSON, and is raw so that it can set
+	// the Retry-After header when rate limited.
+	Subscribe(ctx context.Context, request *http.Request) (*http.Response, error)
 
 	// Unsubscribe unsubscribes the user from the email list.
 	Unsubscribe(ctx context.Context, params EmailUnsubscribeParams) error
+
+	// UpdatePreferences updates the email preferences of a subscriber.
+	UpdatePreferences(ctx context.Context, params EmailUpdatePreferencesParams) error
 }
 
 type emailClient struct {
@@ -464,9 +887,108 @@ type emailClient struct {
 
 var _ EmailClient = (*emailClient)(nil)
 
+// AddSubscriber subscribes an address directly, without requiring confirmation.
+// It reports AlreadyExists if the address is known, even if it has unsubscribed,
+// since adding it must not resubscribe someone who has unsubscribed.
+func (c *emailClient) AddSubscriber(ctx context.Context, params EmailAddSubscriberParams) error {
+	return callAPI(ctx, c.base, "POST", "/email/subscribers", params, nil)
+}
+
+// CancelCampaign cancels the messages in a campaign that have not been sent yet.
+func (c *emailClient) CancelCampaign(ctx context.Context, id int64) (resp EmailCancelCampaignResponse, err error) {
+	err = callAPI(ctx, c.base, "POST", fmt.Sprintf("/email/campaigns/%d/cancel", id), nil, &resp)
+	return resp, err
+}
+
+// Confirm confirms a pending subscription to the email newsletter.
+func (c *emailClient) Confirm(ctx context.Context, params EmailConfirmParams) error {
+	return callAPI(ctx, c.base, "POST", "/email/confirm", params, nil)
+}
+
+// GetCampaign returns a campaign and its stats.
+func (c *emailClient) GetCampaign(ctx context.Context, id int64) (resp EmailCampaign, err error) {
+	err = callAPI(ctx, c.base, "GET", fmt.Sprintf("/email/campaigns/%d", id), nil, &resp)
+	return resp, err
+}
+
+// GetPreferences returns the email preferences of a subscriber.
+func (c *emailClient) GetPreferences(ctx context.Context, params EmailGetPreferencesParams) (resp EmailPreferences, err error) {
+	queryString := url.Values{
+		"token": []string{params.Token},
+	}
+	err = callAPI(ctx, c.base, "GET", fmt.Sprintf("/email/preferences?%s", queryString.Encode()), nil, &resp)
+	return resp, err
+}
+
+// ImportSubscribers bulk-loads opted-in subscribers.
+// Addresses that already exist are left untouched, so that imports
+// never resubscribe someone who has unsubscribed.
+func (c *emailClient) ImportSubscribers(ctx context.Context, params EmailImportSubscribersParams) (resp EmailImportSubscribersResponse, err error) {
+	err = callAPI(ctx, c.base, "POST", "/email/subscribers/import", params, &resp)
+	return resp, err
+}
+
+// ListCampaigns lists campaigns and their stats, newest first.
+func (c *emailClient) ListCampaigns(ctx context.Context, params EmailListCampaignsParams) (resp EmailListCampaignsResponse, err error) {
+	queryString := url.Values{
+		"limit":  []string{fmt.Sprint(params.Limit)},
+		"offset": []string{fmt.Sprint(params.Offset)},
+	}
+	err = callAPI(ctx, c.base, "GET", fmt.Sprintf("/email/campaigns?%s", queryString.Encode()), nil, &resp)
+	return resp, err
+}
+
+// ListSubscribers lists and searches newsletter subscribers.
+func (c *emailClient) ListSubscribers(ctx context.Context, params EmailListSubscribersParams) (resp EmailListSubscribersResponse, err error) {
+	queryString := url.Values{
+		"all":    []string{fmt.Sprint(params.All)},
+		"limit":  []string{fmt.Sprint(params.Limit)},
+		"offset": []string{fmt.Sprint(params.Offset)},
+		"query":  []string{params.Query},
+	}
+	err = callAPI(ctx, c.base, "GET", fmt.Sprintf("/email/subscribers?%s", queryString.Encode()), nil, &resp)
+	return resp, err
+}
+
+// PreviewTemplate renders an email template as it would be sent to a given address.
+// The unsubscribe link in the preview is not valid.
+func (c *emailClient) PreviewTemplate(ctx context.Context, id string, params EmailPreviewTemplateParams) (resp EmailPreviewTemplateResponse, err error) {
+	err = callAPI(ctx, c.base, "POST", fmt.Sprintf("/email/templates/%s/preview", id), params, &resp)
+	return resp, err
+}
+
+// PromotePost emails a blog post to the subscribers of its tags.
+func (c *emailClient) PromotePost(ctx context.Context, slug string, params EmailPromotePostParams) (resp EmailScheduleResponse, err error) {
+	err = callAPI(ctx, c.base, "POST", fmt.Sprintf("/email/promote/%s", slug), params, &resp)
+	return resp, err
+}
+
+// RemoveSubscriber permanently removes a subscriber and their message history.
+func (c *emailClient) RemoveSubscriber(ctx context.Context, email string) error {
+	return callAPI(ctx, c.base, "DELETE", fmt.Sprintf("/email/subscribers/%s", url.PathEscape(email)), nil, nil)
+}
+
+// ResendCampaign schedules the failed messages in a campaign to be sent again.
+// Recipients that are no longer opted in are skipped.
+func (c *emailClient) ResendCampaign(ctx context.Context, id int64) (resp EmailResendCampaignResponse, err error) {
+	err = callAPI(ctx, c.base, "POST", fmt.Sprintf("/email/campaigns/%d/resend", id), nil, &resp)
+	return resp, err
+}
+
 // Subscribe subscribes to the email newsletter for a given email.
-func (c *emailClient) Subscribe(ctx context.Context, params EmailSubscribeParams) error {
-	return callAPI(ctx, c.base, "POST", "/email/subscribe", params, nil)
+// The subscription is pending until it is confirmed using the link
+// in the confirmation email that is sent to the address.
+// It takes SubscribeParams as JSON, and is raw so that it can set
+// the Retry-After header when rate limited.
+func (c *emailClient) Subscribe(ctx context.Context, request *http.Request) (*http.Response, error) {
+	path, err := url.Parse("/email/subscribe")
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse api url: %w", err)
+	}
+	request = request.WithContext(ctx)
+	request.URL = path
+
+	return c.base.Do(request)
 }
 
 // Unsubscribe unsubscribes the user from the email list.
@@ -474,32 +996,170 @@ func (c *emailClient) Unsubscribe(ctx context.Context, params EmailUnsubscribePa
 	return callAPI(ctx, c.base, "POST", "/email/unsubscribe", params, nil)
 }
 
+// UpdatePreferences updates the email preferences of a subscriber.
+func (c *emailClient) UpdatePreferences(ctx context.Context, params EmailUpdatePreferencesParams) error {
+	return callAPI(ctx, c.base, "POST", "/email/preferences", params, nil)
+}
+
+type LinkcheckStatus struct {
+	Status    int       `json:"status"`                   // HTTP status code, or 0 if the request failed
+	FinalURL  string    `json:"final_url" qs:"final_url"` // URL after following redirects
+	Error     string    `json:"error"`                    // why the request failed, if it did
+	Broken    bool      `json:"broken"`
+	CheckedAt time.Time `json:"checked_at" qs:"checked_at"`
+}
+
+type TwitterContentStats struct {
+	Source      string    `json:"source"`                   // kind of content, such as "byte" or "post"
+	SourceID    string    `json:"source_id" qs:"source_id"` // byte id or post slug
+	Tweets      int       `json:"tweets"`                   // number of tweets with metrics
+	Likes       int       `json:"likes"`
+	Reposts     int       `json:"reposts"`
+	Replies     int       `json:"replies"`
+	Impressions int       `json:"impressions"`
+	Engagement  int       `json:"engagement"`                     // sum of likes, reposts and replies
+	CollectedAt time.Time `json:"collected_at" qs:"collected_at"` // when metrics were last collected
+}
+
+type TwitterStatsParams struct {
+
+	// Source optionally filters the results to a single kind of content,
+	// such as "byte" or "post".
+	Source string `json:"source"`
+
+	// Limit is the maximum number of results. It defaults to 20.
+	Limit int `json:"limit"`
+}
+
+type TwitterStatsResponse struct {
+	Stats []TwitterContentStats `json:"stats"`
+}
+
+// TwitterClient Provides you access to call public and authenticated APIs on twitter. The concrete implementation is twitterClient.
+// It is setup as an interface allowing you to use GoMock to create mock implementations during tests.
+type TwitterClient interface {
+	// Stats ranks promoted content by the engagement of its tweets.
+	Stats(ctx context.Context, params TwitterStatsParams) (TwitterStatsResponse, error)
+}
+
+type twitterClient struct {
+	base *baseClient
+}
+
+var _ TwitterClient = (*twitterClient)(nil)
+
+// Stats ranks promoted content by the engagement of its tweets.
+func (c *twitterClient) Stats(ctx context.Context, params TwitterStatsParams) (resp TwitterStatsResponse, err error) {
+	queryString := url.Values{
+		"limit":  []string{fmt.Sprint(params.Limit)},
+		"source": []string{params.Source},
+	}
+	err = callAPI(ctx, c.base, "GET", fmt.Sprintf("/twitter/stats?%s", queryString.Encode()), nil, &resp)
+	return resp, err
+}
+
+type UrlDailyClicks struct {
+	Date   string `json:"date"` // in YYYY-MM-DD format, UTC
+	Clicks int    `json:"clicks"`
+}
+
 type UrlGetListResponse struct {
 	Count int      `json:"count"`
 	URLS  []UrlURL `json:"urls"`
 }
 
-type UrlShortenParams struct {
-	URL string `json:"url"` // the URL to shorten
+type UrlReferrerClicks struct {
+	Referrer string `json:"referrer"` // empty for direct visits
+	Clicks   int    `json:"clicks"`
+}
+
+type UrlStats struct {
+	ID string `json:"id"`
+
+	// Total is the total number of clicks ever.
+	Total int `json:"total"`
+
+	// Daily are the number of clicks per day, oldest first.
+	Daily []UrlDailyClicks `json:"daily"`
+
+	// TopReferrers are the referring hosts with the most clicks
+	// over the reported days, most clicks first.
+	TopReferrers []UrlReferrerClicks `json:"top_referrers"`
+}
+
+type UrlStatsParams struct {
+	// Days is the number of days to report daily counts for,
+	// including today. It defaults to 30 and is at most 365.
+	Days int `json:"days"`
 }
 
 type UrlURL struct {
-	ID       string `json:"id"`                       // short-form URL id
-	URL      string `json:"url"`                      // original URL, in long form
-	ShortURL string `json:"short_url" qs:"short_url"` // short URL
+	ID        string     `json:"id"`                         // short-form URL id
+	URL       string     `json:"url"`                        // original URL, in long form
+	ShortURL  string     `json:"short_url" qs:"short_url"`   // short URL
+	Owner     string     `json:"owner"`                      // user who created the short URL; empty unless authenticated
+	CreatedAt *time.Time `json:"created_at" qs:"created_at"` // nil if unknown
+	ExpiresAt *time.Time `json:"expires_at" qs:"expires_at"` // when it stops redirecting; nil if never
+	MaxClicks int        `json:"max_clicks" qs:"max_clicks"` // clicks after which it stops redirecting; 0 if unlimited
+	Disabled  bool       `json:"disabled"`                   // whether redirecting is turned off
+
+	// Protected reports whether a passphrase is required to follow the short URL.
+	// The original URL of protected short URLs, as well as of disabled and
+	// expired ones, is only shown to authenticated users.
+	Protected bool `json:"protected"`
+
+	// Link is the result of the latest check of the original URL,
+	// or nil if it hasn't been checked.
+	Link *LinkcheckStatus `json:"link"`
+}
+
+type UrlUpdateParams struct {
+	// ExpiresAt, if set, is the new time the short URL stops redirecting.
+	ExpiresAt *time.Time `json:"expires_at"`
+
+	// NoExpiry removes the expiry time of the short URL.
+	NoExpiry bool `json:"no_expiry"`
+
+	// MaxClicks, if set, is the new click limit. 0 removes the limit.
+	MaxClicks *int `json:"max_clicks"`
+
+	// Disabled, if set, disables or enables the short URL.
+	Disabled *bool `json:"disabled"`
+
+	// Passphrase, if set, is the new passphrase. Empty removes the passphrase.
+	Passphrase *string `json:"passphrase"`
 }
 
 // UrlClient Provides you access to call public and authenticated APIs on url. The concrete implementation is urlClient.
 // It is setup as an interface allowing you to use GoMock to create mock implementations during tests.
 type UrlClient interface {
+	// Delete deletes a short URL and its click history.
+	// Only the user who created the short URL can delete it.
+	Delete(ctx context.Context, id string) error
+
 	// Get retrieves the original URL for the id.
 	Get(ctx context.Context, id string) (UrlURL, error)
 
+	// GetStats reports click statistics for a short URL.
+	GetStats(ctx context.Context, id string, params UrlStatsParams) (UrlStats, error)
+
 	// List retrieves all shortened URLs
 	List(ctx context.Context) (UrlGetListResponse, error)
 
-	// Shorten shortens a URL.
-	Shorten(ctx context.Context, params UrlShortenParams) (UrlURL, error)
+	// QRCode renders a QR code for the short URL with the id in the path.
+	// The query parameters "format" ("png" or "svg", default "png"),
+	// "size" (in pixels, default 256) and "margin" (in modules, default 4)
+	// control how it is rendered. Short URLs that don't redirect,
+	// because they are disabled or expired, are reported as not found.
+	QRCode(ctx context.Context, id string, request *http.Request) (*http.Response, error)
+
+	// Shorten shortens a URL. It takes ShortenParams and returns the URL as JSON.
+	// It is raw so that it can set the Retry-After header when rate limited.
+	Shorten(ctx context.Context, request *http.Request) (*http.Response, error)
+
+	// Update updates the expiry, click limit, disabled flag or passphrase of a short URL.
+	// Only the user who created the short URL can update it.
+	Update(ctx context.Context, id string, params UrlUpdateParams) (UrlURL, error)
 }
 
 type urlClient struct {
@@ -508,21 +1168,65 @@ type urlClient struct {
 
 var _ UrlClient = (*urlClient)(nil)
 
+// Delete deletes a short URL and its click history.
+// Only the user who created the short URL can delete it.
+func (c *urlClient) Delete(ctx context.Context, id string) error {
+	return callAPI(ctx, c.base, "DELETE", fmt.Sprintf("/url/%s", id), nil, nil)
+}
+
 // Get retrieves the original URL for the id.
 func (c *urlClient) Get(ctx context.Context, id string) (resp UrlURL, err error) {
 	err = callAPI(ctx, c.base, "GET", fmt.Sprintf("/url/%s", id), nil, &resp)
 	return resp, err
 }
 
+// GetStats reports click statistics for a short URL.
+func (c *urlClient) GetStats(ctx context.Context, id string, params UrlStatsParams) (resp UrlStats, err error) {
+	queryString := url.Values{"days": []string{fmt.Sprint(params.Days)}}
+	err = callAPI(ctx, c.base, "GET", fmt.Sprintf("/url/%s/stats?%s", id, queryString.Encode()), nil, &resp)
+	return resp, err
+}
+
 // List retrieves all shortened URLs
 func (c *urlClient) List(ctx context.Context) (resp UrlGetListResponse, err error) {
 	err = callAPI(ctx, c.base, "GET", "/url", nil, &resp)
 	return resp, err
 }
 
-// Shorten shortens a URL.
-func (c *urlClient) Shorten(ctx context.Context, params UrlShortenParams) (resp UrlURL, err error) {
-	err = callAPI(ctx, c.base, "POST", "/url", params, &resp)
+// QRCode renders a QR code for the short URL with the id in the path.
+// The query parameters "format" ("png" or "svg", default "png"),
+// "size" (in pixels, default 256) and "margin" (in modules, default 4)
+// control how it is rendered. Short URLs that don't redirect,
+// because they are disabled or expired, are reported as not found.
+func (c *urlClient) QRCode(ctx context.Context, id string, request *http.Request) (*http.Response, error) {
+	path, err := url.Parse(fmt.Sprintf("/url/%s/qr", id))
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse api url: %w", err)
+	}
+	path.RawQuery = request.URL.RawQuery
+	request = request.WithContext(ctx)
+	request.URL = path
+
+	return c.base.Do(request)
+}
+
+// Shorten shortens a URL. It takes ShortenParams and returns the URL as JSON.
+// It is raw so that it can set the Retry-After header when rate limited.
+func (c *urlClient) Shorten(ctx context.Context, request *http.Request) (*http.Response, error) {
+	path, err := url.Parse("/url")
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse api url: %w", err)
+	}
+	request = request.WithContext(ctx)
+	request.URL = path
+
+	return c.base.Do(request)
+}
+
+// Update updates the expiry, click limit, disabled flag or passphrase of a short URL.
+// Only the user who created the short URL can update it.
+func (c *urlClient) Update(ctx context.Context, id string, params UrlUpdateParams) (resp UrlURL, err error) {
+	err = callAPI(ctx, c.base, "PATCH", fmt.Sprintf("/url/%s", id), params, &resp)
 	return resp, err
 }
 
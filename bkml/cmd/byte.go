@@ -25,6 +25,7 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"strconv"
 
 	"github.com/spf13/cobra"
 
@@ -32,11 +33,15 @@ import (
 )
 
 func init() {
-	var title, desc string
+	var (
+		title, desc, image string
+		unfurl             bool
+		tags               []string
+	)
 
 	// byteCmd represents the shorten command
 	var byteCmd = &cobra.Command{
-		Use:   "byte URL --title=TITLE --desc=DESC",
+		Use:   "byte URL [--title=TITLE] [--desc=DESC] [--tags=TAG,...]",
 		Short: "Publish a quick byte, a short post that links to interesting articles etc",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -47,15 +52,14 @@ func init() {
 				return errors.New("url must be fully qualified with a scheme and a host")
 			}
 
-			if title == "" {
-				return errors.New("--title must not be empty")
-			}
-
-			// Generate the short URL
+			// Without a title it must be fetched from the page.
 			resp, err := backend.Bytes.Publish(cmd.Context(), client.BytesPublishParams{
-				Title:   title,
-				Summary: desc,
-				URL:     args[0],
+				Title:    title,
+				Summary:  desc,
+				URL:      args[0],
+				ImageURL: image,
+				Unfurl:   unfurl || title == "",
+				Tags:     tags,
 			})
 			cobra.CheckErr(err)
 			fmt.Printf("Successfully published byte with id %v\n", resp.ID)
@@ -63,7 +67,73 @@ func init() {
 		},
 	}
 
-	byteCmd.Flags().StringVar(&title, "title", "", "The byte's title (required)")
+	byteCmd.Flags().StringVar(&title, "title", "", "The byte's title (optional, fetched from the page if empty)")
 	byteCmd.Flags().StringVar(&desc, "desc", "", "The byte's description (optional)")
+	byteCmd.Flags().StringVar(&image, "image", "", "URL of the image shown on the byte's card (optional)")
+	byteCmd.Flags().BoolVar(&unfurl, "unfurl", false, "Fetch the page's title, description, image and site name for any not given")
+	byteCmd.Flags().StringSliceVar(&tags, "tags", nil, "Slugs of blog tags to tag the byte with (optional)")
+
+	var editTitle, editDesc, editURL, editImage string
+	var editTags []string
+	editCmd := &cobra.Command{
+		Use:   "edit ID [--title=TITLE] [--desc=DESC] [--url=URL] [--image=URL] [--tags=TAG,...]",
+		Short: "Change a published byte",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			cobra.CheckErr(err)
+
+			// Only change what was given on the command line.
+			var p client.BytesUpdateParams
+			flags := cmd.Flags()
+			if flags.Changed("title") {
+				p.Title = &editTitle
+			}
+			if flags.Changed("desc") {
+				p.Summary = &editDesc
+			}
+			if flags.Changed("url") {
+				u, err := url.Parse(editURL)
+				cobra.CheckErr(err)
+				if u.Scheme == "" {
+					return errors.New("url must be fully qualified with a scheme and a host")
+				}
+				p.URL = &editURL
+			}
+			if flags.Changed("image") {
+				p.ImageURL = &editImage
+			}
+			if flags.Changed("tags") {
+				p.Tags = &editTags
+			}
+
+			b, err := backend.Bytes.Update(cmd.Context(), id, p)
+			cobra.CheckErr(err)
+			fmt.Printf("Successfully updated byte with id %v\n", b.ID)
+			return nil
+		},
+	}
+	editCmd.Flags().StringVar(&editTitle, "title", "", "The byte's new title")
+	editCmd.Flags().StringVar(&editDesc, "desc", "", "The byte's new description")
+	editCmd.Flags().StringVar(&editURL, "url", "", "The byte's new URL")
+	editCmd.Flags().StringVar(&editImage, "image", "", "URL of the new image shown on the byte's card")
+	editCmd.Flags().StringSliceVar(&editTags, "tags", nil, "Slugs of the blog tags replacing the byte's tags, or empty to remove them")
+
+	rmCmd := &cobra.Command{
+		Use:   "rm ID...",
+		Short: "Delete published bytes",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, arg := range args {
+				id, err := strconv.ParseInt(arg, 10, 64)
+				cobra.CheckErr(err)
+				cobra.CheckErr(backend.Bytes.Delete(cmd.Context(), id))
+			}
+			return nil
+		},
+	}
+
+	byteCmd.AddCommand(editCmd)
+	byteCmd.AddCommand(rmCmd)
 	rootCmd.AddCommand(byteCmd)
 }
@@ -0,0 +1,99 @@
+/*
+Copyright © 2022 Brian Ketelsen<mail@bjk.fyi>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"encore.app/bkml/client"
+)
+
+// bytesPageSize is the number of bytes fetched per request.
+const bytesPageSize = 100
+
+func init() {
+	var (
+		broken bool
+		tag    string
+	)
+
+	bytesCmd := &cobra.Command{
+		Use:   "bytes",
+		Short: "Manage published bytes",
+	}
+
+	lsCmd := &cobra.Command{
+		Use:   "ls",
+		Short: "List published bytes and whether their links still work",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tTITLE\tURL\tLINK\tCHECKED")
+			for offset := 0; ; offset += bytesPageSize {
+				resp, err := backend.Bytes.List(cmd.Context(), client.BytesListParams{
+					Limit:  bytesPageSize,
+					Offset: offset,
+					Broken: broken,
+					Tag:    tag,
+				})
+				cobra.CheckErr(err)
+				for _, b := range resp.Bytes {
+					checked := ""
+					if b.Link != nil {
+						checked = b.Link.CheckedAt.Format("2006-01-02")
+					}
+					fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", b.ID, b.Title, b.URL, linkHealth(b.Link, b.URL), checked)
+				}
+				if len(resp.Bytes) < bytesPageSize {
+					break
+				}
+			}
+			return w.Flush()
+		},
+	}
+	lsCmd.Flags().BoolVar(&broken, "broken", false, "only list bytes whose links were broken when last checked")
+	lsCmd.Flags().StringVar(&tag, "tag", "", "only list bytes with the blog tag with this slug")
+
+	bytesCmd.AddCommand(lsCmd)
+	rootCmd.AddCommand(bytesCmd)
+}
+
+// linkHealth describes the result of a link check,
+// including where the link redirects to if anywhere else.
+func linkHealth(link *client.LinkcheckStatus, url string) string {
+	switch {
+	case link == nil:
+		return "unchecked"
+	case link.Status == 0:
+		return "broken: " + link.Error
+	case link.Broken:
+		return fmt.Sprintf("broken: %d", link.Status)
+	case link.FinalURL != url:
+		return fmt.Sprintf("ok: %d -> %s", link.Status, link.FinalURL)
+	default:
+		return fmt.Sprintf("ok: %d", link.Status)
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright © 2022 Brian Ketelsen<mail@bjk.fyi>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"encore.app/bkml/client"
+)
+
+var (
+	shorteditExpires    string
+	shorteditNoExpiry   bool
+	shorteditMaxClicks  int
+	shorteditEnable     bool
+	shorteditDisable    bool
+	shorteditPassphrase string
+)
+
+// shorteditCmd represents the shortedit command
+var shorteditCmd = &cobra.Command{
+	Use:   "shortedit ID",
+	Short: "Change the expiry, click limit, passphrase or disabled state of a shortened URL",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if shorteditEnable && shorteditDisable {
+			return errors.New("--enable and --disable can't be used together")
+		}
+
+		var p client.UrlUpdateParams
+		flags := cmd.Flags()
+		if shorteditExpires != "" {
+			expiresAt, err := parseExpiry(shorteditExpires)
+			cobra.CheckErr(err)
+			p.ExpiresAt = expiresAt
+		}
+		p.NoExpiry = shorteditNoExpiry
+		if flags.Changed("max-clicks") {
+			p.MaxClicks = &shorteditMaxClicks
+		}
+		if shorteditEnable || shorteditDisable {
+			disabled := shorteditDisable
+			p.Disabled = &disabled
+		}
+		if flags.Changed("passphrase") {
+			p.Passphrase = &shorteditPassphrase
+		}
+
+		u, err := backend.Url.Update(cmd.Context(), args[0], p)
+		cobra.CheckErr(err)
+		fmt.Println(u.ShortURL, u.URL)
+		return nil
+	},
+}
+
+// shortrmCmd represents the shortrm command
+var shortrmCmd = &cobra.Command{
+	Use:   "shortrm ID...",
+	Short: "Delete shortened URLs and their click history",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, id := range args {
+			cobra.CheckErr(backend.Url.Delete(cmd.Context(), id))
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(shorteditCmd)
+	rootCmd.AddCommand(shortrmCmd)
+	shorteditCmd.Flags().StringVar(&shorteditExpires, "expires", "", "when the short URL expires, as a duration like 72h, a date or an RFC 3339 time")
+	shorteditCmd.Flags().BoolVar(&shorteditNoExpiry, "no-expiry", false, "remove the expiry time")
+	shorteditCmd.Flags().IntVar(&shorteditMaxClicks, "max-clicks", 0, "number of clicks after which the short URL expires, or 0 for no limit")
+	shorteditCmd.Flags().BoolVar(&shorteditEnable, "enable", false, "enable the short URL")
+	shorteditCmd.Flags().BoolVar(&shorteditDisable, "disable", false, "disable the short URL")
+	shorteditCmd.Flags().StringVar(&shorteditPassphrase, "passphrase", "", "new passphrase, or empty to remove it")
+}
@@ -22,15 +22,36 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"encore.app/bkml/client"
 )
 
+var (
+	shortenAlias        string
+	shortenCanonicalize bool
+	shortenExpires      string
+	shortenMaxClicks    int
+	shortenDisabled     bool
+	shortenPassphrase   string
+	shortenQR           string
+	shortenQRSize       int
+)
+
 // shortenCmd represents the shorten command
 var shortenCmd = &cobra.Command{
 	Use:   "shorten URL",
@@ -44,16 +65,129 @@ var shortenCmd = &cobra.Command{
 			return errors.New("url must be fully qualified with a scheme and a host")
 		}
 
+		var expiresAt *time.Time
+		if shortenExpires != "" {
+			expiresAt, err = parseExpiry(shortenExpires)
+			cobra.CheckErr(err)
+		}
+
 		// Generate the short URL
-		resp, err := backend.Url.Shorten(cmd.Context(), client.UrlShortenParams{
-			URL: args[0],
+		resp, err := shorten(cmd.Context(), &shortenParams{
+			URL:          args[0],
+			Alias:        shortenAlias,
+			Canonicalize: shortenCanonicalize,
+			ExpiresAt:    expiresAt,
+			MaxClicks:    shortenMaxClicks,
+			Disabled:     shortenDisabled,
+			Passphrase:   shortenPassphrase,
 		})
 		cobra.CheckErr(err)
 		fmt.Println(resp.ShortURL)
+
+		if shortenQR != "" {
+			cobra.CheckErr(saveQRCode(cmd.Context(), resp.ID, shortenQR, shortenQRSize))
+		}
 		return nil
 	},
 }
 
+// shortenParams is the JSON body of url.Shorten, which is raw
+// so the generated client has no type for it.
+type shortenParams struct {
+	URL          string     `json:"url"`
+	Alias        string     `json:"alias,omitempty"`
+	Canonicalize bool       `json:"canonicalize,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	MaxClicks    int        `json:"max_clicks,omitempty"`
+	Disabled     bool       `json:"disabled,omitempty"`
+	Passphrase   string     `json:"passphrase,omitempty"`
+}
+
+// shorten shortens a URL using the raw url.Shorten endpoint.
+func shorten(ctx context.Context, p *shortenParams) (client.UrlURL, error) {
+	var u client.UrlURL
+	body, err := json.Marshal(p)
+	if err != nil {
+		return u, err
+	}
+	req, err := http.NewRequest("POST", "", bytes.NewReader(body))
+	if err != nil {
+		return u, err
+	}
+	resp, err := backend.Url.Shorten(ctx, req)
+	if err != nil {
+		return u, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		if retry := resp.Header.Get("Retry-After"); retry != "" {
+			return u, fmt.Errorf("unable to shorten url: %s, retry after %ss: %s", resp.Status, retry, body)
+		}
+		return u, fmt.Errorf("unable to shorten url: %s: %s", resp.Status, body)
+	}
+	return u, json.NewDecoder(resp.Body).Decode(&u)
+}
+
+// saveQRCode saves the QR code for the short URL with the given id to a file.
+// The file extension decides the format, which is SVG for ".svg" and PNG otherwise.
+func saveQRCode(ctx context.Context, id, filename string, size int) error {
+	format := "png"
+	if strings.EqualFold(filepath.Ext(filename), ".svg") {
+		format = "svg"
+	}
+	query := url.Values{
+		"format": []string{format},
+		"size":   []string{strconv.Itoa(size)},
+	}
+	req, err := http.NewRequest("GET", "?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := backend.Url.QRCode(ctx, id, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unable to get qr code: %s: %s", resp.Status, body)
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// parseExpiry parses an expiry time given either as a duration from now,
+// like "72h", as a date, like "2022-06-30", or in RFC 3339 format.
+func parseExpiry(s string) (*time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		t := time.Now().Add(d)
+		return &t, nil
+	}
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid expiry %q: must be a duration, a date or an RFC 3339 time", s)
+}
+
 func init() {
 	rootCmd.AddCommand(shortenCmd)
+	shortenCmd.Flags().StringVar(&shortenAlias, "alias", "", "vanity id for the short URL instead of a random one")
+	shortenCmd.Flags().BoolVar(&shortenCanonicalize, "canonicalize", false, "reuse the short URL of a URL with the same canonical form if it exists")
+	shortenCmd.Flags().StringVar(&shortenExpires, "expires", "", "when the short URL expires, as a duration like 72h, a date or an RFC 3339 time")
+	shortenCmd.Flags().IntVar(&shortenMaxClicks, "max-clicks", 0, "number of clicks after which the short URL expires")
+	shortenCmd.Flags().BoolVar(&shortenDisabled, "disabled", false, "create the short URL disabled")
+	shortenCmd.Flags().StringVar(&shortenPassphrase, "passphrase", "", "passphrase required to follow the short URL")
+	shortenCmd.Flags().StringVar(&shortenQR, "qr", "", "save a QR code for the short URL to `FILE`, as SVG if it ends in .svg and PNG otherwise")
+	shortenCmd.Flags().IntVar(&shortenQRSize, "qr-size", 512, "size of the QR code in pixels")
 }
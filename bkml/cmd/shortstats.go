@@ -0,0 +1,69 @@
+/*
+Copyright © 2022 Brian Ketelsen<mail@bjk.fyi>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"encore.app/bkml/client"
+)
+
+var shortstatsDays int
+
+// shortstatsCmd represents the shortstats command
+var shortstatsCmd = &cobra.Command{
+	Use:   "shortstats ID",
+	Short: "Show click statistics for a shortened URL",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		stats, err := backend.Url.GetStats(cmd.Context(), args[0], client.UrlStatsParams{
+			Days: shortstatsDays,
+		})
+		cobra.CheckErr(err)
+		fmt.Printf("Total clicks: %d\n\n", stats.Total)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "DATE\tCLICKS")
+		for _, d := range stats.Daily {
+			fmt.Fprintf(w, "%s\t%d\n", d.Date, d.Clicks)
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "REFERRER\tCLICKS")
+		for _, r := range stats.TopReferrers {
+			referrer := r.Referrer
+			if referrer == "" {
+				referrer = "(direct)"
+			}
+			fmt.Fprintf(w, "%s\t%d\n", referrer, r.Clicks)
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(shortstatsCmd)
+	shortstatsCmd.Flags().IntVar(&shortstatsDays, "days", 30, "number of days to show daily clicks for, at most 365")
+}
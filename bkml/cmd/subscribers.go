@@ -0,0 +1,262 @@
+/*
+Copyright © 2022 Brian Ketelsen<mail@bjk.fyi>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"encore.app/bkml/client"
+)
+
+// subscribersPageSize is the number of subscribers fetched or imported per request.
+const subscribersPageSize = 500
+
+// subscribersCmd represents the subscribers command
+var subscribersCmd = &cobra.Command{
+	Use:   "subscribers",
+	Short: "Manage newsletter subscribers",
+}
+
+func init() {
+	var query string
+	var all bool
+
+	// subscribersLsCmd represents the subscribers ls command
+	var subscribersLsCmd = &cobra.Command{
+		Use:   "ls",
+		Short: "List and search newsletter subscribers",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "EMAIL\tNAME\tSTATUS\tSINCE\tSOURCE\tUNSUBSCRIBES")
+			err := eachSubscriber(cmd, query, all, func(s client.EmailSubscriber) error {
+				_, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\n", s.Email, s.Name, subscriberStatus(s),
+					s.OptInChanged.Format("2006-01-02"), s.OptInSource, len(s.Unsubscribes))
+				return err
+			})
+			cobra.CheckErr(err)
+			return w.Flush()
+		},
+	}
+	subscribersLsCmd.Flags().StringVarP(&query, "query", "q", "", "Only show subscribers whose email or name contains this")
+	subscribersLsCmd.Flags().BoolVarP(&all, "all", "a", false, "Include unsubscribed and pending subscribers")
+	subscribersCmd.AddCommand(subscribersLsCmd)
+
+	var name string
+
+	// subscribersAddCmd represents the subscribers add command
+	var subscribersAddCmd = &cobra.Command{
+		Use:   "add EMAIL",
+		Short: "Subscribe an address without requiring confirmation",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := backend.Email.AddSubscriber(cmd.Context(), client.EmailAddSubscriberParams{
+				Email: args[0],
+				Name:  name,
+			})
+			cobra.CheckErr(err)
+			return nil
+		},
+	}
+	subscribersAddCmd.Flags().StringVar(&name, "name", "", "Name of the subscriber")
+	subscribersCmd.AddCommand(subscribersAddCmd)
+
+	// subscribersRmCmd represents the subscribers rm command
+	var subscribersRmCmd = &cobra.Command{
+		Use:   "rm EMAIL...",
+		Short: "Permanently remove subscribers and their history",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, email := range args {
+				cobra.CheckErr(backend.Email.RemoveSubscriber(cmd.Context(), email))
+			}
+			return nil
+		},
+	}
+	subscribersCmd.AddCommand(subscribersRmCmd)
+
+	var exportAll bool
+
+	// subscribersExportCmd represents the subscribers export command
+	var subscribersExportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "Export subscribers as CSV to stdout",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w := csv.NewWriter(os.Stdout)
+			cobra.CheckErr(w.Write([]string{"email", "name", "optin", "optin_changed", "optin_source", "pending", "unsubscribes"}))
+			err := eachSubscriber(cmd, "", exportAll, func(s client.EmailSubscriber) error {
+				unsubs := make([]string, len(s.Unsubscribes))
+				for i, t := range s.Unsubscribes {
+					unsubs[i] = t.Format(time.RFC3339)
+				}
+				return w.Write([]string{
+					s.Email,
+					s.Name,
+					strconv.FormatBool(s.OptIn),
+					s.OptInChanged.Format(time.RFC3339),
+					s.OptInSource,
+					strconv.FormatBool(s.Pending),
+					strings.Join(unsubs, ";"),
+				})
+			})
+			cobra.CheckErr(err)
+			w.Flush()
+			return w.Error()
+		},
+	}
+	subscribersExportCmd.Flags().BoolVarP(&exportAll, "all", "a", false, "Include unsubscribed and pending subscribers")
+	subscribersCmd.AddCommand(subscribersExportCmd)
+
+	var source string
+
+	// subscribersImportCmd represents the subscribers import command
+	var subscribersImportCmd = &cobra.Command{
+		Use:   "import FILE",
+		Short: "Import opted-in subscribers from a CSV file",
+		Long: `Import opted-in subscribers from a CSV file.
+
+The file must start with a header row containing an "email" column.
+The optional "name" and "optin_changed" (RFC 3339) columns are used if present.
+Addresses that are already known are skipped.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := os.Open(args[0])
+			cobra.CheckErr(err)
+			defer f.Close()
+			subs, err := readSubscribersCSV(f)
+			cobra.CheckErr(err)
+
+			imported := 0
+			for len(subs) > 0 {
+				n := len(subs)
+				if n > subscribersPageSize {
+					n = subscribersPageSize
+				}
+				resp, err := backend.Email.ImportSubscribers(cmd.Context(), client.EmailImportSubscribersParams{
+					Source:      source,
+					Subscribers: subs[:n],
+				})
+				cobra.CheckErr(err)
+				imported += resp.NumImported
+				subs = subs[n:]
+			}
+			fmt.Printf("Imported %d new subscribers\n", imported)
+			return nil
+		},
+	}
+	subscribersImportCmd.Flags().StringVar(&source, "source", "import", "Where the subscribers opted in")
+	subscribersCmd.AddCommand(subscribersImportCmd)
+
+	rootCmd.AddCommand(subscribersCmd)
+}
+
+// eachSubscriber calls fn for each subscriber matching query, fetching them a page at a time.
+func eachSubscriber(cmd *cobra.Command, query string, all bool, fn func(client.EmailSubscriber) error) error {
+	for offset := 0; ; offset += subscribersPageSize {
+		resp, err := backend.Email.ListSubscribers(cmd.Context(), client.EmailListSubscribersParams{
+			Query:  query,
+			All:    all,
+			Limit:  subscribersPageSize,
+			Offset: offset,
+		})
+		if err != nil {
+			return err
+		}
+		for _, s := range resp.Subscribers {
+			if err := fn(s); err != nil {
+				return err
+			}
+		}
+		if len(resp.Subscribers) < subscribersPageSize {
+			return nil
+		}
+	}
+}
+
+// subscriberStatus describes the subscription status of s.
+func subscriberStatus(s client.EmailSubscriber) string {
+	switch {
+	case s.OptIn:
+		return "subscribed"
+	case s.Pending:
+		return "pending"
+	default:
+		return "unsubscribed"
+	}
+}
+
+// readSubscribersCSV reads subscribers to import from CSV data with a header row.
+func readSubscribersCSV(r io.Reader) ([]client.EmailImportSubscriber, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %v", err)
+	}
+	cols := make(map[string]int)
+	for i, h := range header {
+		cols[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	if _, ok := cols["email"]; !ok {
+		return nil, fmt.Errorf(`missing "email" column`)
+	}
+	field := func(rec []string, name string) string {
+		if i, ok := cols[name]; ok && i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+
+	var subs []client.EmailImportSubscriber
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return subs, nil
+		} else if err != nil {
+			return nil, err
+		}
+		s := client.EmailImportSubscriber{
+			Email: field(rec, "email"),
+			Name:  field(rec, "name"),
+		}
+		if s.Email == "" {
+			continue
+		}
+		if v := field(rec, "optin_changed"); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid optin_changed: %v", line, err)
+			}
+			s.OptInAt = &t
+		}
+		subs = append(subs, s)
+	}
+}
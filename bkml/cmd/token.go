@@ -0,0 +1,114 @@
+/*
+Copyright © 2022 Brian Ketelsen<mail@bjk.fyi>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"encore.app/bkml/client"
+)
+
+func init() {
+	var (
+		bookmarklet bool
+		site        string
+	)
+
+	tokenCmd := &cobra.Command{
+		Use:   "token",
+		Short: "Manage per-device API tokens",
+	}
+
+	createCmd := &cobra.Command{
+		Use:   "create NAME",
+		Short: "Create an API token for a device, like a phone or a browser",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			resp, err := backend.Blog.CreateToken(cmd.Context(), client.BlogCreateTokenParams{Name: args[0]})
+			cobra.CheckErr(err)
+			fmt.Printf("Created token %d for %s. It won't be shown again:\n%s\n", resp.ID, resp.Name, resp.Token)
+			fmt.Printf("\nOpen this link on the device to set it up for sharing bytes:\n%s/share#token=%s\n", site, resp.Token)
+			if bookmarklet {
+				fmt.Printf("\nBookmarklet:\n%s\n", shareBookmarklet(site))
+			}
+			return nil
+		},
+	}
+	createCmd.Flags().BoolVar(&bookmarklet, "bookmarklet", false, "also print a bookmarklet that shares the current page as a byte")
+	createCmd.Flags().StringVar(&site, "site", "https://brian.dev", "base URL of the site with the share page")
+
+	lsCmd := &cobra.Command{
+		Use:   "ls",
+		Short: "List API tokens",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			resp, err := backend.Blog.ListTokens(cmd.Context())
+			cobra.CheckErr(err)
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tNAME\tCREATED\tLAST USED")
+			for _, t := range resp.Tokens {
+				lastUsed := "never"
+				if t.LastUsed != nil {
+					lastUsed = t.LastUsed.Format("2006-01-02 15:04")
+				}
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", t.ID, t.Name, t.Created.Format("2006-01-02"), lastUsed)
+			}
+			return w.Flush()
+		},
+	}
+
+	rmCmd := &cobra.Command{
+		Use:   "rm ID...",
+		Short: "Revoke API tokens",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, arg := range args {
+				id, err := strconv.ParseInt(arg, 10, 64)
+				cobra.CheckErr(err)
+				cobra.CheckErr(backend.Blog.RevokeToken(cmd.Context(), id))
+			}
+			return nil
+		},
+	}
+
+	tokenCmd.AddCommand(createCmd)
+	tokenCmd.AddCommand(lsCmd)
+	tokenCmd.AddCommand(rmCmd)
+	rootCmd.AddCommand(tokenCmd)
+}
+
+// shareBookmarklet returns a bookmarklet that shares the current page,
+// with any selected text as the summary, by opening the share page of the site
+// in a new tab, where it is published once confirmed. The share page adds the
+// token stored on the device, so the token never ends up in the bookmarklet
+// or the pages it runs in.
+func shareBookmarklet(site string) string {
+	js := `(function(){var q=new URLSearchParams({url:location.href,title:document.title,text:String(getSelection())});` +
+		`window.open('` + site + `/share?'+q.toString(),'_blank');})()`
+	return "javascript:" + strings.ReplaceAll(js, " ", "%20")
+}
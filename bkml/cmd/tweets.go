@@ -0,0 +1,89 @@
+/*
+Copyright © 2022 Brian Ketelsen<mail@bjk.fyi>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"encore.app/bkml/client"
+)
+
+// tweetsCmd represents the tweets command
+var tweetsCmd = &cobra.Command{
+	Use:   "tweets",
+	Short: "Inspect promotional tweets",
+}
+
+func init() {
+	var source string
+	var limit int
+
+	// tweetsStatsCmd represents the tweets stats command
+	var tweetsStatsCmd = &cobra.Command{
+		Use:   "stats",
+		Short: "Rank promoted bytes and posts by tweet engagement",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			resp, err := backend.Twitter.Stats(cmd.Context(), client.TwitterStatsParams{
+				Source: source,
+				Limit:  limit,
+			})
+			cobra.CheckErr(err)
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "RANK\tSOURCE\tTITLE\tTWEETS\tLIKES\tREPOSTS\tREPLIES\tIMPRESSIONS")
+			for i, s := range resp.Stats {
+				fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%d\t%d\t%d\t%d\n", i+1, s.Source, sourceTitle(cmd, s.Source, s.SourceID),
+					s.Tweets, s.Likes, s.Reposts, s.Replies, s.Impressions)
+			}
+			return w.Flush()
+		},
+	}
+
+	tweetsStatsCmd.Flags().StringVar(&source, "source", "", "Only show this kind of content ('byte', 'post')")
+	tweetsStatsCmd.Flags().IntVar(&limit, "limit", 20, "Maximum number of results")
+	tweetsCmd.AddCommand(tweetsStatsCmd)
+	rootCmd.AddCommand(tweetsCmd)
+}
+
+// sourceTitle looks up a human readable title for promoted content,
+// falling back to its id if it can't be found.
+func sourceTitle(cmd *cobra.Command, source, id string) string {
+	switch source {
+	case "byte":
+		if n, err := strconv.ParseInt(id, 10, 64); err == nil {
+			if b, err := backend.Bytes.Get(cmd.Context(), n); err == nil {
+				return b.Title
+			}
+		}
+	case "post":
+		if p, err := backend.Blog.GetBlogPost(cmd.Context(), id); err == nil {
+			return p.Title
+		}
+	}
+	return id
+}
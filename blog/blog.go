@@ -2,6 +2,7 @@ package blog
 
 import (
 	"context"
+	"crypto/subtle"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -85,6 +86,9 @@ type BlogPostFull struct {
 type GetBlogPostsParams struct {
 	Limit  int `json:"limit,omitempty"`
 	Offset int `json:"offset,omitempty"`
+
+	// Since lists only posts published at or after it, if set.
+	Since time.Time `json:"since,omitempty"`
 }
 
 type GetBlogPostsResponse struct {
@@ -216,7 +220,7 @@ func CreateBlogPost(ctx context.Context, params *CreateBlogPostParams) error {
 */
 
 // GetBlogPosts retrieves a list of blog posts with
-// optional limit and offset.
+// optional limit, offset and publication time.
 //encore:api public method=GET path=/blog
 func GetBlogPosts(ctx context.Context, params *GetBlogPostsParams) (*GetBlogPostsResponse, error) {
 	rows, err := sqldb.Query(ctx, `
@@ -251,10 +255,11 @@ func GetBlogPosts(ctx context.Context, params *GetBlogPostsParams) (*GetBlogPost
 		primary_tag,
 		url
 		FROM "article"
+		WHERE ($3::timestamptz IS NULL OR published_at >= $3)
 		ORDER BY published_at DESC
 		LIMIT $1
 		OFFSET $2
-	`, params.Limit, params.Offset)
+	`, params.Limit, params.Offset, optionalTime(params.Since))
 	if err != nil {
 		return &GetBlogPostsResponse{
 			Count:     0,
@@ -330,14 +335,17 @@ func GetBlogPosts(ctx context.Context, params *GetBlogPostsParams) (*GetBlogPost
 	}, rows.Err()
 }
 
+// AuthHandler authenticates requests with the password.
+// API tokens aren't accepted here, since they would grant access to
+// every endpoint; only bytes.Share accepts them.
 //encore:authhandler
 func AuthHandler(ctx context.Context, token string) (auth.UID, error) {
-	eb := errs.B().Meta("auth", token)
+	eb := errs.B()
 
-	if token != secrets.AuthPassword {
+	if secrets.AuthPassword == "" || subtle.ConstantTimeCompare([]byte(token), []byte(secrets.AuthPassword)) != 1 {
 		return "", eb.Code(errs.Unauthenticated).Msg("authentication failure").Err()
 	}
-	return "", nil
+	return "admin", nil
 }
 
 // Post receives incoming post CRUD webhooks from ghost.
@@ -592,3 +600,11 @@ type PostHookPayload struct {
 		} `json:"previous"`
 	} `json:"post"`
 }
+
+// optionalTime returns t as a query argument, or nil if t is zero.
+func optionalTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
@@ -0,0 +1,9 @@
+-- api_token holds long-lived API tokens, one per device.
+-- Only a hash of each token is stored; the token itself is shown once when created.
+CREATE TABLE "api_token" (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMP WITH TIME ZONE NULL
+);
@@ -1,6 +1,14 @@
 package blog
 
-/*
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"encore.app/social/twitter"
+	"encore.dev/beta/errs"
+)
+
 type ScheduleType string
 
 const (
@@ -15,7 +23,8 @@ type PromoteParams struct {
 	Schedule ScheduleType
 }
 
-// Promote schedules the promotion a blog post.
+// Promote schedules the promotion of a blog post on Twitter.
+// Emailing it to subscribers is done by email.PromotePost.
 //encore:api auth method=POST path=/blog/:slug/promote
 func Promote(ctx context.Context, slug string, p *PromoteParams) error {
 	eb := errs.B().Meta("slug", slug)
@@ -23,43 +32,20 @@ func Promote(ctx context.Context, slug string, p *PromoteParams) error {
 	if err != nil {
 		return eb.Cause(err).Msg("unable to get blog post").Err()
 	}
-
-	// Generate a short URL for the blog post
-	short, err := url.Shorten(ctx, &url.ShortenParams{
-		URL: "/blog/" + slug, // TODO
-	})
-	if err != nil {
-		return eb.Cause(err).Msg("unable to generate short url").Err()
-	}
-
-	// Create a template for the email
-	err = email.CreateTemplate(ctx, slug, &email.CreateTemplateParams{
-		Sender:   "Brian Ketelsen <me@brian.dev>", // TODO
-		Subject:  post.Title,
-		BodyText: post.Body,
-		BodyHTML: post.BodyRendered,
-	})
-	if err != nil {
-		return eb.Cause(err).Msg("unable to create email template").Err()
-	}
-
-	// Schedule emails
-	sendAt := time.Now() // TODO factor in p.Schedule
-	_, err = email.ScheduleAll(ctx, &email.ScheduleAllParams{
-		TemplateID: slug,
-		SendAt:     &sendAt,
-	})
-	if err != nil {
-		return eb.Cause(err).Msg("unable to get email subscribers").Err()
+	summary := post.CustomExcerpt
+	if summary == "" {
+		summary = post.Excerpt
 	}
 
 	// Schedule twitter
 	_, err = twitter.Schedule(ctx, &twitter.ScheduleParams{
-		SendAt: sendAt,
+		SendAt: time.Now(), // TODO factor in p.Schedule
 		Tweet: &twitter.TweetParams{
 			// TODO very placeholder tweet text
-			Text: fmt.Sprintf("%s\n\n%s", post.Summary, short.ShortURL),
+			Text: fmt.Sprintf("%s - %s\n\n%s", post.Title, summary, post.URL),
 		},
+		Source:   "post",
+		SourceID: slug,
 	})
 	if err != nil {
 		return eb.Cause(err).Msg("unable to schedule twitter post").Err()
@@ -67,4 +53,3 @@ func Promote(ctx context.Context, slug string, p *PromoteParams) error {
 
 	return nil
 }
-*/
@@ -0,0 +1,163 @@
+package blog
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"encore.dev/beta/errs"
+	"encore.dev/storage/sqldb"
+)
+
+// tokenPrefix starts every API token, making them easy to recognize,
+// for example by secret scanners.
+const tokenPrefix = "bkt_"
+
+type APIToken struct {
+	ID       int64      `json:"id"`
+	Name     string     `json:"name"` // the device the token is used on
+	Created  time.Time  `json:"created"`
+	LastUsed *time.Time `json:"last_used,omitempty"`
+}
+
+type CreateTokenParams struct {
+	// Name is the device the token is for, like "phone".
+	Name string `json:"name"`
+}
+
+type CreateTokenResponse struct {
+	ID      int64     `json:"id"`
+	Name    string    `json:"name"`
+	Created time.Time `json:"created"`
+
+	// Token is the API token. It is only ever returned here.
+	Token string `json:"token"`
+}
+
+// CreateToken creates a long-lived API token for a device.
+//encore:api auth method=POST path=/tokens
+func CreateToken(ctx context.Context, p *CreateTokenParams) (*CreateTokenResponse, error) {
+	name := strings.TrimSpace(p.Name)
+	if name == "" {
+		return nil, errs.B().Code(errs.InvalidArgument).Msg("name is required").Err()
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+	resp := &CreateTokenResponse{Name: name, Token: token}
+	err = sqldb.QueryRow(ctx, `
+		INSERT INTO "api_token" (name, token_hash)
+		VALUES ($1, $2)
+		RETURNING id, created_at
+	`, name, hashToken(token)).Scan(&resp.ID, &resp.Created)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+type ListTokensResponse struct {
+	Tokens []*APIToken `json:"tokens"`
+}
+
+// ListTokens lists the API tokens.
+//encore:api auth method=GET path=/tokens
+func ListTokens(ctx context.Context) (*ListTokensResponse, error) {
+	rows, err := sqldb.Query(ctx, `
+		SELECT id, name, created_at, last_used_at
+		FROM "api_token"
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	resp := &ListTokensResponse{Tokens: []*APIToken{}}
+	for rows.Next() {
+		var t APIToken
+		if err := rows.Scan(&t.ID, &t.Name, &t.Created, &t.LastUsed); err != nil {
+			return nil, err
+		}
+		resp.Tokens = append(resp.Tokens, &t)
+	}
+	return resp, rows.Err()
+}
+
+// RevokeToken revokes an API token, for example when a device is lost.
+//encore:api auth method=DELETE path=/tokens/:id
+func RevokeToken(ctx context.Context, id int64) error {
+	res, err := sqldb.Exec(ctx, `DELETE FROM "api_token" WHERE id = $1`, id)
+	if err != nil {
+		return err
+	} else if res.RowsAffected() == 0 {
+		return errs.B().Code(errs.NotFound).Meta("id", id).Msg("token not found").Err()
+	}
+	return nil
+}
+
+type VerifyTokenParams struct {
+	Token string `json:"token"`
+}
+
+type VerifyTokenResponse struct {
+	TokenID int64  `json:"token_id"`
+	Device  string `json:"device"` // name of the token
+}
+
+// VerifyToken verifies an API token, returning the device it is for.
+// The auth handler only accepts the password, so endpoints that accept
+// API tokens, like bytes.Share, verify them with this instead.
+//encore:api private
+func VerifyToken(ctx context.Context, p *VerifyTokenParams) (*VerifyTokenResponse, error) {
+	data, err := lookupToken(ctx, p.Token)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, errs.B().Code(errs.Unauthenticated).Msg("invalid token").Err()
+	} else if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// lookupToken looks up an API token, recording that it was used.
+// It returns sqldb.ErrNoRows if there is no such token.
+func lookupToken(ctx context.Context, token string) (*VerifyTokenResponse, error) {
+	if !strings.HasPrefix(token, tokenPrefix) {
+		return nil, sqldb.ErrNoRows
+	}
+	var data VerifyTokenResponse
+	err := sqldb.QueryRow(ctx, `
+		UPDATE "api_token"
+		SET last_used_at = NOW()
+		WHERE token_hash = $1
+		RETURNING id, name
+	`, hashToken(token)).Scan(&data.TokenID, &data.Device)
+	if err != nil {
+		return nil, err
+	}
+	return &data, nil
+}
+
+// generateToken generates a random API token.
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return tokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken hashes an API token for storage. Tokens are random enough
+// that a plain hash can't be reversed, unlike the hash of a password,
+// and it lets tokens be looked up by their hash.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
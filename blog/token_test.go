@@ -0,0 +1,60 @@
+package blog
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+)
+
+func TestGenerateToken(t *testing.T) {
+	c := qt.New(t)
+	a, err := generateToken()
+	c.Assert(err, qt.IsNil)
+	b, err := generateToken()
+	c.Assert(err, qt.IsNil)
+	c.Check(strings.HasPrefix(a, tokenPrefix), qt.IsTrue)
+	c.Check(a, qt.HasLen, len(tokenPrefix)+43)
+	c.Check(a, qt.Not(qt.Equals), b)
+	c.Check(hashToken(a), qt.Not(qt.Equals), hashToken(b))
+	c.Check(hashToken(a), qt.HasLen, 64)
+}
+
+func TestTokens(t *testing.T) {
+	c := qt.New(t)
+	ctx := auth.WithContext(context.Background(), "admin", nil)
+
+	_, err := CreateToken(ctx, &CreateTokenParams{Name: " "})
+	c.Check(errs.Code(err), qt.Equals, errs.InvalidArgument)
+
+	token, err := CreateToken(ctx, &CreateTokenParams{Name: "phone"})
+	c.Assert(err, qt.IsNil)
+	c.Check(token.Name, qt.Equals, "phone")
+
+	// API tokens are only accepted where they are verified explicitly.
+	_, err = AuthHandler(ctx, token.Token)
+	c.Check(errs.Code(err), qt.Equals, errs.Unauthenticated)
+	data, err := VerifyToken(ctx, &VerifyTokenParams{Token: token.Token})
+	c.Assert(err, qt.IsNil)
+	c.Check(data, qt.DeepEquals, &VerifyTokenResponse{TokenID: token.ID, Device: "phone"})
+
+	list, err := ListTokens(ctx)
+	c.Assert(err, qt.IsNil)
+	var found *APIToken
+	for _, tok := range list.Tokens {
+		if tok.ID == token.ID {
+			found = tok
+		}
+	}
+	c.Assert(found, qt.Not(qt.IsNil))
+	c.Check(found.LastUsed, qt.Not(qt.IsNil))
+
+	c.Assert(RevokeToken(ctx, token.ID), qt.IsNil)
+	_, err = VerifyToken(ctx, &VerifyTokenParams{Token: token.Token})
+	c.Check(errs.Code(err), qt.Equals, errs.Unauthenticated)
+	c.Check(errs.Code(RevokeToken(ctx, token.ID)), qt.Equals, errs.NotFound)
+}
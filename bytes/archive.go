@@ -0,0 +1,108 @@
+package bytes
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"encore.dev/beta/errs"
+	"encore.dev/storage/sqldb"
+)
+
+type ArchiveParams struct {
+	Year  int `json:"year,omitempty"`
+	Month int `json:"month,omitempty"` // 1-12, or 0 for the whole year
+
+	// Tag lists only bytes with the blog tag with this slug.
+	Tag string `json:"tag,omitempty"`
+}
+
+type ArchiveResponse struct {
+	Year  int    `json:"year"`
+	Month int    `json:"month,omitempty"`
+	Bytes []Byte `json:"bytes"`
+}
+
+// Archive lists the bytes published in a month or year, newest first.
+// It isn't under /bytes since a fixed path there would conflict with Get.
+//encore:api public method=GET path=/archive/bytes
+func Archive(ctx context.Context, p *ArchiveParams) (*ArchiveResponse, error) {
+	eb := errs.B().Meta("year", p.Year, "month", p.Month)
+	from, to, err := archivePeriod(p.Year, p.Month)
+	if err != nil {
+		return nil, eb.Code(errs.InvalidArgument).Msg(err.Error()).Err()
+	}
+
+	bytes, err := queryBytes(ctx, `
+		WHERE created_at >= $1 AND created_at < $2
+		AND ($3 = '' OR EXISTS (SELECT 1 FROM byte_tag t WHERE t.byte_id = b.id AND t.tag = $3))
+		ORDER BY created_at DESC, id DESC
+	`, from, to, p.Tag)
+	if err != nil {
+		return nil, eb.Cause(err).Err()
+	}
+	if bytes == nil {
+		bytes = []Byte{}
+	}
+	return &ArchiveResponse{Year: p.Year, Month: p.Month, Bytes: bytes}, nil
+}
+
+// archivePeriod returns the start and end, in UTC, of the month of the year,
+// or the whole year if month is 0.
+func archivePeriod(year, month int) (from, to time.Time, err error) {
+	switch {
+	case year < 1 || year > 9999:
+		return from, to, errors.New("year must be between 1 and 9999")
+	case month < 0 || month > 12:
+		return from, to, errors.New("month must be between 1 and 12")
+	case month == 0:
+		from = time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+		return from, from.AddDate(1, 0, 0), nil
+	default:
+		from = time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+		return from, from.AddDate(0, 1, 0), nil
+	}
+}
+
+type ArchiveCountsParams struct {
+	// Tag counts only bytes with the blog tag with this slug.
+	Tag string `json:"tag,omitempty"`
+}
+
+type MonthCount struct {
+	Year  int `json:"year"`
+	Month int `json:"month"` // 1-12
+	Count int `json:"count"`
+}
+
+type ArchiveCountsResponse struct {
+	// Months are the months with any bytes published, newest first.
+	Months []*MonthCount `json:"months"`
+}
+
+// ArchiveCounts counts the bytes published per month, so the
+// archive can be rendered without fetching every byte.
+//encore:api public method=GET path=/archive/bytes/counts
+func ArchiveCounts(ctx context.Context, p *ArchiveCountsParams) (*ArchiveCountsResponse, error) {
+	rows, err := sqldb.Query(ctx, `
+		SELECT EXTRACT(YEAR FROM created_at)::int AS year, EXTRACT(MONTH FROM created_at)::int AS month, COUNT(*)
+		FROM "byte" b
+		WHERE $1 = '' OR EXISTS (SELECT 1 FROM byte_tag t WHERE t.byte_id = b.id AND t.tag = $1)
+		GROUP BY year, month
+		ORDER BY year DESC, month DESC
+	`, p.Tag)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	resp := &ArchiveCountsResponse{Months: []*MonthCount{}}
+	for rows.Next() {
+		var m MonthCount
+		if err := rows.Scan(&m.Year, &m.Month, &m.Count); err != nil {
+			return nil, err
+		}
+		resp.Months = append(resp.Months, &m)
+	}
+	return resp, rows.Err()
+}
@@ -0,0 +1,71 @@
+package bytes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"encore.dev/beta/auth"
+	"encore.dev/storage/sqldb"
+)
+
+func TestArchivePeriod(t *testing.T) {
+	c := qt.New(t)
+	from, to, err := archivePeriod(2022, 12)
+	c.Assert(err, qt.IsNil)
+	c.Check(from, qt.Equals, time.Date(2022, time.December, 1, 0, 0, 0, 0, time.UTC))
+	c.Check(to, qt.Equals, time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	from, to, err = archivePeriod(2022, 0)
+	c.Assert(err, qt.IsNil)
+	c.Check(from, qt.Equals, time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC))
+	c.Check(to, qt.Equals, time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	for _, p := range [][2]int{{0, 1}, {10000, 1}, {2022, -1}, {2022, 13}} {
+		_, _, err := archivePeriod(p[0], p[1])
+		c.Check(err, qt.Not(qt.IsNil), qt.Commentf("%v", p))
+	}
+}
+
+func TestArchive(t *testing.T) {
+	c := qt.New(t)
+	ctx := auth.WithContext(context.Background(), "dummy", nil)
+
+	// Publish bytes in a month long ago, so no other bytes are in it.
+	publish := func(url string, created time.Time) int64 {
+		resp, err := Publish(ctx, &PublishParams{Title: url, URL: url})
+		c.Assert(err, qt.IsNil)
+		_, err = sqldb.Exec(ctx, `UPDATE "byte" SET created_at = $2 WHERE id = $1`, resp.ID, created)
+		c.Assert(err, qt.IsNil)
+		return resp.ID
+	}
+	first := publish("https://example.org/archive-1", time.Date(1999, time.May, 3, 12, 0, 0, 0, time.UTC))
+	second := publish("https://example.org/archive-2", time.Date(1999, time.May, 31, 23, 0, 0, 0, time.UTC))
+	publish("https://example.org/archive-3", time.Date(1999, time.June, 1, 0, 0, 0, 0, time.UTC))
+
+	resp, err := Archive(ctx, &ArchiveParams{Year: 1999, Month: 5})
+	c.Assert(err, qt.IsNil)
+	c.Assert(resp.Bytes, qt.HasLen, 2)
+	c.Check(resp.Bytes[0].ID, qt.Equals, second)
+	c.Check(resp.Bytes[1].ID, qt.Equals, first)
+
+	resp, err = Archive(ctx, &ArchiveParams{Year: 1999})
+	c.Assert(err, qt.IsNil)
+	c.Check(resp.Bytes, qt.HasLen, 3)
+
+	resp, err = Archive(ctx, &ArchiveParams{Year: 1998})
+	c.Assert(err, qt.IsNil)
+	c.Check(resp.Bytes, qt.HasLen, 0)
+
+	counts, err := ArchiveCounts(ctx, &ArchiveCountsParams{})
+	c.Assert(err, qt.IsNil)
+	var months []MonthCount
+	for _, m := range counts.Months {
+		if m.Year == 1999 {
+			months = append(months, *m)
+		}
+	}
+	c.Check(months, qt.DeepEquals, []MonthCount{{1999, 6, 1}, {1999, 5, 2}})
+}
@@ -5,7 +5,9 @@ import (
 	"context"
 	"time"
 
+	"encore.app/linkcheck"
 	"encore.dev/beta/errs"
+	"encore.dev/rlog"
 	"encore.dev/storage/sqldb"
 )
 
@@ -13,29 +15,107 @@ type PublishParams struct {
 	Title   string `json:"title,omitempty"`
 	Summary string `json:"summary,omitempty"`
 	URL     string `json:"url,omitempty"`
+
+	ImageURL     string `json:"image_url,omitempty"`     // image shown on the byte's card
+	SiteName     string `json:"site_name,omitempty"`     // name of the site the URL is on
+	CanonicalURL string `json:"canonical_url,omitempty"` // canonical URL of the linked page
+
+	// Unfurl fetches the page at URL and fills in any of the fields
+	// above that are empty from its Open Graph metadata.
+	Unfurl bool `json:"unfurl,omitempty"`
+
+	// Tags are the slugs of blog tags to tag the byte with.
+	Tags []string `json:"tags,omitempty"`
 }
 
 type PublishResponse struct {
 	ID int64 `json:"id,omitempty"`
 }
 
-// Publish publishes a byte.
+// Publish publishes a byte. Publishing a URL that has already been
+// published updates its byte with the non-empty values and adds the tags.
 //encore:api auth method=POST path=/bytes
 func Publish(ctx context.Context, p *PublishParams) (*PublishResponse, error) {
+	if p.Unfurl {
+		eb := errs.B().Meta("url", p.URL)
+		md, err := unfurl(ctx, p.URL)
+		if err != nil {
+			// The metadata is only required if there is no title.
+			if p.Title == "" {
+				return nil, eb.Cause(err).Code(errs.InvalidArgument).Msg("unable to fetch page metadata").Err()
+			}
+			rlog.Info("failed to unfurl byte url", "url", p.URL, "err", err)
+		} else {
+			applyMetadata(p, md)
+		}
+		if p.Title == "" {
+			return nil, eb.Code(errs.InvalidArgument).Msg("no title given or found on page").Err()
+		}
+	}
+
+	if err := checkTags(ctx, p.Tags); err != nil {
+		return nil, err
+	}
+
+	tx, err := sqldb.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() // committed explicitly on success
+
 	var id int64
-	err := sqldb.QueryRow(ctx, `
-		INSERT INTO byte (title, summary, url)
-		VALUES ($1, $2, $3)
-		ON CONFLICT (url) DO UPDATE
-		SET id = byte.id
+	err = tx.QueryRow(ctx, `
+		INSERT INTO byte (title, summary, url, image_url, site_name, canonical_url)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (url) DO UPDATE SET
+			title = COALESCE(NULLIF(EXCLUDED.title, ''), byte.title),
+			summary = COALESCE(NULLIF(EXCLUDED.summary, ''), byte.summary),
+			image_url = COALESCE(NULLIF(EXCLUDED.image_url, ''), byte.image_url),
+			site_name = COALESCE(NULLIF(EXCLUDED.site_name, ''), byte.site_name),
+			canonical_url = COALESCE(NULLIF(EXCLUDED.canonical_url, ''), byte.canonical_url)
 		RETURNING id
-	`, p.Title, p.Summary, p.URL).Scan(&id)
-	return &PublishResponse{ID: id}, err
+	`, p.Title, p.Summary, p.URL, p.ImageURL, p.SiteName, p.CanonicalURL).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO byte_tag (byte_id, tag)
+		SELECT $1, unnest($2::text[])
+		ON CONFLICT DO NOTHING
+	`, id, p.Tags)
+	if err != nil {
+		return nil, err
+	}
+	return &PublishResponse{ID: id}, tx.Commit()
+}
+
+// applyMetadata fills in the empty fields of p from the page metadata,
+// so explicitly given values take precedence.
+func applyMetadata(p *PublishParams, md *pageMetadata) {
+	fill := func(field *string, value string) {
+		if *field == "" {
+			*field = value
+		}
+	}
+	fill(&p.Title, md.Title)
+	fill(&p.Summary, md.Description)
+	fill(&p.ImageURL, md.ImageURL)
+	fill(&p.SiteName, md.SiteName)
+	fill(&p.CanonicalURL, md.CanonicalURL)
 }
 
 type ListParams struct {
 	Limit  int `json:"limit,omitempty"`
 	Offset int `json:"offset,omitempty"`
+
+	// Broken lists only bytes whose links were broken when last checked.
+	Broken bool `json:"broken,omitempty"`
+
+	// Tag lists only bytes with the blog tag with this slug.
+	Tag string `json:"tag,omitempty"`
+
+	// Since lists only bytes published at or after it, if set.
+	Since time.Time `json:"since,omitempty"`
 }
 
 type Byte struct {
@@ -44,6 +124,15 @@ type Byte struct {
 	Summary string    `json:"summary,omitempty"`
 	URL     string    `json:"url,omitempty"`
 	Created time.Time `json:"created,omitempty"`
+
+	ImageURL     string `json:"image_url,omitempty"`     // image shown on the byte's card
+	SiteName     string `json:"site_name,omitempty"`     // name of the site the URL is on
+	CanonicalURL string `json:"canonical_url,omitempty"` // canonical URL of the linked page
+
+	Tags []string `json:"tags"` // slugs of the byte's blog tags
+
+	// Link is the result of the latest check of URL, or nil if it hasn't been checked.
+	Link *linkcheck.Status `json:"link,omitempty"`
 }
 
 type ListResponse struct {
@@ -53,19 +142,18 @@ type ListResponse struct {
 // Get retrieves a byte.
 //encore:api public method=GET path=/bytes/:id
 func Get(ctx context.Context, id int64) (*Byte, error) {
-	var b Byte
-	err := sqldb.QueryRow(ctx, `
-		SELECT id, title, summary, url, created_at
-		FROM "byte"
+	b, err := scanByte(sqldb.QueryRow(ctx, `
+		SELECT `+byteColumns+`
+		FROM "byte" b
 		WHERE id = $1
-	`, id).Scan(&b.ID, &b.Title, &b.Summary, &b.URL, &b.Created)
+	`, id))
 	if err != nil {
 		return nil, &errs.Error{
 			Code:    errs.NotFound,
 			Message: "byte not found",
 		}
 	}
-	return &b, nil
+	return b, nil
 
 }
 
@@ -74,13 +162,53 @@ func Get(ctx context.Context, id int64) (*Byte, error) {
 func List(ctx context.Context, p *ListParams) (*ListResponse, error) {
 	offset := getOrDefault(p.Offset, 0)
 	limit := getOrDefault(p.Limit, 100)
-	rows, err := sqldb.Query(ctx, `
-		SELECT id, title, summary, url, created_at
-		FROM byte
+	bytes, err := queryBytes(ctx, `
+		WHERE (link_broken OR NOT $3)
+		AND ($4 = '' OR EXISTS (SELECT 1 FROM byte_tag t WHERE t.byte_id = b.id AND t.tag = $4))
+		AND ($5::timestamptz IS NULL OR created_at >= $5)
 		ORDER BY id desc
 		OFFSET $1
 		LIMIT $2
-	`, offset, limit)
+	`, offset, limit, p.Broken, p.Tag, optionalTime(p.Since))
+	if err != nil {
+		return nil, err
+	}
+	return &ListResponse{Bytes: bytes}, nil
+}
+
+// byteColumns are the columns of a byte scanned by scanByte,
+// for selecting from the "byte" table aliased as b.
+const byteColumns = `id, title, summary, url, created_at, image_url, site_name, canonical_url,
+			COALESCE((SELECT array_agg(t.tag ORDER BY t.tag) FROM byte_tag t WHERE t.byte_id = b.id), '{}'),
+			link_status, link_final_url, link_error, link_broken, link_checked_at`
+
+// scanner is a row that can be scanned, a *sqldb.Row or *sqldb.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanByte scans a row of byteColumns.
+func scanByte(row scanner) (*Byte, error) {
+	var (
+		b    Byte
+		link linkcheck.Columns
+	)
+	err := row.Scan(&b.ID, &b.Title, &b.Summary, &b.URL, &b.Created, &b.ImageURL, &b.SiteName, &b.CanonicalURL, &b.Tags,
+		&link.Status, &link.FinalURL, &link.Err, &link.Broken, &link.CheckedAt)
+	if err != nil {
+		return nil, err
+	}
+	b.Link = link.LinkStatus()
+	return &b, nil
+}
+
+// queryBytes queries the bytes selected by filter, the part of
+// the query after selecting from the "byte" table aliased as b.
+func queryBytes(ctx context.Context, filter string, args ...interface{}) ([]Byte, error) {
+	rows, err := sqldb.Query(ctx, `
+		SELECT `+byteColumns+`
+		FROM "byte" b
+	`+filter, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -88,13 +216,21 @@ func List(ctx context.Context, p *ListParams) (*ListResponse, error) {
 
 	var bytes []Byte
 	for rows.Next() {
-		var b Byte
-		if err := rows.Scan(&b.ID, &b.Title, &b.Summary, &b.URL, &b.Created); err != nil {
+		b, err := scanByte(rows)
+		if err != nil {
 			return nil, err
 		}
-		bytes = append(bytes, b)
+		bytes = append(bytes, *b)
+	}
+	return bytes, rows.Err()
+}
+
+// optionalTime returns t as a query argument, or nil if t is zero.
+func optionalTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
 	}
-	return &ListResponse{Bytes: bytes}, rows.Err()
+	return t
 }
 
 func getOrDefault(n, def int) int {
@@ -2,13 +2,19 @@ package bytes
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	qt "github.com/frankban/quicktest"
 	"github.com/google/go-cmp/cmp/cmpopts"
 
+	"encore.app/blog"
+	"encore.app/linkcheck"
 	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
 )
 
 func TestPublishAndList(t *testing.T) {
@@ -39,3 +45,169 @@ func TestPublishAndList(t *testing.T) {
 	}
 	c.Assert(found, qt.IsTrue)
 }
+
+func TestCheckLinks(t *testing.T) {
+	c := qt.New(t)
+	ctx := auth.WithContext(context.Background(), "dummy", nil)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/moved":
+			http.Redirect(w, req, "/ok", http.StatusMovedPermanently)
+		case "/ok":
+		default:
+			w.WriteHeader(http.StatusGone)
+		}
+	}))
+	c.Cleanup(srv.Close)
+
+	orig := newLinkChecker
+	c.Cleanup(func() { newLinkChecker = orig })
+	newLinkChecker = func() *linkcheck.Checker {
+		checker := linkcheck.New()
+		checker.Client = &http.Client{Timeout: time.Second}
+		checker.HostDelay = 0
+		return checker
+	}
+
+	publish := func(path string) int64 {
+		resp, err := Publish(ctx, &PublishParams{Title: path, URL: srv.URL + path})
+		c.Assert(err, qt.IsNil)
+		return resp.ID
+	}
+	moved, gone := publish("/moved"), publish("/gone")
+
+	resp, err := CheckLinks(ctx)
+	c.Assert(err, qt.IsNil)
+	c.Assert(resp.NumChecked >= 2, qt.IsTrue)
+
+	b, err := Get(ctx, moved)
+	c.Assert(err, qt.IsNil)
+	c.Assert(b.Link, qt.Not(qt.IsNil))
+	c.Check(b.Link.Status, qt.Equals, 200)
+	c.Check(b.Link.FinalURL, qt.Equals, srv.URL+"/ok")
+	c.Check(b.Link.Broken, qt.IsFalse)
+
+	b, err = Get(ctx, gone)
+	c.Assert(err, qt.IsNil)
+	c.Assert(b.Link, qt.Not(qt.IsNil))
+	c.Check(b.Link.Status, qt.Equals, 410)
+	c.Check(b.Link.Broken, qt.IsTrue)
+
+	// Only the broken link is listed as broken.
+	list, err := List(ctx, &ListParams{Broken: true})
+	c.Assert(err, qt.IsNil)
+	var ids []int64
+	for _, b := range list.Bytes {
+		c.Check(b.Link.Broken, qt.IsTrue)
+		ids = append(ids, b.ID)
+	}
+	c.Check(ids, qt.Contains, gone)
+	c.Check(ids, qt.Not(qt.Contains), moved)
+
+	// Recently checked links aren't checked again.
+	resp, err = CheckLinks(ctx)
+	c.Assert(err, qt.IsNil)
+	c.Check(resp.NumChecked, qt.Equals, 0)
+}
+
+func TestPublishUnfurl(t *testing.T) {
+	c := qt.New(t)
+	ctx := auth.WithContext(context.Background(), "dummy", nil)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/text" {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("plain text"))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><head>
+			<meta property="og:title" content="Fetched title">
+			<meta property="og:description" content="Fetched description">
+			<meta property="og:image" content="/card.png">
+			<meta property="og:site_name" content="Example">
+			<link rel="canonical" href="/canonical">
+		</head></html>`))
+	}))
+	c.Cleanup(srv.Close)
+
+	// Fetched values fill in what isn't given.
+	resp, err := Publish(ctx, &PublishParams{URL: srv.URL + "/page", Summary: "My summary", Unfurl: true})
+	c.Assert(err, qt.IsNil)
+	b, err := Get(ctx, resp.ID)
+	c.Assert(err, qt.IsNil)
+	c.Check(b.Title, qt.Equals, "Fetched title")
+	c.Check(b.Summary, qt.Equals, "My summary")
+	c.Check(b.ImageURL, qt.Equals, srv.URL+"/card.png")
+	c.Check(b.SiteName, qt.Equals, "Example")
+	c.Check(b.CanonicalURL, qt.Equals, srv.URL+"/canonical")
+
+	// Without a title the page must have one.
+	_, err = Publish(ctx, &PublishParams{URL: srv.URL + "/text", Unfurl: true})
+	c.Check(errs.Code(err), qt.Equals, errs.InvalidArgument)
+
+	// With a title failing to fetch metadata is fine.
+	resp, err = Publish(ctx, &PublishParams{URL: srv.URL + "/text", Title: "Given title", Unfurl: true})
+	c.Assert(err, qt.IsNil)
+	b, err = Get(ctx, resp.ID)
+	c.Assert(err, qt.IsNil)
+	c.Check(b.Title, qt.Equals, "Given title")
+	c.Check(b.ImageURL, qt.Equals, "")
+}
+
+func TestUpdateAndDelete(t *testing.T) {
+	c := qt.New(t)
+	ctx := auth.WithContext(context.Background(), "dummy", nil)
+
+	now := time.Now()
+	tag := &blog.Tag{Slug: fmt.Sprintf("bytes-test-%d", now.UnixNano()), Name: "Bytes test", CreatedAt: now, UpdatedAt: now}
+	c.Assert(blog.CreateTag(ctx, tag), qt.IsNil)
+
+	url := fmt.Sprintf("https://example.org/update-%d", now.UnixNano())
+	resp, err := Publish(ctx, &PublishParams{Title: "title", Summary: "summary", URL: url, Tags: []string{tag.Slug}})
+	c.Assert(err, qt.IsNil)
+	id := resp.ID
+
+	// Publishing the same url again updates the byte.
+	resp, err = Publish(ctx, &PublishParams{Title: "new title", URL: url})
+	c.Assert(err, qt.IsNil)
+	c.Assert(resp.ID, qt.Equals, id)
+	b, err := Get(ctx, id)
+	c.Assert(err, qt.IsNil)
+	c.Check(b.Title, qt.Equals, "new title")
+	c.Check(b.Summary, qt.Equals, "summary")
+	c.Check(b.Tags, qt.DeepEquals, []string{tag.Slug})
+
+	list, err := List(ctx, &ListParams{Tag: tag.Slug})
+	c.Assert(err, qt.IsNil)
+	c.Assert(list.Bytes, qt.HasLen, 1)
+	c.Check(list.Bytes[0].ID, qt.Equals, id)
+
+	_, err = Publish(ctx, &PublishParams{Title: "title", URL: url, Tags: []string{"no-such-tag"}})
+	c.Check(errs.Code(err), qt.Equals, errs.InvalidArgument)
+
+	summary, noTags := "edited", []string{}
+	b, err = Update(ctx, id, &UpdateParams{Summary: &summary, Tags: &noTags})
+	c.Assert(err, qt.IsNil)
+	c.Check(b.Title, qt.Equals, "new title")
+	c.Check(b.Summary, qt.Equals, "edited")
+	c.Check(b.Tags, qt.HasLen, 0)
+
+	empty := ""
+	_, err = Update(ctx, id, &UpdateParams{Title: &empty})
+	c.Check(errs.Code(err), qt.Equals, errs.InvalidArgument)
+
+	// Urls must stay unique.
+	other, err := Publish(ctx, &PublishParams{Title: "other", URL: url + "/other"})
+	c.Assert(err, qt.IsNil)
+	_, err = Update(ctx, other.ID, &UpdateParams{URL: &url})
+	c.Check(errs.Code(err), qt.Equals, errs.AlreadyExists)
+
+	c.Assert(Delete(ctx, id), qt.IsNil)
+	_, err = Get(ctx, id)
+	c.Check(errs.Code(err), qt.Equals, errs.NotFound)
+	c.Check(errs.Code(Delete(ctx, id)), qt.Equals, errs.NotFound)
+	_, err = Update(ctx, id, &UpdateParams{Summary: &summary})
+	c.Check(errs.Code(err), qt.Equals, errs.NotFound)
+}
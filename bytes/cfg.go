@@ -0,0 +1,31 @@
+package bytes
+
+import (
+	_ "embed"
+	"encoding/json"
+	"log"
+	"strings"
+)
+
+//go:embed config.json
+var cfgData []byte
+
+var cfg struct {
+	// FeedTitle and FeedDescription describe the bytes feeds.
+	FeedTitle       string `json:"feed_title"`
+	FeedDescription string `json:"feed_description"`
+
+	// HomePageURL is the URL of the page on the website listing bytes.
+	HomePageURL string `json:"home_page_url"`
+
+	// APIBaseURL is the public base URL of the production environment
+	// of this API, which the feeds use to link to themselves.
+	APIBaseURL string `json:"api_base_url"`
+}
+
+func init() {
+	if err := json.Unmarshal(cfgData, &cfg); err != nil {
+		log.Fatalln("could not decode config:", err)
+	}
+	cfg.APIBaseURL = strings.TrimSuffix(cfg.APIBaseURL, "/")
+}
@@ -0,0 +1,193 @@
+package bytes
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"encore.dev/beta/errs"
+)
+
+// feedSize is the number of latest bytes included in the feeds.
+const feedSize = 50
+
+// feedInfo describes a feed of bytes.
+type feedInfo struct {
+	Title       string
+	Description string
+	HomePageURL string
+	FeedURL     string // where the feed itself is served
+}
+
+// Feed serves the latest bytes as an RSS feed at /feed/bytes/rss
+// or a JSON Feed at /feed/bytes/json. The query parameter "tag"
+// limits the feed to bytes with the blog tag with that slug.
+// It isn't under /bytes since a fixed path there would conflict with Get.
+//encore:api public raw method=GET path=/feed/bytes/:format
+func Feed(w http.ResponseWriter, req *http.Request) {
+	format := strings.TrimPrefix(req.URL.Path, "/feed/bytes/")
+	if format != "rss" && format != "json" {
+		errs.HTTPError(w, errs.B().Code(errs.NotFound).Meta("format", format).Msg("unsupported feed format: must be rss or json").Err())
+		return
+	}
+
+	tag := req.URL.Query().Get("tag")
+	bytes, err := queryBytes(req.Context(), `
+		WHERE $2 = '' OR EXISTS (SELECT 1 FROM byte_tag t WHERE t.byte_id = b.id AND t.tag = $2)
+		ORDER BY created_at DESC, id DESC
+		LIMIT $1
+	`, feedSize, tag)
+	if err != nil {
+		errs.HTTPError(w, err)
+		return
+	}
+
+	info := feedInfo{
+		Title:       cfg.FeedTitle,
+		Description: cfg.FeedDescription,
+		HomePageURL: cfg.HomePageURL,
+		FeedURL:     cfg.APIBaseURL + req.URL.RequestURI(),
+	}
+	if tag != "" {
+		info.Title = fmt.Sprintf("%s tagged %s", cfg.FeedTitle, tag)
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=600")
+	if format == "rss" {
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		err = writeRSS(w, info, bytes)
+	} else {
+		w.Header().Set("Content-Type", "application/feed+json")
+		err = writeJSONFeed(w, info, bytes)
+	}
+	if err != nil {
+		errs.HTTPError(w, err)
+	}
+}
+
+// itemID is the id of a byte in the feeds. It never changes,
+// unlike the byte's URL which may be edited.
+func itemID(b *Byte) string {
+	return fmt.Sprintf("%s#byte-%d", cfg.HomePageURL, b.ID)
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string      `xml:"title"`
+	Link          string      `xml:"link"`
+	Description   string      `xml:"description"`
+	AtomLink      rssAtomLink `xml:"atom:link"`
+	LastBuildDate string      `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem   `xml:"item"`
+}
+
+type rssAtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description,omitempty"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Categories  []string `xml:"category"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	ID          string `xml:",chardata"`
+}
+
+// writeRSS writes the bytes as an RSS 2.0 feed.
+func writeRSS(w io.Writer, info feedInfo, bytes []Byte) error {
+	feed := rssFeed{
+		Version: "2.0",
+		Atom:    "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:       info.Title,
+			Link:        info.HomePageURL,
+			Description: info.Description,
+			AtomLink:    rssAtomLink{Href: info.FeedURL, Rel: "self", Type: "application/rss+xml"},
+		},
+	}
+	if len(bytes) > 0 {
+		feed.Channel.LastBuildDate = bytes[0].Created.UTC().Format(time.RFC1123Z)
+	}
+	for i := range bytes {
+		b := &bytes[i]
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       b.Title,
+			Link:        b.URL,
+			Description: b.Summary,
+			GUID:        rssGUID{IsPermaLink: false, ID: itemID(b)},
+			PubDate:     b.Created.UTC().Format(time.RFC1123Z),
+			Categories:  b.Tags,
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(feed)
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Description string         `json:"description,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string   `json:"id"`
+	URL           string   `json:"url"`
+	Title         string   `json:"title"`
+	ContentText   string   `json:"content_text"`
+	Image         string   `json:"image,omitempty"`
+	DatePublished string   `json:"date_published"`
+	Tags          []string `json:"tags,omitempty"`
+}
+
+// writeJSONFeed writes the bytes as a JSON Feed 1.1 feed.
+func writeJSONFeed(w io.Writer, info feedInfo, bytes []Byte) error {
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       info.Title,
+		HomePageURL: info.HomePageURL,
+		FeedURL:     info.FeedURL,
+		Description: info.Description,
+		Items:       []jsonFeedItem{},
+	}
+	for i := range bytes {
+		b := &bytes[i]
+		feed.Items = append(feed.Items, jsonFeedItem{
+			ID:            itemID(b),
+			URL:           b.URL,
+			Title:         b.Title,
+			ContentText:   b.Summary,
+			Image:         b.ImageURL,
+			DatePublished: b.Created.UTC().Format(time.RFC3339),
+			Tags:          b.Tags,
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(feed)
+}
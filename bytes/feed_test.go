@@ -0,0 +1,97 @@
+package bytes
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+var feedBytes = []Byte{
+	{
+		ID:       2,
+		Title:    "Generics & you",
+		Summary:  "A <gentle> introduction",
+		URL:      "https://example.org/generics",
+		Created:  time.Date(2022, time.March, 2, 15, 4, 5, 0, time.UTC),
+		ImageURL: "https://example.org/card.png",
+		Tags:     []string{"go"},
+	},
+	{
+		ID:      1,
+		Title:   "Hello",
+		URL:     "https://example.org/hello",
+		Created: time.Date(2022, time.February, 1, 9, 0, 0, 0, time.UTC),
+		Tags:    []string{},
+	},
+}
+
+var testFeedInfo = feedInfo{
+	Title:       "Bytes",
+	Description: "Links",
+	HomePageURL: "https://brian.dev/bytes",
+	FeedURL:     "https://prod-devweek-k65i.encr.app/feed/bytes/rss",
+}
+
+func TestWriteRSS(t *testing.T) {
+	c := qt.New(t)
+	var buf bytes.Buffer
+	c.Assert(writeRSS(&buf, testFeedInfo, feedBytes), qt.IsNil)
+	c.Check(buf.String(), qt.Contains, `<atom:link href="https://prod-devweek-k65i.encr.app/feed/bytes/rss" rel="self" type="application/rss+xml"></atom:link>`)
+	c.Check(buf.String(), qt.Contains, `<description>A &lt;gentle&gt; introduction</description>`)
+
+	var feed struct {
+		Channel struct {
+			Title         string `xml:"title"`
+			LastBuildDate string `xml:"lastBuildDate"`
+			Items         []struct {
+				Title      string   `xml:"title"`
+				Link       string   `xml:"link"`
+				GUID       string   `xml:"guid"`
+				PubDate    string   `xml:"pubDate"`
+				Categories []string `xml:"category"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	c.Assert(xml.Unmarshal(buf.Bytes(), &feed), qt.IsNil)
+	c.Check(feed.Channel.Title, qt.Equals, "Bytes")
+	c.Check(feed.Channel.LastBuildDate, qt.Equals, "Wed, 02 Mar 2022 15:04:05 +0000")
+	c.Assert(feed.Channel.Items, qt.HasLen, 2)
+	item := feed.Channel.Items[0]
+	c.Check(item.Title, qt.Equals, "Generics & you")
+	c.Check(item.Link, qt.Equals, "https://example.org/generics")
+	c.Check(item.GUID, qt.Equals, "https://brian.dev/bytes#byte-2")
+	c.Check(item.PubDate, qt.Equals, "Wed, 02 Mar 2022 15:04:05 +0000")
+	c.Check(item.Categories, qt.DeepEquals, []string{"go"})
+}
+
+func TestWriteJSONFeed(t *testing.T) {
+	c := qt.New(t)
+	var buf bytes.Buffer
+	c.Assert(writeJSONFeed(&buf, testFeedInfo, feedBytes), qt.IsNil)
+
+	var feed map[string]interface{}
+	c.Assert(json.Unmarshal(buf.Bytes(), &feed), qt.IsNil)
+	c.Check(feed["version"], qt.Equals, "https://jsonfeed.org/version/1.1")
+	c.Check(feed["feed_url"], qt.Equals, "https://prod-devweek-k65i.encr.app/feed/bytes/rss")
+	items := feed["items"].([]interface{})
+	c.Assert(items, qt.HasLen, 2)
+	c.Check(items[0], qt.DeepEquals, map[string]interface{}{
+		"id":             "https://brian.dev/bytes#byte-2",
+		"url":            "https://example.org/generics",
+		"title":          "Generics & you",
+		"content_text":   "A <gentle> introduction",
+		"image":          "https://example.org/card.png",
+		"date_published": "2022-03-02T15:04:05Z",
+		"tags":           []interface{}{"go"},
+	})
+	c.Check(items[1].(map[string]interface{})["tags"], qt.IsNil)
+
+	// An empty feed has an empty list of items.
+	buf.Reset()
+	c.Assert(writeJSONFeed(&buf, testFeedInfo, nil), qt.IsNil)
+	c.Check(buf.String(), qt.Contains, `"items": []`)
+}
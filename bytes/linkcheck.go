@@ -0,0 +1,77 @@
+package bytes
+
+import (
+	"context"
+	"time"
+
+	"encore.app/linkcheck"
+	"encore.dev/cron"
+	"encore.dev/storage/sqldb"
+)
+
+// newLinkChecker returns the checker used by CheckLinks.
+// Tests override it to check links faster.
+var newLinkChecker = linkcheck.New
+
+type CheckLinksResponse struct {
+	NumChecked int `json:"num_checked"`
+	NumBroken  int `json:"num_broken"`
+}
+
+// CheckLinks checks whether the links of the bytes that were checked
+// longest ago still work, and records the results.
+//encore:api private method=POST path=/bytes/check-links
+func CheckLinks(ctx context.Context) (*CheckLinksResponse, error) {
+	sum, err := newLinkChecker().CheckDue(ctx, byteLinks{})
+	if err != nil {
+		return nil, err
+	}
+	return &CheckLinksResponse{NumChecked: sum.NumChecked, NumBroken: sum.NumBroken}, nil
+}
+
+// byteLinks is the linkcheck.Source of the links of bytes.
+type byteLinks struct{}
+
+func (byteLinks) Due(ctx context.Context, checkedBefore time.Time, limit int) ([]*linkcheck.Link, error) {
+	rows, err := sqldb.Query(ctx, `
+		SELECT id, url
+		FROM "byte"
+		WHERE link_checked_at IS NULL OR link_checked_at < $1
+		ORDER BY link_checked_at NULLS FIRST, id
+		LIMIT $2
+	`, checkedBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var links []*linkcheck.Link
+	for rows.Next() {
+		var (
+			id   int64
+			link linkcheck.Link
+		)
+		if err := rows.Scan(&id, &link.URL); err != nil {
+			return nil, err
+		}
+		link.ID = id
+		links = append(links, &link)
+	}
+	return links, rows.Err()
+}
+
+func (byteLinks) Record(ctx context.Context, link *linkcheck.Link, res *linkcheck.Result) error {
+	_, err := sqldb.Exec(ctx, `
+		UPDATE "byte" SET
+			link_status = NULLIF($2, 0), link_final_url = $3, link_error = $4,
+			link_broken = $5, link_checked_at = NOW()
+		WHERE id = $1
+	`, link.ID, res.Status, res.FinalURL, res.Err, res.Broken())
+	return err
+}
+
+// Check links every 6 hours.
+var _ = cron.NewJob("check-byte-links", cron.JobConfig{
+	Title:    "Check whether byte links still work",
+	Every:    6 * cron.Hour,
+	Endpoint: CheckLinks,
+})
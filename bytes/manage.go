@@ -0,0 +1,147 @@
+package bytes
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"encore.app/blog"
+	"encore.dev/beta/errs"
+	"encore.dev/storage/sqldb"
+)
+
+// UpdateParams are the changes to make to a byte.
+// Fields that are nil are left unchanged.
+type UpdateParams struct {
+	Title        *string `json:"title,omitempty"`
+	Summary      *string `json:"summary,omitempty"`
+	URL          *string `json:"url,omitempty"`
+	ImageURL     *string `json:"image_url,omitempty"`
+	SiteName     *string `json:"site_name,omitempty"`
+	CanonicalURL *string `json:"canonical_url,omitempty"`
+
+	// Tags replaces the byte's tags with the blog tags with these slugs.
+	// An empty list removes all tags.
+	Tags *[]string `json:"tags,omitempty"`
+}
+
+// Update updates a byte. Changing its URL clears the result of the last link check.
+//encore:api auth method=PATCH path=/bytes/:id
+func Update(ctx context.Context, id int64, p *UpdateParams) (*Byte, error) {
+	eb := errs.B().Meta("id", id)
+	if p.Title != nil && *p.Title == "" {
+		return nil, eb.Code(errs.InvalidArgument).Msg("title must not be empty").Err()
+	} else if p.URL != nil && *p.URL == "" {
+		return nil, eb.Code(errs.InvalidArgument).Msg("url must not be empty").Err()
+	}
+	if p.Tags != nil {
+		if err := checkTags(ctx, *p.Tags); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := sqldb.Begin(ctx)
+	if err != nil {
+		return nil, eb.Cause(err).Err()
+	}
+	defer tx.Rollback() // committed explicitly on success
+
+	if p.URL != nil {
+		var taken bool
+		err := tx.QueryRow(ctx, `
+			SELECT EXISTS(SELECT 1 FROM "byte" WHERE url = $1 AND id <> $2)
+		`, *p.URL, id).Scan(&taken)
+		if err != nil {
+			return nil, eb.Cause(err).Err()
+		} else if taken {
+			return nil, eb.Code(errs.AlreadyExists).Meta("url", *p.URL).Msg("another byte has that url").Err()
+		}
+	}
+
+	var found int64
+	err = tx.QueryRow(ctx, `
+		UPDATE "byte" SET
+			title = COALESCE($2, title),
+			summary = COALESCE($3, summary),
+			image_url = COALESCE($5, image_url),
+			site_name = COALESCE($6, site_name),
+			canonical_url = COALESCE($7, canonical_url),
+			link_status = CASE WHEN $4 <> url THEN NULL ELSE link_status END,
+			link_final_url = CASE WHEN $4 <> url THEN '' ELSE link_final_url END,
+			link_error = CASE WHEN $4 <> url THEN '' ELSE link_error END,
+			link_broken = CASE WHEN $4 <> url THEN FALSE ELSE link_broken END,
+			link_checked_at = CASE WHEN $4 <> url THEN NULL ELSE link_checked_at END,
+			url = COALESCE($4, url)
+		WHERE id = $1
+		RETURNING id
+	`, id, p.Title, p.Summary, p.URL, p.ImageURL, p.SiteName, p.CanonicalURL).Scan(&found)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, eb.Code(errs.NotFound).Msg("byte not found").Err()
+	} else if p.URL != nil && isUniqueViolation(err) {
+		// Another byte got the url since it was checked above.
+		return nil, eb.Code(errs.AlreadyExists).Meta("url", *p.URL).Msg("another byte has that url").Err()
+	} else if err != nil {
+		return nil, eb.Cause(err).Err()
+	}
+
+	if p.Tags != nil {
+		if _, err := tx.Exec(ctx, `DELETE FROM byte_tag WHERE byte_id = $1`, id); err != nil {
+			return nil, eb.Cause(err).Err()
+		}
+		_, err = tx.Exec(ctx, `
+			INSERT INTO byte_tag (byte_id, tag)
+			SELECT $1, unnest($2::text[])
+			ON CONFLICT DO NOTHING
+		`, id, *p.Tags)
+		if err != nil {
+			return nil, eb.Cause(err).Err()
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, eb.Cause(err).Err()
+	}
+	return Get(ctx, id)
+}
+
+// Delete deletes a byte and its tags.
+//encore:api auth method=DELETE path=/bytes/:id
+func Delete(ctx context.Context, id int64) error {
+	eb := errs.B().Meta("id", id)
+	tx, err := sqldb.Begin(ctx)
+	if err != nil {
+		return eb.Cause(err).Err()
+	}
+	defer tx.Rollback() // committed explicitly on success
+
+	if _, err := tx.Exec(ctx, `DELETE FROM byte_tag WHERE byte_id = $1`, id); err != nil {
+		return eb.Cause(err).Err()
+	}
+	res, err := tx.Exec(ctx, `DELETE FROM "byte" WHERE id = $1`, id)
+	if err != nil {
+		return eb.Cause(err).Err()
+	} else if res.RowsAffected() == 0 {
+		return eb.Code(errs.NotFound).Msg("byte not found").Err()
+	}
+	return tx.Commit()
+}
+
+// isUniqueViolation reports whether err is from violating a unique constraint.
+// sqldb doesn't expose the driver's error type, so it looks for the
+// SQLSTATE code in the error message.
+func isUniqueViolation(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "SQLSTATE 23505")
+}
+
+// checkTags checks that the tags are the slugs of existing blog tags.
+func checkTags(ctx context.Context, tags []string) error {
+	for _, slug := range tags {
+		if _, err := blog.GetTag(ctx, slug); err != nil {
+			if errs.Code(err) == errs.NotFound {
+				return errs.B().Code(errs.InvalidArgument).Meta("tag", slug).Msg("unknown tag").Err()
+			}
+			return errs.B().Meta("tag", slug).Cause(err).Msg("unable to get tag").Err()
+		}
+	}
+	return nil
+}
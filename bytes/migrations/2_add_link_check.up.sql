@@ -0,0 +1,9 @@
+-- The result of the latest check of whether url still works.
+-- link_checked_at is NULL if it hasn't been checked yet.
+ALTER TABLE "byte" ADD COLUMN link_status INTEGER NULL; -- NULL if the request failed
+ALTER TABLE "byte" ADD COLUMN link_final_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE "byte" ADD COLUMN link_error TEXT NOT NULL DEFAULT '';
+ALTER TABLE "byte" ADD COLUMN link_broken BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE "byte" ADD COLUMN link_checked_at TIMESTAMP WITH TIME ZONE NULL;
+
+CREATE INDEX byte_link_checked_idx ON "byte" (link_checked_at NULLS FIRST);
@@ -0,0 +1,5 @@
+-- Metadata of the linked page for rendering bytes as cards,
+-- given when publishing or fetched from the page's Open Graph tags.
+ALTER TABLE "byte" ADD COLUMN image_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE "byte" ADD COLUMN site_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE "byte" ADD COLUMN canonical_url TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,10 @@
+-- byte_tag tags bytes with blog tags.
+-- tag is the slug of a tag in the blog service's tag table. It lives
+-- in another database, so it is checked when tagging instead of by a foreign key.
+CREATE TABLE byte_tag (
+    byte_id INTEGER NOT NULL REFERENCES "byte" (id),
+    tag TEXT NOT NULL,
+    PRIMARY KEY (byte_id, tag)
+);
+
+CREATE INDEX byte_tag_tag_idx ON byte_tag (tag);
@@ -3,6 +3,7 @@ package bytes
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"time"
 
 	"encore.app/social/twitter"
@@ -40,6 +41,8 @@ func Promote(ctx context.Context, id int64, p *PromoteParams) error {
 			// TODO very placeholder tweet text
 			Text: fmt.Sprintf("Quick Byte: %s - %s \n\n%s", byte.Title, byte.Summary, byte.URL),
 		},
+		Source:   "byte",
+		SourceID: strconv.FormatInt(byte.ID, 10),
 	})
 	if err != nil {
 		return eb.Cause(err).Msg("unable to schedule twitter post").Err()
@@ -0,0 +1,111 @@
+package bytes
+
+import (
+	"html/template"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"encore.app/blog"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+)
+
+// maxShareForm is the maximum size of a shared form.
+const maxShareForm = 1 << 20
+
+// Share publishes a byte from a form POST, as sent by a Web Share Target
+// or a bookmarklet. The form fields are "url", "title", "text" (the selected
+// text, used as the summary) and optionally "tags" (comma-separated tag slugs).
+// Whatever isn't given is unfurled from the page.
+//
+// It is the only endpoint that accepts API tokens rather than the password,
+// so a token on a phone or in a browser can't do anything but share bytes.
+// Browsers can't add an Authorization header to form posts, so the token
+// can be given in the "token" field instead. It isn't accepted in the query
+// string, where it would end up in logs, browser history and referrers.
+//
+//encore:api public raw method=POST path=/share/bytes
+func Share(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	req.Body = http.MaxBytesReader(w, req.Body, maxShareForm)
+	if err := req.ParseMultipartForm(maxShareForm); err != nil && err != http.ErrNotMultipart {
+		errs.HTTPError(w, errs.B().Code(errs.InvalidArgument).Cause(err).Msg("invalid form").Err())
+		return
+	}
+
+	token := req.PostForm.Get("token")
+	if token == "" {
+		token = strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	}
+	data, err := blog.VerifyToken(ctx, &blog.VerifyTokenParams{Token: token})
+	if err != nil {
+		errs.HTTPError(w, err)
+		return
+	}
+
+	url, summary := shareURL(req.PostForm.Get("url"), req.PostForm.Get("text"))
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		errs.HTTPError(w, errs.B().Code(errs.InvalidArgument).Meta("url", url).Msg("no http or https url shared").Err())
+		return
+	}
+	p := &PublishParams{
+		Title:   strings.TrimSpace(req.PostForm.Get("title")),
+		Summary: summary,
+		URL:     url,
+		Unfurl:  true,
+		Tags:    splitTags(req.PostForm.Get("tags")),
+	}
+	resp, err := Publish(ctx, p)
+	if err != nil {
+		errs.HTTPError(w, err)
+		return
+	}
+	rlog.Info("published shared byte", "id", resp.ID, "device", data.Device)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(http.StatusCreated)
+	sharedPage.Execute(w, p)
+}
+
+// sharedPage confirms that a shared byte was published.
+var sharedPage = template.Must(template.New("shared").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Byte published</title></head>
+<body>
+<p>Published <a href="{{.URL}}">{{.Title}}</a>.</p>
+</body>
+</html>
+`))
+
+var urlRe = regexp.MustCompile(`https?://\S+`)
+
+// shareURL returns the shared URL and the summary from the shared text.
+// Many apps share the URL in the text rather than the url field,
+// in which case the first URL in the text is used and removed from it.
+func shareURL(url, text string) (string, string) {
+	url, text = strings.TrimSpace(url), strings.TrimSpace(text)
+	if url != "" {
+		return url, text
+	}
+	loc := urlRe.FindStringIndex(text)
+	if loc == nil {
+		return "", text
+	}
+	// Leave out punctuation ending the sentence the URL is in.
+	url = strings.TrimRight(text[loc[0]:loc[1]], `.,;:!?'")`)
+	before, after := strings.TrimSpace(text[:loc[0]]), strings.TrimSpace(text[loc[1]:])
+	return url, strings.TrimSpace(before + " " + after)
+}
+
+// splitTags splits a comma-separated list of tags.
+func splitTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
@@ -0,0 +1,96 @@
+package bytes
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"encore.app/blog"
+	"encore.dev/beta/auth"
+)
+
+func TestShareURL(t *testing.T) {
+	c := qt.New(t)
+	tests := []struct {
+		url, text            string
+		wantURL, wantSummary string
+	}{
+		{"https://example.org/a", " Selected text ", "https://example.org/a", "Selected text"},
+		{"", "Worth a read https://example.org/b", "https://example.org/b", "Worth a read"},
+		{"", "See https://example.org/c. It's good", "https://example.org/c", "See It's good"},
+		{"", "No link here", "", "No link here"},
+	}
+	for _, test := range tests {
+		url, summary := shareURL(test.url, test.text)
+		c.Check(url, qt.Equals, test.wantURL)
+		c.Check(summary, qt.Equals, test.wantSummary)
+	}
+}
+
+func TestSplitTags(t *testing.T) {
+	c := qt.New(t)
+	c.Check(splitTags(" go, ,encore "), qt.DeepEquals, []string{"go", "encore"})
+	c.Check(splitTags(""), qt.IsNil)
+}
+
+func TestShare(t *testing.T) {
+	c := qt.New(t)
+	ctx := auth.WithContext(context.Background(), "dummy", nil)
+	token, err := blog.CreateToken(ctx, &blog.CreateTokenParams{Name: "phone"})
+	c.Assert(err, qt.IsNil)
+	c.Cleanup(func() { blog.RevokeToken(ctx, token.ID) })
+
+	share := func(form url.Values) *httptest.ResponseRecorder {
+		target := "/share/bytes"
+		if tok := form.Get("query_token"); tok != "" {
+			target += "?" + url.Values{"token": {tok}}.Encode()
+			form.Del("query_token")
+		}
+		req := httptest.NewRequest("POST", target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		Share(w, req)
+		return w
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><head><title>Fetched title</title></head></html>`))
+	}))
+	c.Cleanup(srv.Close)
+
+	link := fmt.Sprintf("%s/shared-%d", srv.URL, time.Now().UnixNano())
+	w := share(url.Values{"token": {token.Token}, "title": {"Shared"}, "text": {"Look at this " + link}})
+	c.Assert(w.Code, qt.Equals, http.StatusCreated, qt.Commentf("%s", w.Body))
+
+	list, err := List(ctx, &ListParams{Limit: 1})
+	c.Assert(err, qt.IsNil)
+	c.Assert(list.Bytes, qt.HasLen, 1)
+	c.Check(list.Bytes[0].URL, qt.Equals, link)
+	c.Check(list.Bytes[0].Title, qt.Equals, "Shared")
+	c.Check(list.Bytes[0].Summary, qt.Equals, "Look at this")
+
+	// Without a title it is unfurled.
+	w = share(url.Values{"token": {token.Token}, "url": {link + "/other"}})
+	c.Assert(w.Code, qt.Equals, http.StatusCreated, qt.Commentf("%s", w.Body))
+	list, err = List(ctx, &ListParams{Limit: 1})
+	c.Assert(err, qt.IsNil)
+	c.Check(list.Bytes[0].Title, qt.Equals, "Fetched title")
+
+	// The token isn't accepted in the query string, where it would be logged.
+	w = share(url.Values{"query_token": {token.Token}, "url": {link + "/query"}})
+	c.Check(w.Code, qt.Equals, http.StatusUnauthorized)
+
+	w = share(url.Values{"token": {"bkt_invalid"}, "title": {"Shared"}, "url": {link}})
+	c.Check(w.Code, qt.Equals, http.StatusUnauthorized)
+
+	w = share(url.Values{"token": {token.Token}, "title": {"Shared"}, "text": {"no link"}})
+	c.Check(w.Code, qt.Equals, http.StatusBadRequest)
+}
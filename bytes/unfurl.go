@@ -0,0 +1,193 @@
+package bytes
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"encore.app/linkcheck"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// pageMetadata is the metadata of a web page used to render a byte as a card.
+type pageMetadata struct {
+	Title        string
+	Description  string
+	ImageURL     string
+	SiteName     string
+	CanonicalURL string
+}
+
+// unfurlClient fetches pages to unfurl. Tests may override it.
+// Byte URLs are chosen by whoever publishes or shares a byte,
+// so it only connects to public addresses.
+var unfurlClient = linkcheck.NewClient(10 * time.Second)
+
+// maxUnfurlRead is how much of a page is read looking for metadata.
+// It is in the head, which is near the start of the page.
+const maxUnfurlRead = 512 << 10
+
+// unfurl fetches the page at rawURL and extracts its metadata.
+func unfurl(ctx context.Context, rawURL string) (*pageMetadata, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	} else if err := linkcheck.CheckScheme(req.URL); err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; bjk-unfurl/1.0; +https://brian.dev)")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	resp, err := unfurlClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("got status %s", resp.Status)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, fmt.Errorf("unsupported content type %q", mediaType)
+	}
+	return parsePage(io.LimitReader(resp.Body, maxUnfurlRead), contentType, resp.Request.URL)
+}
+
+// parsePage decodes a page to UTF-8 from the charset given in contentType,
+// the Content-Type header, or otherwise the charset the page declares or
+// the browsers' default, and extracts its metadata.
+func parsePage(body io.Reader, contentType string, base *url.URL) (*pageMetadata, error) {
+	r, err := charset.NewReader(body, contentType)
+	if err != nil {
+		return nil, err
+	}
+	return parseMetadata(r, base), nil
+}
+
+// parseMetadata extracts the Open Graph metadata from the head of an HTML page,
+// falling back to Twitter card metadata and standard tags for missing values.
+// Relative URLs are resolved against base, the URL of the page.
+func parseMetadata(r io.Reader, base *url.URL) *pageMetadata {
+	meta := make(map[string]string) // first value of each meta property or name
+	var canonical, title string
+	z := html.NewTokenizer(r)
+tokens:
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			// The end of the page, or of what was read of it.
+			break tokens
+		case html.EndTagToken:
+			if name, _ := z.TagName(); atom.Lookup(name) == atom.Head {
+				break tokens
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.Body:
+				break tokens
+			case atom.Title:
+				if title == "" && z.Next() == html.TextToken {
+					title = string(z.Text())
+				}
+			case atom.Meta:
+				attrs := tagAttrs(z, hasAttr)
+				key := attrs["property"]
+				if key == "" {
+					key = attrs["name"]
+				}
+				key = strings.ToLower(key)
+				if _, ok := meta[key]; !ok && key != "" && attrs["content"] != "" {
+					meta[key] = attrs["content"]
+				}
+			case atom.Link:
+				attrs := tagAttrs(z, hasAttr)
+				if canonical == "" && hasToken(attrs["rel"], "canonical") {
+					canonical = attrs["href"]
+				}
+			}
+		}
+	}
+
+	first := func(keys ...string) string {
+		for _, k := range keys {
+			if v := clean(meta[k]); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+	firstURL := func(keys ...string) string {
+		for _, k := range keys {
+			if v := resolve(base, clean(meta[k])); v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+	md := &pageMetadata{
+		Title:        first("og:title", "twitter:title"),
+		Description:  first("og:description", "twitter:description", "description"),
+		ImageURL:     firstURL("og:image:secure_url", "og:image", "og:image:url", "twitter:image"),
+		SiteName:     first("og:site_name", "application-name"),
+		CanonicalURL: resolve(base, clean(canonical)),
+	}
+	if md.Title == "" {
+		md.Title = clean(title)
+	}
+	if md.CanonicalURL == "" {
+		md.CanonicalURL = firstURL("og:url")
+	}
+	return md
+}
+
+// tagAttrs returns the attributes of the current tag of z as a map
+// from attribute name to value, keeping the first of repeated attributes.
+func tagAttrs(z *html.Tokenizer, hasAttr bool) map[string]string {
+	attrs := make(map[string]string)
+	for hasAttr {
+		var key, val []byte
+		key, val, hasAttr = z.TagAttr()
+		if _, ok := attrs[string(key)]; !ok {
+			attrs[string(key)] = string(val)
+		}
+	}
+	return attrs
+}
+
+// hasToken reports whether the space-separated list s contains token, ignoring case.
+func hasToken(s, token string) bool {
+	for _, f := range strings.Fields(s) {
+		if strings.EqualFold(f, token) {
+			return true
+		}
+	}
+	return false
+}
+
+var spaceRe = regexp.MustCompile(`\s+`)
+
+// clean collapses whitespace and replaces invalid UTF-8.
+func clean(s string) string {
+	return strings.TrimSpace(spaceRe.ReplaceAllString(strings.ToValidUTF8(s, "\uFFFD"), " "))
+}
+
+// resolve resolves ref against base, returning only absolute http(s) URLs.
+func resolve(base *url.URL, ref string) string {
+	if ref == "" {
+		return ""
+	}
+	u, err := base.Parse(ref)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return u.String()
+}
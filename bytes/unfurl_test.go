@@ -0,0 +1,141 @@
+package bytes
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestParseMetadata(t *testing.T) {
+	c := qt.New(t)
+	base, err := url.Parse("https://example.org/posts/hello?ref=x")
+	c.Assert(err, qt.IsNil)
+
+	page := `<!DOCTYPE html>
+<html>
+<head>
+  <title>Ignored &amp; overridden</title>
+  <META PROPERTY="og:title" CONTENT="Hello,
+      World &amp; Gophers">
+  <meta property="og:title" content="Second title">
+  <meta name='description' content='Plain description'>
+  <meta property="og:description" content="Open Graph description">
+  <meta property="og:image" content="/img/card.png?a=1&amp;b=2">
+  <meta property="og:site_name" content="Example">
+  <meta property="og:url" content="https://example.org/og-url">
+  <link rel="alternate canonical" href="https://example.org/posts/hello">
+</head>
+<body>
+  <meta property="og:image" content="https://example.org/body.png">
+</body>
+</html>`
+	c.Check(parseMetadata(strings.NewReader(page), base), qt.DeepEquals, &pageMetadata{
+		Title:        "Hello, World & Gophers",
+		Description:  "Open Graph description",
+		ImageURL:     "https://example.org/img/card.png?a=1&b=2",
+		SiteName:     "Example",
+		CanonicalURL: "https://example.org/posts/hello",
+	})
+
+	// Without Open Graph tags the standard and Twitter tags are used.
+	page = `<html><head>
+<title>
+  Plain title
+</title>
+<meta name="description" content="Plain description">
+<meta name="twitter:image" content="https://cdn.example.org/card.jpg">
+<meta property="og:url" content="../canonical">
+<meta property="og:image" content="javascript:alert(1)">
+</head></html>`
+	c.Check(parseMetadata(strings.NewReader(page), base), qt.DeepEquals, &pageMetadata{
+		Title:        "Plain title",
+		Description:  "Plain description",
+		ImageURL:     "https://cdn.example.org/card.jpg",
+		CanonicalURL: "https://example.org/canonical",
+	})
+
+	// Tags in comments, scripts and styles are ignored.
+	page = `<html><head>
+<!-- <meta property="og:title" content="Commented out"> </head> -->
+<script>document.write('<meta property="og:title" content="Scripted">');</script>
+<style>/* <meta property="og:description" content="Styled"> */</style>
+<meta property="og:title" content="Real title">
+<meta property="og:description" content="Real description">
+</head></html>`
+	c.Check(parseMetadata(strings.NewReader(page), base), qt.DeepEquals, &pageMetadata{
+		Title:       "Real title",
+		Description: "Real description",
+	})
+
+	c.Check(parseMetadata(strings.NewReader("not html at all"), base), qt.DeepEquals, &pageMetadata{})
+}
+
+func TestParsePageCharset(t *testing.T) {
+	c := qt.New(t)
+	base, err := url.Parse("https://example.org/")
+	c.Assert(err, qt.IsNil)
+	tests := []struct {
+		body        string
+		contentType string
+		want        string
+	}{
+		{body: "<title>Caf\xc3\xa9</title>", contentType: "text/html", want: "Café"},
+		{body: "<title>Caf\xc3\xa9</title>", contentType: "text/html; charset=UTF-8", want: "Café"},
+		{body: "<title>Caf\xe9</title>", contentType: "text/html; charset=ISO-8859-1", want: "Café"},
+		{body: "<title>\x93Quoted\x94 \x80</title>", contentType: "text/html; charset=windows-1252", want: "“Quoted” €"},
+		{body: "<meta charset=\"iso-8859-1\"><title>Caf\xe9</title>", contentType: "text/html", want: "Café"},
+		{body: "<meta http-equiv=\"Content-Type\" content=\"text/html; charset=windows-1252\"><title>\x96</title>", contentType: "text/html", want: "–"},
+		{body: "<meta charset=\"shift_jis\"><title>\x93\xfa\x96\x7b</title>", contentType: "text/html", want: "日本"},
+		{body: "<title>Caf\xe9</title>", contentType: "text/html", want: "Café"}, // browsers default to Windows-1252
+	}
+	for _, test := range tests {
+		md, err := parsePage(strings.NewReader(test.body), test.contentType, base)
+		c.Assert(err, qt.IsNil)
+		c.Check(md.Title, qt.Equals, test.want, qt.Commentf("body %q, content type %q", test.body, test.contentType))
+	}
+}
+
+func TestUnfurlNonPublic(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<title>Internal</title>"))
+	}))
+	defer srv.Close()
+
+	// The test server listens on loopback, so it can't be unfurled.
+	_, err := unfurl(ctx, srv.URL)
+	c.Assert(err, qt.ErrorMatches, ".*non-public address.*")
+
+	// Nor can a public page that redirects to it, or URLs of other schemes.
+	redirect := &http.Request{URL: &url.URL{Scheme: "file", Path: "/etc/passwd"}}
+	c.Assert(unfurlClient.CheckRedirect(redirect, nil), qt.ErrorMatches, `unsupported url scheme "file"`)
+	_, err = unfurl(ctx, "file:///etc/passwd")
+	c.Assert(err, qt.ErrorMatches, `unsupported url scheme "file"`)
+}
+
+func TestApplyMetadata(t *testing.T) {
+	c := qt.New(t)
+	p := &PublishParams{Title: "My title", URL: "https://example.org", SiteName: "Mine"}
+	applyMetadata(p, &pageMetadata{
+		Title:        "Page title",
+		Description:  "Page description",
+		ImageURL:     "https://example.org/card.png",
+		SiteName:     "Example",
+		CanonicalURL: "https://example.org/",
+	})
+	c.Check(p, qt.DeepEquals, &PublishParams{
+		Title:        "My title",
+		Summary:      "Page description",
+		URL:          "https://example.org",
+		ImageURL:     "https://example.org/card.png",
+		SiteName:     "Mine",
+		CanonicalURL: "https://example.org/",
+	})
+}
@@ -0,0 +1,98 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode"
+
+	"encore.dev/beta/errs"
+)
+
+// normalizeEmail parses an email address according to RFC 5322 and
+// returns it in its normalized form, which is how it is stored.
+//
+// Surrounding whitespace and any display name are removed and the domain
+// is lowercased. The local part keeps its case, since RFC 5321 leaves it
+// up to the receiving server whether it is case-sensitive.
+//
+// Addresses with invalid or disposable domains are rejected.
+func normalizeEmail(s string) (string, error) {
+	addr, err := mail.ParseAddress(strings.TrimSpace(s))
+	if err != nil {
+		return "", err
+	}
+	at := strings.LastIndexByte(addr.Address, '@')
+	if at < 0 {
+		return "", errors.New("missing @ in address")
+	}
+	local, domain := addr.Address[:at], strings.ToLower(addr.Address[at+1:])
+	// Quoted local parts are valid but parsing unquotes them,
+	// so reject those that can't be written without quotes.
+	if strings.ContainsAny(local, " \t\"\\(),:;<>@[]") {
+		return "", fmt.Errorf("unsupported local part %q", local)
+	}
+	if err := validateDomain(domain); err != nil {
+		return "", err
+	}
+	if isDisposableDomain(domain) {
+		return "", fmt.Errorf("disposable email domain %q", domain)
+	}
+	return local + "@" + domain, nil
+}
+
+// normalizeEmailArg is like normalizeEmail but reports
+// errors as invalid arguments suitable for returning from APIs.
+func normalizeEmailArg(s string) (string, error) {
+	email, err := normalizeEmail(s)
+	if err != nil {
+		return "", errs.B().Cause(err).Code(errs.InvalidArgument).Meta("email", s).Msg("invalid email address").Err()
+	}
+	return email, nil
+}
+
+// canonicalEmail returns the normalized form of an address that was
+// previously accepted, such as one from a token issued before addresses
+// were normalized. If it no longer validates it is returned unchanged.
+func canonicalEmail(email string) string {
+	if normalized, err := normalizeEmail(email); err == nil {
+		return normalized
+	}
+	return email
+}
+
+// validateDomain reports an error if domain is not a plausible
+// domain name for receiving email.
+func validateDomain(domain string) error {
+	if len(domain) > 253 {
+		return errors.New("domain too long")
+	}
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return fmt.Errorf("domain %q is not fully qualified", domain)
+	}
+	for _, l := range labels {
+		if l == "" || len(l) > 63 || l[0] == '-' || l[len(l)-1] == '-' {
+			return fmt.Errorf("invalid domain %q", domain)
+		}
+		for _, r := range l {
+			if r != '-' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				return fmt.Errorf("invalid domain %q", domain)
+			}
+		}
+	}
+	return nil
+}
+
+// isDisposableDomain reports whether domain or one of its parent
+// domains is in the configured list of disposable email domains.
+func isDisposableDomain(domain string) bool {
+	for _, d := range cfg.DisposableDomains {
+		d = strings.ToLower(d)
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
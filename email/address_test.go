@@ -0,0 +1,74 @@
+package email
+
+import (
+	"context"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"encore.dev/beta/errs"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	c := qt.New(t)
+	tests := []struct {
+		in, want string
+		valid    bool
+	}{
+		{" Foo@Example.COM ", "Foo@example.com", true},
+		{"Jane Doe <jane@example.org>", "jane@example.org", true},
+		{"first.last+tag@sub.example.org", "first.last+tag@sub.example.org", true},
+		{"", "", false},
+		{"foo", "", false},
+		{"foo@localhost", "", false},
+		{"foo@-example.org", "", false},
+		{"foo@exa_mple.org", "", false},
+		{`"foo bar"@example.org`, "", false},
+		{"spam@mailinator.com", "", false},
+		{"spam@eu.mailinator.com", "", false},
+	}
+	for _, test := range tests {
+		got, err := normalizeEmail(test.in)
+		if !test.valid {
+			c.Check(err, qt.Not(qt.IsNil), qt.Commentf("%q", test.in))
+			continue
+		}
+		c.Check(err, qt.IsNil, qt.Commentf("%q", test.in))
+		c.Check(got, qt.Equals, test.want)
+	}
+}
+
+func TestSubscribeNormalizesEmail(t *testing.T) {
+	c := qt.New(t)
+	useFakeSMTP(c)
+	ctx := context.Background()
+
+	err := subscribe(ctx, &SubscribeParams{Email: "not an email", ForwardedFor: "192.0.2.1"})
+	c.Assert(errs.Code(err), qt.Equals, errs.InvalidArgument)
+
+	subscribeConfirmed(c, ctx, " Normalized@Example.org ")
+	optedIn, err := isOptedIn(ctx, "Normalized@example.org")
+	c.Assert(err, qt.IsNil)
+	c.Assert(optedIn, qt.IsTrue)
+
+	// The local part keeps its case, since it may be case-sensitive.
+	optedIn, err = isOptedIn(ctx, "normalized@example.org")
+	c.Assert(err, qt.IsNil)
+	c.Assert(optedIn, qt.IsFalse)
+
+	// Scheduling to both spellings of the domain sends only one message.
+	tmplID := c.Name()
+	err = CreateTemplate(ctx, tmplID, &CreateTemplateParams{
+		Sender:   "sender@example.org",
+		Subject:  "subject",
+		BodyText: "text body",
+		BodyHTML: "html body",
+	})
+	c.Assert(err, qt.IsNil)
+	scheduled, err := Schedule(ctx, &ScheduleParams{
+		TemplateID:     tmplID,
+		EmailAddresses: []string{"Normalized@EXAMPLE.org", "Normalized@example.ORG"},
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(scheduled.MessageIDs, qt.HasLen, 1)
+}
@@ -0,0 +1,236 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"encore.dev/beta/errs"
+	"encore.dev/storage/sqldb"
+)
+
+// Campaign is a group of messages scheduled together,
+// such as the promotion of a post or a newsletter digest.
+type Campaign struct {
+	ID         int64  `json:"id,omitempty"`
+	TemplateID string `json:"template_id,omitempty"`
+
+	// Segment is the segment the campaign was sent to.
+	// It is nil if it was sent to all subscribers.
+	Segment *Segment `json:"segment,omitempty"`
+
+	CreatedAt   time.Time  `json:"created_at,omitempty"`
+	CancelledAt *time.Time `json:"cancelled_at,omitempty"` // nil if not cancelled
+
+	Stats *CampaignStats `json:"stats,omitempty"`
+}
+
+// CampaignStats are the number of messages in a campaign by their state.
+type CampaignStats struct {
+	Scheduled    int `json:"scheduled"`    // total number of messages
+	Pending      int `json:"pending"`      // not yet sent, failed or cancelled
+	Sent         int `json:"sent"`         // successfully sent
+	Failed       int `json:"failed"`       // given up on after failing to send
+	Cancelled    int `json:"cancelled"`    // cancelled before being sent
+	Opened       int `json:"opened"`       // opened by the recipient
+	Unsubscribed int `json:"unsubscribed"` // led to the recipient unsubscribing
+}
+
+// GetCampaign returns a campaign and its stats.
+//encore:api auth method=GET path=/email/campaigns/:id
+func GetCampaign(ctx context.Context, id int64) (*Campaign, error) {
+	eb := errs.B().Meta("campaign_id", id)
+	var (
+		c       Campaign
+		segment []byte
+	)
+	err := sqldb.QueryRow(ctx, `
+		SELECT id, template_id, segment, created_at, cancelled_at
+		FROM campaign
+		WHERE id = $1
+	`, id).Scan(&c.ID, &c.TemplateID, &segment, &c.CreatedAt, &c.CancelledAt)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, eb.Code(errs.NotFound).Msg("campaign not found").Err()
+	} else if err != nil {
+		return nil, eb.Cause(err).Err()
+	}
+	if err := unmarshalNullable(segment, &c.Segment); err != nil {
+		return nil, eb.Cause(err).Err()
+	}
+	stats, err := campaignStats(ctx, []int64{id})
+	if err != nil {
+		return nil, eb.Cause(err).Err()
+	}
+	c.Stats = stats[id]
+	return &c, nil
+}
+
+type ListCampaignsParams struct {
+	Limit  int `json:"limit,omitempty"`
+	Offset int `json:"offset,omitempty"`
+}
+
+type ListCampaignsResponse struct {
+	Campaigns []*Campaign `json:"campaigns"`
+}
+
+// ListCampaigns lists campaigns and their stats, newest first.
+//encore:api auth method=GET path=/email/campaigns
+func ListCampaigns(ctx context.Context, p *ListCampaignsParams) (*ListCampaignsResponse, error) {
+	limit := p.Limit
+	if limit < 0 {
+		return nil, errs.B().Code(errs.InvalidArgument).Meta("limit", limit).Msg("limit must not be negative").Err()
+	} else if p.Offset < 0 {
+		return nil, errs.B().Code(errs.InvalidArgument).Meta("offset", p.Offset).Msg("offset must not be negative").Err()
+	} else if limit == 0 {
+		limit = 20
+	}
+	rows, err := sqldb.Query(ctx, `
+		SELECT id, template_id, segment, created_at, cancelled_at
+		FROM campaign
+		ORDER BY created_at DESC, id DESC
+		LIMIT $1
+		OFFSET $2
+	`, limit, p.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	campaigns := []*Campaign{}
+	var ids []int64
+	for rows.Next() {
+		var (
+			c       Campaign
+			segment []byte
+		)
+		if err := rows.Scan(&c.ID, &c.TemplateID, &segment, &c.CreatedAt, &c.CancelledAt); err != nil {
+			return nil, err
+		}
+		if err := unmarshalNullable(segment, &c.Segment); err != nil {
+			return nil, errs.B().Meta("campaign_id", c.ID).Cause(err).Err()
+		}
+		campaigns = append(campaigns, &c)
+		ids = append(ids, c.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	stats, err := campaignStats(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range campaigns {
+		c.Stats = stats[c.ID]
+	}
+	return &ListCampaignsResponse{Campaigns: campaigns}, nil
+}
+
+type CancelCampaignResponse struct {
+	NumCancelled int `json:"num_cancelled"` // number of messages cancelled
+}
+
+// CancelCampaign cancels the messages in a campaign that have not been sent yet.
+//encore:api auth method=POST path=/email/campaigns/:id/cancel
+func CancelCampaign(ctx context.Context, id int64) (*CancelCampaignResponse, error) {
+	eb := errs.B().Meta("campaign_id", id)
+	res, err := sqldb.Exec(ctx, `
+		UPDATE campaign SET cancelled_at = COALESCE(cancelled_at, NOW())
+		WHERE id = $1
+	`, id)
+	if err != nil {
+		return nil, eb.Cause(err).Err()
+	} else if res.RowsAffected() == 0 {
+		return nil, eb.Code(errs.NotFound).Msg("campaign not found").Err()
+	}
+
+	res, err = sqldb.Exec(ctx, `
+		UPDATE message SET cancelled_at = NOW(), claimed_until = NULL
+		WHERE campaign_id = $1 AND sent_at IS NULL AND failed_at IS NULL AND cancelled_at IS NULL
+	`, id)
+	if err != nil {
+		return nil, eb.Cause(err).Err()
+	}
+	return &CancelCampaignResponse{NumCancelled: int(res.RowsAffected())}, nil
+}
+
+type ResendCampaignResponse struct {
+	NumScheduled int `json:"num_scheduled"` // number of messages scheduled again
+}
+
+// ResendCampaign schedules the failed messages in a campaign to be sent again.
+// Recipients that are no longer opted in are skipped.
+//encore:api auth method=POST path=/email/campaigns/:id/resend
+func ResendCampaign(ctx context.Context, id int64) (*ResendCampaignResponse, error) {
+	eb := errs.B().Meta("campaign_id", id)
+	var cancelled bool
+	err := sqldb.QueryRow(ctx, `
+		SELECT cancelled_at IS NOT NULL FROM campaign WHERE id = $1
+	`, id).Scan(&cancelled)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, eb.Code(errs.NotFound).Msg("campaign not found").Err()
+	} else if err != nil {
+		return nil, eb.Cause(err).Err()
+	} else if cancelled {
+		return nil, eb.Code(errs.FailedPrecondition).Msg("campaign is cancelled").Err()
+	}
+
+	res, err := sqldb.Exec(ctx, `
+		UPDATE message m SET
+			scheduled_at = NOW(), attempts = 0, last_error = NULL,
+			retry_at = NULL, failed_at = NULL, claimed_until = NULL
+		FROM "user" u
+		WHERE m.campaign_id = $1 AND m.failed_at IS NOT NULL AND m.sent_at IS NULL
+		AND u.email_address = m.email_address AND u.optin
+	`, id)
+	if err != nil {
+		return nil, eb.Cause(err).Err()
+	}
+	return &ResendCampaignResponse{NumScheduled: int(res.RowsAffected())}, nil
+}
+
+// campaignStats computes the stats for the campaigns with the given ids,
+// keyed by campaign id, in a single query.
+func campaignStats(ctx context.Context, ids []int64) (map[int64]*CampaignStats, error) {
+	stats := make(map[int64]*CampaignStats, len(ids))
+	for _, id := range ids {
+		// Campaigns without any messages have no rows below.
+		stats[id] = &CampaignStats{}
+	}
+	rows, err := sqldb.Query(ctx, `
+		SELECT
+			m.campaign_id,
+			COUNT(*),
+			COUNT(*) FILTER (WHERE m.sent_at IS NOT NULL),
+			COUNT(*) FILTER (WHERE m.failed_at IS NOT NULL AND m.sent_at IS NULL),
+			COUNT(*) FILTER (WHERE m.cancelled_at IS NOT NULL AND m.sent_at IS NULL),
+			COUNT(*) FILTER (WHERE EXISTS (
+				SELECT 1 FROM message_event e
+				WHERE e.provider_id = m.provider_id AND e.event = $2
+			)),
+			COUNT(*) FILTER (WHERE EXISTS (
+				SELECT 1 FROM unsubscribe_event u WHERE u.message_id = m.id
+			))
+		FROM message m
+		WHERE m.campaign_id = ANY($1::bigint[])
+		GROUP BY m.campaign_id
+	`, ids, EventOpened)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			id int64
+			s  CampaignStats
+		)
+		if err := rows.Scan(&id, &s.Scheduled, &s.Sent, &s.Failed, &s.Cancelled, &s.Opened, &s.Unsubscribed); err != nil {
+			return nil, err
+		}
+		s.Pending = s.Scheduled - s.Sent - s.Failed - s.Cancelled
+		stats[id] = &s
+	}
+	return stats, rows.Err()
+}
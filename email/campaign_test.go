@@ -0,0 +1,111 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"encore.dev/storage/sqldb"
+)
+
+func TestCampaign(t *testing.T) {
+	c := qt.New(t)
+	useTopics(c, "campaign-topic")
+	ctx := auth.WithContext(context.Background(), "user-id", nil)
+	sent, failed, cancelled := "sent@campaign.example.org", "failed@campaign.example.org", "cancelled@campaign.example.org"
+	for _, email := range []string{sent, failed, cancelled} {
+		subscribeConfirmed(c, ctx, email)
+		token, err := encodePreferencesToken(email)
+		c.Assert(err, qt.IsNil)
+		err = UpdatePreferences(ctx, &UpdatePreferencesParams{Token: token, Topics: []string{"campaign-topic"}})
+		c.Assert(err, qt.IsNil)
+	}
+
+	tmplID := c.Name()
+	err := CreateTemplate(ctx, tmplID, &CreateTemplateParams{
+		Sender:   "sender@example.org",
+		Subject:  "subject",
+		BodyText: "text body",
+		BodyHTML: "html body",
+	})
+	c.Assert(err, qt.IsNil)
+	scheduled, err := ScheduleAll(ctx, &ScheduleAllParams{
+		TemplateID: tmplID,
+		Segment:    &Segment{Topics: []string{"campaign-topic"}},
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(scheduled.CampaignID, qt.Not(qt.Equals), int64(0))
+	messageIDs := make(map[string]int64)
+	for _, id := range scheduled.MessageIDs {
+		m, err := messageRecipient(ctx, id)
+		c.Assert(err, qt.IsNil)
+		messageIDs[m] = id
+	}
+
+	// Send one message successfully and fail another.
+	useFakeSMTP(c)
+	_, err = Send(ctx, messageIDs[sent])
+	c.Assert(err, qt.IsNil)
+	c.Assert(recordSendFailure(ctx, messageIDs[failed], errors.New("boom")), qt.IsNil)
+
+	// Messages that are still being retried are not resent.
+	resent, err := ResendCampaign(ctx, scheduled.CampaignID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(resent.NumScheduled, qt.Equals, 0)
+	for i := 0; i < cfg.Sending.MaxAttempts; i++ {
+		c.Assert(recordSendFailure(ctx, messageIDs[failed], errors.New("boom")), qt.IsNil)
+	}
+
+	// The sent message led to an unsubscribe.
+	token, err := encodeUnsubscribeToken(sent, messageIDs[sent])
+	c.Assert(err, qt.IsNil)
+	c.Assert(Unsubscribe(ctx, &UnsubscribeParams{Token: token}), qt.IsNil)
+
+	campaign, err := GetCampaign(ctx, scheduled.CampaignID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(campaign.TemplateID, qt.Equals, tmplID)
+	c.Assert(campaign.Segment, qt.DeepEquals, &Segment{Topics: []string{"campaign-topic"}})
+	c.Assert(campaign.Stats.Scheduled, qt.Equals, len(scheduled.MessageIDs))
+	c.Assert(campaign.Stats.Sent, qt.Equals, 1)
+	c.Assert(campaign.Stats.Failed, qt.Equals, 1)
+	c.Assert(campaign.Stats.Unsubscribed, qt.Equals, 1)
+
+	// Resending schedules the failed message again.
+	resent, err = ResendCampaign(ctx, scheduled.CampaignID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(resent.NumScheduled, qt.Equals, 1)
+
+	// Cancelling cancels everything that hasn't been sent.
+	cancel, err := CancelCampaign(ctx, scheduled.CampaignID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(cancel.NumCancelled, qt.Equals, len(scheduled.MessageIDs)-1)
+	resp, err := Send(ctx, messageIDs[cancelled])
+	c.Assert(err, qt.IsNil)
+	c.Assert(resp.Sent, qt.IsFalse)
+
+	campaign, err = GetCampaign(ctx, scheduled.CampaignID)
+	c.Assert(err, qt.IsNil)
+	c.Assert(campaign.CancelledAt, qt.Not(qt.IsNil))
+	c.Assert(campaign.Stats.Cancelled, qt.Equals, len(scheduled.MessageIDs)-1)
+	c.Assert(campaign.Stats.Pending, qt.Equals, 0)
+
+	// A cancelled campaign can't be resent.
+	_, err = ResendCampaign(ctx, scheduled.CampaignID)
+	c.Assert(errs.Code(err), qt.Equals, errs.FailedPrecondition)
+
+	_, err = ListCampaigns(ctx, &ListCampaignsParams{Limit: -1})
+	c.Check(errs.Code(err), qt.Equals, errs.InvalidArgument)
+	_, err = ListCampaigns(ctx, &ListCampaignsParams{Offset: -1})
+	c.Check(errs.Code(err), qt.Equals, errs.InvalidArgument)
+}
+
+// messageRecipient returns the email address a message is sent to.
+func messageRecipient(ctx context.Context, id int64) (string, error) {
+	var email string
+	err := sqldb.QueryRow(ctx, `SELECT email_address FROM message WHERE id = $1`, id).Scan(&email)
+	return email, err
+}
@@ -4,22 +4,103 @@ import (
 	_ "embed"
 	"encoding/json"
 	"log"
+	"time"
 )
 
 //go:embed config.json
 var cfgData []byte
 
 var cfg struct {
+	// Transport selects how emails are delivered:
+	// "mailgun", "smtp", or "file" for writing .eml files to FileDir.
+	Transport string `json:"transport"`
+
 	MailgunDomain string `json:"mailgun_domain"`
+
+	// SMTP configures the "smtp" transport.
+	// The password is read from the SMTPPassword secret.
+	SMTP struct {
+		Addr     string `json:"addr"`
+		Username string `json:"username"`
+	} `json:"smtp"`
+
+	// FileDir is the directory the "file" transport writes emails to.
+	FileDir string `json:"file_dir"`
+
+	// SiteURL is the base URL of the website, used for links in emails.
+	SiteURL string `json:"site_url"`
+
+	// APIURL is the base URL of this API, used for links that mail clients
+	// call directly, such as one-click unsubscribe. It is the production
+	// environment; api.brian.dev is the staging environment.
+	APIURL string `json:"api_url"`
+
+	// ConfirmSender is the sender of subscription confirmation emails.
+	ConfirmSender string `json:"confirm_sender"`
+
+	// DigestSender is the sender of the weekly newsletter digest.
+	DigestSender string `json:"digest_sender"`
+
+	// PostSender is the sender of emails promoting blog posts.
+	PostSender string `json:"post_sender"`
+
+	// PendingTTL is how long a subscription may stay unconfirmed
+	// before it expires, as a duration string like "48h".
+	PendingTTL string `json:"pending_ttl"`
+
+	// DisposableDomains are email domains that can't be subscribed with,
+	// typically throwaway address providers. Subdomains are rejected too.
+	DisposableDomains []string `json:"disposable_domains"`
+
+	// Sending configures how scheduled emails are delivered.
+	Sending struct {
+		Concurrency int `json:"concurrency"`  // max number of emails sent in parallel
+		PerMinute   int `json:"per_minute"`   // max number of emails sent per minute
+		MaxAttempts int `json:"max_attempts"` // attempts before a message is marked as failed
+
+		// RetryBackoff is how long to wait before retrying a failed message,
+		// as a duration string like "5m". It doubles with every attempt.
+		RetryBackoff string `json:"retry_backoff"`
+	} `json:"sending"`
+
+	// UnsubscribeTTL is how long unsubscribe tokens in sent emails stay valid,
+	// as a duration string like "2160h".
+	UnsubscribeTTL string `json:"unsubscribe_ttl"`
 }
 
+// pendingTTL, unsubscribeTTL and retryBackoff are the parsed
+// cfg.PendingTTL, cfg.UnsubscribeTTL and cfg.Sending.RetryBackoff.
+var pendingTTL, unsubscribeTTL, retryBackoff time.Duration
+
 func init() {
 	if err := json.Unmarshal(cfgData, &cfg); err != nil {
 		log.Fatalln("could not decode config:", err)
 	}
+	var err error
+	if pendingTTL, err = time.ParseDuration(cfg.PendingTTL); err != nil {
+		log.Fatalln("bad pending_ttl in config:", err)
+	}
+	if unsubscribeTTL, err = time.ParseDuration(cfg.UnsubscribeTTL); err != nil {
+		log.Fatalln("bad unsubscribe_ttl in config:", err)
+	}
+	if retryBackoff, err = time.ParseDuration(cfg.Sending.RetryBackoff); err != nil {
+		log.Fatalln("bad sending.retry_backoff in config:", err)
+	}
+	if cfg.Sending.Concurrency < 1 {
+		log.Fatalln("bad sending.concurrency in config: must be at least 1")
+	}
+	if transport, err = newTransport(cfg.Transport); err != nil {
+		log.Fatalln("bad transport in config:", err)
+	}
 }
 
 var secrets struct {
 	MailGunAPIKey string
 	TokenHashKey  string
+
+	// MailgunWebhookSigningKey is used to verify that event webhooks come from Mailgun.
+	MailgunWebhookSigningKey string
+
+	// SMTPPassword is the password for the "smtp" transport.
+	SMTPPassword string
 }
@@ -0,0 +1,150 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/securecookie"
+
+	"encore.dev/beta/errs"
+	"encore.dev/cron"
+	"encore.dev/storage/sqldb"
+)
+
+const confirmSubject = "Please confirm your subscription"
+
+const confirmBodyText = `Thanks for subscribing to the newsletter!
+
+Please confirm your subscription by visiting the link below:
+
+%s
+
+If you didn't subscribe, you can safely ignore this email.
+`
+
+const confirmBodyHTML = `<p>Thanks for subscribing to the newsletter!</p>
+<p>Please <a href="%s">confirm your subscription</a>.</p>
+<p>If you didn't subscribe, you can safely ignore this email.</p>
+`
+
+type ConfirmParams struct {
+	// Token is the confirmation token from the confirmation email.
+	Token string `json:"token,omitempty"`
+}
+
+// Confirm confirms a pending subscription to the email newsletter.
+//encore:api public method=POST path=/email/confirm
+func Confirm(ctx context.Context, p *ConfirmParams) error {
+	eb := errs.B()
+	email, err := decodeConfirmToken(p.Token)
+	if err != nil {
+		return eb.Cause(err).Code(errs.InvalidArgument).Msg("invalid or expired token").Err()
+	}
+
+	res, err := sqldb.Exec(ctx, `
+		UPDATE "user" SET optin = true, optin_changed = NOW(), pending_since = NULL
+		WHERE email_address = $1 AND pending_since IS NOT NULL
+	`, email)
+	if err != nil {
+		return err
+	} else if res.RowsAffected() > 0 {
+		return nil
+	}
+
+	// Confirming twice is fine, but the subscription may have expired.
+	if optedIn, err := isOptedIn(ctx, email); err != nil {
+		return err
+	} else if !optedIn {
+		return eb.Code(errs.NotFound).Msg("subscription not found or expired").Err()
+	}
+	return nil
+}
+
+type ExpirePendingResponse struct {
+	NumExpired int // number of pending subscriptions that expired
+}
+
+// ExpirePending expires subscriptions that were not confirmed in time.
+//encore:api private method=POST path=/email/expire-pending
+func ExpirePending(ctx context.Context) (*ExpirePendingResponse, error) {
+	cutoff := time.Now().Add(-pendingTTL)
+
+	// Addresses we have never emailed are removed entirely,
+	// while others keep their history but are no longer pending.
+	deleted, err := sqldb.Exec(ctx, `
+		DELETE FROM "user" u
+		WHERE NOT u.optin AND u.pending_since < $1
+		AND NOT EXISTS (SELECT 1 FROM message m WHERE m.email_address = u.email_address)
+	`, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := sqldb.Exec(ctx, `
+		UPDATE "user" SET pending_since = NULL
+		WHERE pending_since < $1
+	`, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	return &ExpirePendingResponse{NumExpired: int(deleted.RowsAffected() + updated.RowsAffected())}, nil
+}
+
+// sendConfirmation sends the subscription confirmation email to email.
+func sendConfirmation(ctx context.Context, email string) error {
+	eb := errs.B().Meta("email", email)
+	token, err := encodeConfirmToken(email)
+	if err != nil {
+		return eb.Cause(err).Err()
+	}
+	link := cfg.SiteURL + "/newsletter/confirm?token=" + url.QueryEscape(token)
+
+	mail := &Mail{
+		From:    cfg.ConfirmSender,
+		To:      email,
+		Subject: confirmSubject,
+		Text:    fmt.Sprintf(confirmBodyText, link),
+		HTML:    fmt.Sprintf(confirmBodyHTML, html.EscapeString(link)),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	if _, err := transport.Send(ctx, mail); err != nil {
+		return eb.Cause(err).Code(errs.Unavailable).Msg("unable to send confirmation email").Err()
+	}
+	return nil
+}
+
+// confirmTokenData is the unencoded data that makes up the confirmation token.
+type confirmTokenData struct {
+	Email string `json:"email,omitempty"`
+}
+
+// encodeConfirmToken encodes an email address as a confirmation token using HMAC.
+func encodeConfirmToken(email string) (string, error) {
+	return confirmCookie().Encode("confirm", confirmTokenData{Email: email})
+}
+
+// decodeConfirmToken decodes a confirmation token into the email address it contains.
+// Tokens older than the pending subscription TTL are rejected.
+func decodeConfirmToken(token string) (email string, err error) {
+	var data confirmTokenData
+	if err := confirmCookie().Decode("confirm", token, &data); err != nil {
+		return "", err
+	}
+	return canonicalEmail(data.Email), nil
+}
+
+// confirmCookie returns the securecookie for encoding confirmation tokens.
+func confirmCookie() *securecookie.SecureCookie {
+	return securecookie.New(tokenHashKey, nil).MaxAge(int(pendingTTL.Seconds()))
+}
+
+// Expire unconfirmed subscriptions every hour.
+var _ = cron.NewJob("expire-pending-subscriptions", cron.JobConfig{
+	Title:    "Expire unconfirmed subscriptions",
+	Every:    1 * cron.Hour,
+	Endpoint: ExpirePending,
+})
@@ -0,0 +1,46 @@
+package email
+
+import (
+	"context"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestDoubleOptIn(t *testing.T) {
+	c := qt.New(t)
+	sent := useFakeSMTP(c)
+	ctx := context.Background()
+	email := "pending@example.org"
+
+	// Subscribing sends a confirmation email but doesn't opt in yet.
+	c.Assert(subscribe(ctx, &SubscribeParams{Email: email, ForwardedFor: "192.0.2.2"}), qt.IsNil)
+	c.Assert(*sent, qt.HasLen, 1)
+	optedIn, err := isOptedIn(ctx, email)
+	c.Assert(err, qt.IsNil)
+	c.Assert(optedIn, qt.IsFalse)
+
+	// An invalid token is rejected.
+	err = Confirm(ctx, &ConfirmParams{Token: "bogus"})
+	c.Assert(err, qt.ErrorMatches, ".*invalid or expired token.*")
+
+	// Confirming with the token from the email opts in.
+	token, err := encodeConfirmToken(email)
+	c.Assert(err, qt.IsNil)
+	c.Assert(Confirm(ctx, &ConfirmParams{Token: token}), qt.IsNil)
+	optedIn, err = isOptedIn(ctx, email)
+	c.Assert(err, qt.IsNil)
+	c.Assert(optedIn, qt.IsTrue)
+
+	// Confirming twice is a no-op.
+	c.Assert(Confirm(ctx, &ConfirmParams{Token: token}), qt.IsNil)
+}
+
+// subscribeConfirmed subscribes email to the newsletter and confirms the subscription.
+func subscribeConfirmed(c *qt.C, ctx context.Context, email string) {
+	useFakeSMTP(c)
+	c.Assert(subscribe(ctx, &SubscribeParams{Email: email, ForwardedFor: "192.0.2.2"}), qt.IsNil)
+	token, err := encodeConfirmToken(email)
+	c.Assert(err, qt.IsNil)
+	c.Assert(Confirm(ctx, &ConfirmParams{Token: token}), qt.IsNil)
+}
@@ -0,0 +1,225 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"encore.app/blog"
+	"encore.app/bytes"
+	"encore.dev/beta/errs"
+	"encore.dev/cron"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+)
+
+// DigestData is the content of a newsletter digest.
+type DigestData struct {
+	Posts []*DigestItem `json:"posts,omitempty"`
+	Bytes []*DigestItem `json:"bytes,omitempty"`
+}
+
+// DigestItem is a single post or byte in a digest.
+type DigestItem struct {
+	Title   string `json:"title,omitempty"`
+	Summary string `json:"summary,omitempty"`
+	URL     string `json:"url,omitempty"`
+}
+
+const digestSubject = `What's new this week`
+
+const digestBodyText = `Hi{{with .Recipient.Name}} {{.}}{{end}},
+
+Here's what's new since the last newsletter.
+{{with .Digest.Posts}}
+Posts
+{{range .}}
+* {{.Title}}
+  {{.URL}}
+{{with .Summary}}  {{.}}
+{{end}}{{end}}{{end}}{{with .Digest.Bytes}}
+Bytes
+{{range .}}
+* {{.Title}}
+  {{.URL}}
+{{with .Summary}}  {{.}}
+{{end}}{{end}}{{end}}
+Choose which topics you get emails about: {{.PreferencesURL}}
+Unsubscribe: {{.UnsubscribeURL}}
+`
+
+const digestBodyHTML = `<p>Hi{{with .Recipient.Name}} {{.}}{{end}},</p>
+<p>Here's what's new since the last newsletter.</p>
+{{with .Digest.Posts}}<h2>Posts</h2>
+<ul>
+{{range .}}<li><a href="{{.URL}}">{{.Title}}</a>{{with .Summary}}<br>{{.}}{{end}}</li>
+{{end}}</ul>
+{{end}}{{with .Digest.Bytes}}<h2>Bytes</h2>
+<ul>
+{{range .}}<li><a href="{{.URL}}">{{.Title}}</a>{{with .Summary}}<br>{{.}}{{end}}</li>
+{{end}}</ul>
+{{end}}<p><a href="{{.PreferencesURL}}">Choose which topics you get emails about</a> &middot; <a href="{{.UnsubscribeURL}}">Unsubscribe</a></p>
+`
+
+// digestInterval is how far back the first digest looks for new content.
+const digestInterval = 7 * 24 * time.Hour
+
+type SendDigestResponse struct {
+	// DigestID is the id of the digest that was scheduled.
+	// It is zero if no digest was sent.
+	DigestID int64
+
+	// CampaignID is the campaign the digest was sent as.
+	CampaignID int64
+
+	NumPosts    int // number of posts in the digest
+	NumBytes    int // number of bytes in the digest
+	NumMessages int // number of messages scheduled
+}
+
+// SendDigest composes a newsletter digest of the posts and bytes published
+// since the last digest and schedules it to all subscribers.
+// Nothing is sent if there is no new content.
+//encore:api private method=POST path=/email/digest
+func SendDigest(ctx context.Context) (*SendDigestResponse, error) {
+	eb := errs.B()
+	until := time.Now()
+	since, err := lastDigestTime(ctx)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		since = until.Add(-digestInterval)
+	} else if err != nil {
+		return nil, eb.Cause(err).Msg("unable to query last digest").Err()
+	}
+
+	digest, err := collectDigest(ctx, since, until)
+	if err != nil {
+		return nil, eb.Cause(err).Msg("unable to collect digest content").Err()
+	}
+	if len(digest.Posts) == 0 && len(digest.Bytes) == 0 {
+		rlog.Info("no new content for digest", "since", since)
+		return &SendDigestResponse{}, nil
+	}
+
+	// Record the digest first so that concurrent runs can't send the same
+	// content twice; the unique covers_since column guarantees that.
+	var id int64
+	err = sqldb.QueryRow(ctx, `
+		INSERT INTO digest (covers_since, covers_until, num_posts, num_bytes)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (covers_since) DO NOTHING
+		RETURNING id
+	`, since, until, len(digest.Posts), len(digest.Bytes)).Scan(&id)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		rlog.Info("digest already sent", "since", since)
+		return &SendDigestResponse{}, nil
+	} else if err != nil {
+		return nil, eb.Cause(err).Msg("unable to record digest").Err()
+	}
+
+	resp, err := scheduleDigest(ctx, id, digest)
+	if err != nil && resp == nil {
+		// Nothing was scheduled, so forget the digest for the next run to retry it.
+		if _, err := sqldb.Exec(ctx, `DELETE FROM digest WHERE id = $1`, id); err != nil {
+			rlog.Error("failed to delete unsent digest", "err", err, "digest_id", id)
+		}
+		return nil, eb.Cause(err).Meta("digest_id", id).Msg("unable to schedule digest").Err()
+	} else if err != nil {
+		// The messages are already queued, so the digest must be kept
+		// for it not to be sent again; only recording it as scheduled failed.
+		rlog.Error("failed to mark digest as scheduled", "err", err, "digest_id", id)
+	}
+	return &SendDigestResponse{
+		DigestID:    id,
+		CampaignID:  resp.CampaignID,
+		NumPosts:    len(digest.Posts),
+		NumBytes:    len(digest.Bytes),
+		NumMessages: len(resp.MessageIDs),
+	}, nil
+}
+
+// scheduleDigest creates the email template for a digest and schedules it to all subscribers.
+// If the messages were scheduled but the digest couldn't be marked as such,
+// it reports both the response and the error.
+func scheduleDigest(ctx context.Context, id int64, digest *DigestData) (*ScheduleResponse, error) {
+	templateID := fmt.Sprintf("digest-%d", id)
+	err := CreateTemplate(ctx, templateID, &CreateTemplateParams{
+		Sender:   cfg.DigestSender,
+		Subject:  digestSubject,
+		BodyText: digestBodyText,
+		BodyHTML: digestBodyHTML,
+		Digest:   digest,
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := ScheduleAll(ctx, &ScheduleAllParams{TemplateID: templateID})
+	if err != nil {
+		return nil, err
+	}
+	_, err = sqldb.Exec(ctx, `
+		UPDATE digest SET template_id = $2, scheduled_at = NOW()
+		WHERE id = $1
+	`, id, templateID)
+	return resp, err
+}
+
+// lastDigestTime reports the end of the period covered by the latest digest.
+// If there has been no digest it reports sqldb.ErrNoRows.
+func lastDigestTime(ctx context.Context) (time.Time, error) {
+	var t *time.Time
+	err := sqldb.QueryRow(ctx, `
+		SELECT MAX(covers_until) FROM digest
+	`).Scan(&t)
+	if err != nil {
+		return time.Time{}, err
+	} else if t == nil {
+		return time.Time{}, sqldb.ErrNoRows
+	}
+	return *t, nil
+}
+
+// digestPageSize is how many posts or bytes collectDigest fetches at a time.
+const digestPageSize = 100
+
+// collectDigest collects the posts and bytes published in the period (since, until].
+func collectDigest(ctx context.Context, since, until time.Time) (*DigestData, error) {
+	var d DigestData
+	for offset := 0; ; offset += digestPageSize {
+		posts, err := blog.GetBlogPosts(ctx, &blog.GetBlogPostsParams{Limit: digestPageSize, Offset: offset, Since: since})
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range posts.BlogPosts {
+			if p.Status == "published" && p.PublishedAt.After(since) && !p.PublishedAt.After(until) {
+				d.Posts = append(d.Posts, &DigestItem{Title: p.Title, Summary: p.Excerpt, URL: p.URL})
+			}
+		}
+		if len(posts.BlogPosts) < digestPageSize {
+			break
+		}
+	}
+
+	for offset := 0; ; offset += digestPageSize {
+		list, err := bytes.List(ctx, &bytes.ListParams{Limit: digestPageSize, Offset: offset, Since: since})
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range list.Bytes {
+			if b.Created.After(since) && !b.Created.After(until) {
+				d.Bytes = append(d.Bytes, &DigestItem{Title: b.Title, Summary: b.Summary, URL: b.URL})
+			}
+		}
+		if len(list.Bytes) < digestPageSize {
+			break
+		}
+	}
+	return &d, nil
+}
+
+// Send the newsletter digest every Monday.
+var _ = cron.NewJob("send-digest", cron.JobConfig{
+	Title:    "Send weekly newsletter digest",
+	Schedule: "0 15 * * 1",
+	Endpoint: SendDigest,
+})
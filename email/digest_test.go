@@ -0,0 +1,51 @@
+package email
+
+import (
+	"context"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"encore.app/bytes"
+	"encore.dev/beta/auth"
+)
+
+func TestDigestTemplate(t *testing.T) {
+	c := qt.New(t)
+	data := &TemplateData{
+		Recipient:      Recipient{Email: "jane@example.org", Name: "Jane"},
+		UnsubscribeURL: "https://example.org/unsubscribe",
+		Digest: &DigestData{
+			Bytes: []*DigestItem{{Title: "A <byte>", URL: "https://example.org/byte", Summary: "summary"}},
+		},
+	}
+	r, err := renderTemplate(digestSubject, digestBodyText, digestBodyHTML, data)
+	c.Assert(err, qt.IsNil)
+	c.Assert(r.BodyText, qt.Contains, "* A <byte>\n  https://example.org/byte\n  summary\n")
+	c.Assert(r.BodyText, qt.Not(qt.Contains), "Posts")
+	c.Assert(r.BodyHTML, qt.Contains, `<a href="https://example.org/byte">A &lt;byte&gt;</a>`)
+}
+
+func TestSendDigest(t *testing.T) {
+	c := qt.New(t)
+	useFakeSMTP(c)
+	ctx := auth.WithContext(context.Background(), "user-id", nil)
+	subscribeConfirmed(c, ctx, "digest@example.org")
+
+	_, err := bytes.Publish(ctx, &bytes.PublishParams{
+		Title: "digest byte",
+		URL:   "https://example.org/" + c.Name(),
+	})
+	c.Assert(err, qt.IsNil)
+
+	resp, err := SendDigest(ctx)
+	c.Assert(err, qt.IsNil)
+	c.Assert(resp.DigestID, qt.Not(qt.Equals), int64(0))
+	c.Assert(resp.NumBytes >= 1, qt.IsTrue)
+	c.Assert(resp.NumMessages >= 1, qt.IsTrue)
+
+	// Nothing new has been published, so the next digest is skipped.
+	resp, err = SendDigest(ctx)
+	c.Assert(err, qt.IsNil)
+	c.Assert(resp.DigestID, qt.Equals, int64(0))
+}
@@ -0,0 +1,208 @@
+package email
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mailgun/mailgun-go/v4"
+	"github.com/mailgun/mailgun-go/v4/events"
+
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+)
+
+// Message event types recorded in the message_event table.
+const (
+	EventDelivered  = "delivered"
+	EventOpened     = "opened"
+	EventClicked    = "clicked"
+	EventBounced    = "bounced"
+	EventComplained = "complained"
+)
+
+// webhookMaxAge is how old a webhook signature may be before it is rejected,
+// to protect against replayed requests.
+const webhookMaxAge = 15 * time.Minute
+
+// MailgunEvents receives delivery and engagement event webhooks from Mailgun.
+//encore:api public raw method=POST path=/email/mailgun/events
+func MailgunEvents(w http.ResponseWriter, req *http.Request) {
+	eb := errs.B()
+	var payload mailgun.WebhookPayload
+	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+		errs.HTTPError(w, eb.Cause(err).Code(errs.InvalidArgument).Msg("invalid webhook payload").Err())
+		return
+	}
+	if !verifyWebhookSignature(secrets.MailgunWebhookSigningKey, payload.Signature, time.Now()) {
+		errs.HTTPError(w, eb.Code(errs.Unauthenticated).Msg("invalid webhook signature").Err())
+		return
+	}
+
+	ev, err := parseMessageEvent(payload.EventData)
+	if err != nil {
+		errs.HTTPError(w, eb.Cause(err).Code(errs.InvalidArgument).Msg("invalid event data").Err())
+		return
+	}
+	// Events we don't track (ev is nil) are acknowledged so Mailgun doesn't retry.
+	if fresh, err := recordWebhook(req.Context(), payload.Signature.Token, ev); err != nil {
+		rlog.Error("failed to record webhook", "err", err)
+		errs.HTTPError(w, err)
+		return
+	} else if !fresh {
+		errs.HTTPError(w, eb.Code(errs.Unauthenticated).Msg("replayed webhook").Err())
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// messageEvent is a provider event concerning a sent message.
+type messageEvent struct {
+	ProviderEventID string
+	ProviderID      string
+	Event           string
+	Recipient       string
+	Reason          string
+	OccurredAt      time.Time
+}
+
+// parseMessageEvent parses the event data from a Mailgun webhook.
+// It reports nil if the event is not one we track.
+func parseMessageEvent(data []byte) (*messageEvent, error) {
+	e, err := mailgun.ParseEvent(data)
+	if err != nil {
+		return nil, err
+	}
+
+	ev := &messageEvent{
+		ProviderEventID: e.GetID(),
+		OccurredAt:      e.GetTimestamp(),
+	}
+	var msg events.Message
+	switch e := e.(type) {
+	case *events.Delivered:
+		ev.Event, ev.Recipient, msg = EventDelivered, e.Recipient, e.Message
+	case *events.Opened:
+		ev.Event, ev.Recipient, msg = EventOpened, e.Recipient, e.Message
+	case *events.Clicked:
+		ev.Event, ev.Recipient, msg = EventClicked, e.Recipient, e.Message
+	case *events.Complained:
+		ev.Event, ev.Recipient, msg = EventComplained, e.Recipient, e.Message
+	case *events.Failed:
+		// Temporary failures are retried by Mailgun, so only hard bounces are tracked.
+		if e.Severity != "permanent" {
+			return nil, nil
+		}
+		ev.Event, ev.Recipient, msg = EventBounced, e.Recipient, e.Message
+		ev.Reason = e.Reason
+	default:
+		return nil, nil
+	}
+	ev.ProviderID = normalizeProviderID(msg.Headers.MessageID)
+	return ev, nil
+}
+
+// recordWebhook records the token of a verified webhook signature together
+// with its event, if it is one we track, in a single transaction, so that
+// the token is only spent once the event is stored and Mailgun can retry
+// webhooks that failed. It reports false without recording anything if
+// the token was seen before, meaning the webhook is replayed.
+func recordWebhook(ctx context.Context, token string, ev *messageEvent) (fresh bool, err error) {
+	tx, err := sqldb.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback() // committed explicitly on success
+
+	if fresh, err := recordWebhookToken(ctx, tx, token); err != nil || !fresh {
+		return false, err
+	}
+	if ev != nil {
+		if err := recordMessageEvent(ctx, tx, ev); err != nil {
+			return false, err
+		}
+	}
+	return true, tx.Commit()
+}
+
+// recordMessageEvent stores a message event. Hard bounces and complaints
+// additionally opt the recipient out of future emails.
+func recordMessageEvent(ctx context.Context, tx *sqldb.Tx, ev *messageEvent) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO "message_event" (provider_event_id, provider_id, event, recipient, reason, occurred_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (provider_event_id) DO NOTHING
+	`, ev.ProviderEventID, ev.ProviderID, ev.Event, ev.Recipient, ev.Reason, ev.OccurredAt)
+	if err != nil {
+		return err
+	}
+
+	if ev.Event != EventBounced && ev.Event != EventComplained {
+		return nil
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE "user" SET optin = false, optin_changed = NOW()
+		WHERE optin AND email_address = COALESCE(
+			(SELECT email_address FROM message WHERE provider_id = $1 LIMIT 1),
+			$2
+		)
+	`, ev.ProviderID, canonicalEmail(ev.Recipient))
+	return err
+}
+
+// recordWebhookToken records the token of a verified webhook signature.
+// It reports false if the token was seen before, meaning the webhook is replayed.
+// Tokens are only kept as long as their signatures could still be accepted,
+// which is up to twice webhookMaxAge since timestamps may be in the future.
+func recordWebhookToken(ctx context.Context, tx *sqldb.Tx, token string) (fresh bool, err error) {
+	_, err = tx.Exec(ctx, `
+		DELETE FROM "webhook_token" WHERE received_at < NOW() - $1 * INTERVAL '1 second'
+	`, int64(2*webhookMaxAge/time.Second))
+	if err != nil {
+		return false, err
+	}
+	res, err := tx.Exec(ctx, `
+		INSERT INTO "webhook_token" (token) VALUES ($1)
+		ON CONFLICT (token) DO NOTHING
+	`, token)
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() == 1, nil
+}
+
+// verifyWebhookSignature reports whether sig is a valid, recent
+// Mailgun webhook signature for the given signing key.
+func verifyWebhookSignature(key string, sig mailgun.Signature, now time.Time) bool {
+	ts, err := strconv.ParseInt(sig.TimeStamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > webhookMaxAge || age < -webhookMaxAge {
+		return false
+	}
+
+	got, err := hex.DecodeString(sig.Signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	io.WriteString(mac, sig.TimeStamp)
+	io.WriteString(mac, sig.Token)
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+// normalizeProviderID formats a Mailgun message id the way it is
+// returned when sending, which is how it is stored in message.provider_id.
+// Mailgun events report the id without the surrounding angle brackets.
+func normalizeProviderID(id string) string {
+	return "<" + strings.Trim(id, "<>") + ">"
+}
@@ -0,0 +1,124 @@
+package email
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/mailgun/mailgun-go/v4"
+)
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	c := qt.New(t)
+	now := time.Now()
+	sign := func(key string, ts time.Time) mailgun.Signature {
+		sig := mailgun.Signature{TimeStamp: strconv.FormatInt(ts.Unix(), 10), Token: "token"}
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write([]byte(sig.TimeStamp + sig.Token))
+		sig.Signature = hex.EncodeToString(mac.Sum(nil))
+		return sig
+	}
+
+	c.Assert(verifyWebhookSignature("key", sign("key", now), now), qt.IsTrue)
+	c.Assert(verifyWebhookSignature("key", sign("other", now), now), qt.IsFalse)
+	c.Assert(verifyWebhookSignature("key", sign("key", now.Add(-time.Hour)), now), qt.IsFalse)
+}
+
+func TestParseMessageEvent(t *testing.T) {
+	c := qt.New(t)
+	ev, err := parseMessageEvent([]byte(`{
+		"event": "failed",
+		"id": "event-id",
+		"timestamp": 1650000000.5,
+		"severity": "permanent",
+		"reason": "bounce",
+		"recipient": "john@example.org",
+		"message": {"headers": {"message-id": "abc@mg.example.org"}}
+	}`))
+	c.Assert(err, qt.IsNil)
+	c.Assert(ev.Event, qt.Equals, EventBounced)
+	c.Assert(ev.ProviderID, qt.Equals, "<abc@mg.example.org>")
+	c.Assert(ev.Recipient, qt.Equals, "john@example.org")
+
+	// Temporary failures are not tracked.
+	ev, err = parseMessageEvent([]byte(`{"event": "failed", "id": "event-id-2", "severity": "temporary"}`))
+	c.Assert(err, qt.IsNil)
+	c.Assert(ev, qt.IsNil)
+}
+
+func TestComplaintOptsOut(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+	email := "complainer@example.org"
+	subscribeConfirmed(c, ctx, email)
+
+	_, err := recordWebhook(ctx, webhookToken(c, "complained"), &messageEvent{
+		ProviderEventID: c.Name(),
+		ProviderID:      "<unknown@mg.example.org>",
+		Event:           EventComplained,
+		Recipient:       email,
+		OccurredAt:      time.Now(),
+	})
+	c.Assert(err, qt.IsNil)
+
+	optedIn, err := isOptedIn(ctx, email)
+	c.Assert(err, qt.IsNil)
+	c.Assert(optedIn, qt.IsFalse)
+
+	// Recipients are matched regardless of the case of their domain.
+	email = "Mixed-Complainer@example.org"
+	subscribeConfirmed(c, ctx, email)
+	_, err = recordWebhook(ctx, webhookToken(c, "mixed"), &messageEvent{
+		ProviderEventID: c.Name() + "-mixed",
+		ProviderID:      "<unknown@mg.example.org>",
+		Event:           EventComplained,
+		Recipient:       "Mixed-Complainer@EXAMPLE.org",
+		OccurredAt:      time.Now(),
+	})
+	c.Assert(err, qt.IsNil)
+	optedIn, err = isOptedIn(ctx, email)
+	c.Assert(err, qt.IsNil)
+	c.Assert(optedIn, qt.IsFalse)
+}
+
+func TestRecordWebhook(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+	token := webhookToken(c, "untracked")
+
+	fresh, err := recordWebhook(ctx, token, nil)
+	c.Assert(err, qt.IsNil)
+	c.Assert(fresh, qt.IsTrue)
+
+	// Replaying the same signature is rejected.
+	fresh, err = recordWebhook(ctx, token, nil)
+	c.Assert(err, qt.IsNil)
+	c.Assert(fresh, qt.IsFalse)
+
+	// The token isn't spent if its event can't be recorded,
+	// so that the webhook can be retried.
+	token = webhookToken(c, "retried")
+	ev := &messageEvent{
+		ProviderEventID: c.Name(),
+		ProviderID:      "<unknown@mg.example.org>",
+		Event:           EventDelivered,
+		Recipient:       "invalid\x00@example.org", // rejected by Postgres
+		OccurredAt:      time.Now(),
+	}
+	_, err = recordWebhook(ctx, token, ev)
+	c.Assert(err, qt.Not(qt.IsNil))
+	ev.Recipient = "retried@example.org"
+	fresh, err = recordWebhook(ctx, token, ev)
+	c.Assert(err, qt.IsNil)
+	c.Assert(fresh, qt.IsTrue)
+}
+
+// webhookToken returns a unique webhook signature token for the test.
+func webhookToken(c *qt.C, name string) string {
+	return c.Name() + "-" + name + "-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+}
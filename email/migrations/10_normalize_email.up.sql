@@ -0,0 +1,48 @@
+-- Normalize email addresses by trimming whitespace and lowercasing their domain,
+-- merging users whose addresses only differed in whitespace or the case of the domain.
+-- Local parts keep their case, since they may be case-sensitive.
+-- The merged user keeps the state of the row whose opt-in changed most recently,
+-- preferring one that opted out on a tie so that merging never resubscribes anyone.
+CREATE FUNCTION normalize_email_address(addr TEXT) RETURNS TEXT
+LANGUAGE sql IMMUTABLE AS $$
+    SELECT CASE WHEN position('@' IN t) > 0
+        THEN regexp_replace(t, '@[^@]*$', '') || lower(substring(t FROM '@[^@]*$'))
+        ELSE t
+    END
+    FROM btrim(addr, E' \t\r\n') AS t
+$$;
+
+INSERT INTO "user" (email_address, name, optin, optin_changed, optin_source, pending_since)
+SELECT DISTINCT ON (normalize_email_address(u.email_address))
+    normalize_email_address(u.email_address), u.name, u.optin, u.optin_changed, u.optin_source, u.pending_since
+FROM "user" u
+WHERE EXISTS (
+    SELECT 1 FROM "user" o
+    WHERE normalize_email_address(o.email_address) = normalize_email_address(u.email_address)
+    AND o.email_address <> normalize_email_address(o.email_address)
+)
+ORDER BY normalize_email_address(u.email_address), u.optin_changed DESC NULLS LAST, u.optin ASC
+ON CONFLICT (email_address) DO UPDATE SET
+    name = EXCLUDED.name,
+    optin = EXCLUDED.optin,
+    optin_changed = EXCLUDED.optin_changed,
+    optin_source = EXCLUDED.optin_source,
+    pending_since = EXCLUDED.pending_since;
+
+UPDATE "message" SET email_address = normalize_email_address(email_address)
+WHERE email_address <> normalize_email_address(email_address);
+
+UPDATE "unsubscribe_event" SET email_address = normalize_email_address(email_address)
+WHERE email_address <> normalize_email_address(email_address);
+
+INSERT INTO "topic_subscription" (email_address, topic)
+SELECT normalize_email_address(email_address), topic
+FROM "topic_subscription"
+WHERE email_address <> normalize_email_address(email_address)
+ON CONFLICT DO NOTHING;
+
+DELETE FROM "topic_subscription" WHERE email_address <> normalize_email_address(email_address);
+
+DELETE FROM "user" WHERE email_address <> normalize_email_address(email_address);
+
+DROP FUNCTION normalize_email_address(TEXT);
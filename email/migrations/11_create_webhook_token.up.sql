@@ -0,0 +1,8 @@
+-- webhook_token records the tokens of received webhook signatures,
+-- so that a captured webhook can't be replayed while its signature is still recent.
+CREATE TABLE "webhook_token" (
+    token TEXT PRIMARY KEY,
+    received_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX webhook_token_received_idx ON "webhook_token" (received_at);
@@ -0,0 +1,29 @@
+-- message_event tracks delivery and engagement events reported by the email provider.
+CREATE TABLE "message_event" (
+    id BIGSERIAL PRIMARY KEY,
+
+    -- provider_event_id is the provider's unique id for the event.
+    -- It is used to ignore duplicate deliveries of the same event.
+    provider_event_id TEXT NOT NULL UNIQUE,
+
+    -- provider_id is the provider's id for the message the event concerns.
+    -- It matches message.provider_id.
+    provider_id TEXT NOT NULL,
+
+    -- event is one of 'delivered', 'opened', 'clicked', 'bounced' or 'complained'.
+    event TEXT NOT NULL,
+
+    -- recipient is the email address the event concerns.
+    recipient TEXT NOT NULL,
+
+    -- reason describes why a message bounced. It is empty for other events.
+    reason TEXT NOT NULL DEFAULT '',
+
+    -- occurred_at is when the event happened according to the provider.
+    occurred_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+    -- received_at is when the event was received.
+    received_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX message_event_provider_idx ON "message_event" (provider_id);
@@ -0,0 +1,3 @@
+-- pending_since is set while a subscription is awaiting confirmation
+-- through the link in the confirmation email. It is NULL otherwise.
+ALTER TABLE "user" ADD COLUMN pending_since TIMESTAMP WITH TIME ZONE NULL;
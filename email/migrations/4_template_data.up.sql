@@ -0,0 +1,6 @@
+-- post is the post an email template is about, in the format of *email.PostData.
+-- It is NULL for templates that aren't about a particular post.
+ALTER TABLE "template" ADD COLUMN post JSONB NULL;
+
+-- name is the subscriber's name, if they provided one.
+ALTER TABLE "user" ADD COLUMN name TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,24 @@
+-- digest is the content of a newsletter digest, in the format of *email.DigestData.
+-- It is NULL for templates that aren't digests.
+ALTER TABLE "template" ADD COLUMN digest JSONB NULL;
+
+-- digest records each newsletter digest so that content is only sent once.
+CREATE TABLE "digest" (
+    id BIGSERIAL PRIMARY KEY,
+
+    -- covers_since and covers_until are the period of published content the digest covers.
+    -- Each digest starts where the previous one ended.
+    covers_since TIMESTAMP WITH TIME ZONE NOT NULL UNIQUE,
+    covers_until TIMESTAMP WITH TIME ZONE NOT NULL,
+
+    -- num_posts and num_bytes are the number of posts and bytes in the digest.
+    num_posts INTEGER NOT NULL,
+    num_bytes INTEGER NOT NULL,
+
+    -- template_id is the email template for the digest.
+    -- It is non-null once the digest has been scheduled.
+    template_id TEXT NULL REFERENCES "template" (id),
+
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    scheduled_at TIMESTAMP WITH TIME ZONE NULL
+);
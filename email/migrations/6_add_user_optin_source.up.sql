@@ -0,0 +1,3 @@
+-- optin_source records how the user opted in, such as "website" for
+-- the subscribe form or the source given when importing subscribers.
+ALTER TABLE "user" ADD COLUMN optin_source TEXT NOT NULL DEFAULT '';
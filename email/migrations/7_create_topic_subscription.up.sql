@@ -0,0 +1,11 @@
+-- topic_subscription tracks the topics a user wants emails about.
+-- Users without any topic subscriptions receive emails about every topic.
+CREATE TABLE "topic_subscription" (
+    -- email_address is the email address of the subscriber.
+    email_address TEXT NOT NULL REFERENCES "user" (email_address),
+
+    -- topic is the slug of a blog tag or category.
+    topic TEXT NOT NULL,
+
+    PRIMARY KEY (email_address, topic)
+);
@@ -0,0 +1,18 @@
+-- attempts is the number of failed attempts at sending the message.
+ALTER TABLE "message" ADD COLUMN attempts INTEGER NOT NULL DEFAULT 0;
+
+-- last_error is the error from the latest failed attempt, if any.
+ALTER TABLE "message" ADD COLUMN last_error TEXT NULL;
+
+-- retry_at is the earliest time a failed message is attempted again.
+ALTER TABLE "message" ADD COLUMN retry_at TIMESTAMP WITH TIME ZONE NULL;
+
+-- failed_at is set when sending the message has been given up on.
+ALTER TABLE "message" ADD COLUMN failed_at TIMESTAMP WITH TIME ZONE NULL;
+
+-- claimed_until is set while a send run is working on the message,
+-- so that concurrent runs don't attempt to send it twice.
+ALTER TABLE "message" ADD COLUMN claimed_until TIMESTAMP WITH TIME ZONE NULL;
+
+CREATE INDEX message_due_idx ON "message" (scheduled_at)
+    WHERE sent_at IS NULL AND failed_at IS NULL;
@@ -0,0 +1,25 @@
+-- campaign groups the messages scheduled together by a single send,
+-- such as the promotion of a post or a newsletter digest.
+CREATE TABLE "campaign" (
+    id BIGSERIAL PRIMARY KEY,
+
+    -- template_id is the email template the campaign sends.
+    template_id TEXT NOT NULL REFERENCES "template" (id),
+
+    -- segment is the segment the campaign was sent to, in the format of *email.Segment.
+    -- It is NULL if the campaign was sent to all subscribers.
+    segment JSONB NULL,
+
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    -- cancelled_at is when the campaign was cancelled, if it was.
+    cancelled_at TIMESTAMP WITH TIME ZONE NULL
+);
+
+-- campaign_id is the campaign the message is part of, if any.
+ALTER TABLE "message" ADD COLUMN campaign_id BIGINT NULL REFERENCES "campaign" (id);
+
+-- cancelled_at is set when an unsent message is cancelled.
+ALTER TABLE "message" ADD COLUMN cancelled_at TIMESTAMP WITH TIME ZONE NULL;
+
+CREATE INDEX message_campaign_idx ON "message" (campaign_id);
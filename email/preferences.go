@@ -0,0 +1,243 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gorilla/securecookie"
+
+	"encore.app/blog"
+	"encore.dev/beta/errs"
+	"encore.dev/storage/sqldb"
+)
+
+// Segment selects a subset of subscribers to send to.
+type Segment struct {
+	// Topics are the tag slugs the email is about.
+	// The email is sent to subscribers of any of the topics,
+	// as well as to subscribers who haven't chosen any topics.
+	Topics []string `json:"topics,omitempty"`
+}
+
+// Topic is a topic subscribers can choose to receive emails about.
+type Topic struct {
+	Slug string `json:"slug,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+type GetPreferencesParams struct {
+	// Token is the preferences token from an email.
+	Token string `json:"token,omitempty"`
+}
+
+type Preferences struct {
+	Email string `json:"email,omitempty"`
+
+	// Topics are the slugs of the topics the subscriber has chosen.
+	// If empty the subscriber receives emails about every topic.
+	Topics []string `json:"topics"`
+
+	// Available are the topics that can be chosen.
+	Available []*Topic `json:"available"`
+}
+
+// GetPreferences returns the email preferences of a subscriber.
+//encore:api public method=GET path=/email/preferences
+func GetPreferences(ctx context.Context, p *GetPreferencesParams) (*Preferences, error) {
+	email, err := decodePreferencesToken(p.Token)
+	if err != nil {
+		return nil, errs.B().Cause(err).Code(errs.InvalidArgument).Msg("invalid or expired token").Err()
+	}
+	eb := errs.B().Meta("email", email)
+
+	var topics []string
+	err = sqldb.QueryRow(ctx, `
+		SELECT COALESCE(
+			(SELECT array_agg(t.topic ORDER BY t.topic) FROM topic_subscription t WHERE t.email_address = u.email_address),
+			'{}'
+		)
+		FROM "user" u
+		WHERE u.email_address = $1
+	`, email).Scan(&topics)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, eb.Code(errs.NotFound).Msg("subscriber not found").Err()
+	} else if err != nil {
+		return nil, eb.Cause(err).Err()
+	}
+
+	available, err := availableTopics(ctx)
+	if err != nil {
+		return nil, eb.Cause(err).Msg("unable to list topics").Err()
+	}
+	return &Preferences{Email: email, Topics: topics, Available: available}, nil
+}
+
+type UpdatePreferencesParams struct {
+	// Token is the preferences token from an email.
+	Token string `json:"token,omitempty"`
+
+	// Topics are the slugs of the topics to receive emails about,
+	// replacing any previous choice. Empty means every topic.
+	Topics []string `json:"topics,omitempty"`
+}
+
+// UpdatePreferences updates the email preferences of a subscriber.
+//encore:api public method=POST path=/email/preferences
+func UpdatePreferences(ctx context.Context, p *UpdatePreferencesParams) error {
+	email, err := decodePreferencesToken(p.Token)
+	if err != nil {
+		return errs.B().Cause(err).Code(errs.InvalidArgument).Msg("invalid or expired token").Err()
+	}
+	eb := errs.B().Meta("email", email)
+
+	available, err := availableTopics(ctx)
+	if err != nil {
+		return eb.Cause(err).Msg("unable to list topics").Err()
+	}
+	known := make(map[string]bool, len(available))
+	for _, t := range available {
+		known[t.Slug] = true
+	}
+	for _, t := range p.Topics {
+		if !known[t] {
+			return eb.Code(errs.InvalidArgument).Meta("topic", t).Msg("unknown topic").Err()
+		}
+	}
+
+	tx, err := sqldb.Begin(ctx)
+	if err != nil {
+		return eb.Cause(err).Err()
+	}
+	defer tx.Rollback() // committed explicitly on success
+
+	if _, err := tx.Exec(ctx, `DELETE FROM topic_subscription WHERE email_address = $1`, email); err != nil {
+		return eb.Cause(err).Err()
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO topic_subscription (email_address, topic)
+		SELECT $1, unnest($2::text[])
+		ON CONFLICT DO NOTHING
+	`, email, p.Topics)
+	if err != nil {
+		return eb.Cause(err).Err()
+	}
+	return tx.Commit()
+}
+
+// availableTopics lists the blog tags subscribers can choose from.
+// Categories aren't offered since posts aren't in categories, only tagged.
+// Tests override it to avoid depending on blog content.
+var availableTopics = func(ctx context.Context) ([]*Topic, error) {
+	tags, err := blog.GetTags(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	topics := []*Topic{}
+	for _, t := range tags.Tags {
+		topics = append(topics, &Topic{Slug: t.Slug, Name: t.Name})
+	}
+	return topics, nil
+}
+
+const postBodyText = `{{.Post.Title}}
+
+{{with .Post.Summary}}{{.}}
+
+{{end}}Read more: {{.Post.URL}}
+
+--
+Choose which topics you get emails about: {{.PreferencesURL}}
+Unsubscribe: {{.UnsubscribeURL}}
+`
+
+const postBodyHTML = `<h1><a href="{{.Post.URL}}">{{.Post.Title}}</a></h1>
+{{with .Post.ImageURL}}<p><img src="{{.}}" alt=""></p>
+{{end}}{{with .Post.Summary}}<p>{{.}}</p>
+{{end}}<p><a href="{{.Post.URL}}">Read more</a></p>
+<hr>
+<p><a href="{{.PreferencesURL}}">Choose which topics you get emails about</a> &middot; <a href="{{.UnsubscribeURL}}">Unsubscribe</a></p>
+`
+
+type PromotePostParams struct {
+	// SendAt is the time to send the email.
+	// If nil it defaults to the current time.
+	SendAt *time.Time `json:"send_at,omitempty"`
+}
+
+// PromotePost emails a blog post to the subscribers of its tags.
+//encore:api auth method=POST path=/email/promote/:slug
+func PromotePost(ctx context.Context, slug string, p *PromotePostParams) (*ScheduleResponse, error) {
+	eb := errs.B().Meta("slug", slug)
+	post, err := blog.GetBlogPost(ctx, slug)
+	if err != nil {
+		return nil, eb.Cause(err).Msg("unable to get blog post").Err()
+	}
+	tags, err := blog.GetTagsByPost(ctx, slug)
+	if err != nil {
+		return nil, eb.Cause(err).Msg("unable to get blog post tags").Err()
+	}
+	segment := &Segment{}
+	for _, t := range tags.Tags {
+		segment.Topics = append(segment.Topics, t.Slug)
+	}
+	if post.PrimaryTag != nil {
+		segment.Topics = append(segment.Topics, post.PrimaryTag.Slug)
+	}
+
+	templateID := "post-" + slug
+	err = CreateTemplate(ctx, templateID, &CreateTemplateParams{
+		Sender:   cfg.PostSender,
+		Subject:  "{{.Post.Title}}",
+		BodyText: postBodyText,
+		BodyHTML: postBodyHTML,
+		Post: &PostData{
+			Title:    post.Title,
+			Summary:  post.Excerpt,
+			URL:      post.URL,
+			ImageURL: post.FeatureImage,
+		},
+	})
+	if err != nil {
+		return nil, eb.Cause(err).Msg("unable to create email template").Err()
+	}
+
+	resp, err := ScheduleAll(ctx, &ScheduleAllParams{
+		TemplateID: templateID,
+		SendAt:     p.SendAt,
+		Segment:    segment,
+	})
+	if err != nil {
+		return nil, eb.Cause(err).Msg("unable to schedule emails").Err()
+	}
+	return resp, nil
+}
+
+// preferencesTokenData is the unencoded data that makes up the preferences token.
+type preferencesTokenData struct {
+	Email string `json:"email,omitempty"`
+}
+
+// encodePreferencesToken encodes an email address as a preferences token using HMAC.
+func encodePreferencesToken(email string) (string, error) {
+	return preferencesCookie().Encode("preferences", preferencesTokenData{Email: email})
+}
+
+// decodePreferencesToken decodes a preferences token into the email address it contains.
+// Tokens older than the configured unsubscribe token TTL are rejected.
+func decodePreferencesToken(token string) (email string, err error) {
+	var data preferencesTokenData
+	if err := preferencesCookie().Decode("preferences", token, &data); err != nil {
+		return "", err
+	} else if data.Email == "" {
+		return "", errors.New("incomplete preferences token")
+	}
+	return canonicalEmail(data.Email), nil
+}
+
+// preferencesCookie returns the securecookie for encoding preferences tokens.
+// They are valid as long as the unsubscribe tokens sent in the same email.
+func preferencesCookie() *securecookie.SecureCookie {
+	return securecookie.New(tokenHashKey, nil).MaxAge(int(unsubscribeTTL.Seconds()))
+}
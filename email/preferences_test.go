@@ -0,0 +1,101 @@
+package email
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"encore.dev/beta/errs"
+	"encore.dev/storage/sqldb"
+)
+
+func TestTopicPreferences(t *testing.T) {
+	c := qt.New(t)
+	useTopics(c, "devops", "bytes")
+	ctx := context.Background()
+	everything, devops, bytes := "everything@topics.example.org", "devops@topics.example.org", "bytes@topics.example.org"
+	for _, email := range []string{everything, devops, bytes} {
+		subscribeConfirmed(c, ctx, email)
+	}
+
+	for email, topics := range map[string][]string{devops: {"devops"}, bytes: {"bytes"}} {
+		token, err := encodePreferencesToken(email)
+		c.Assert(err, qt.IsNil)
+		c.Assert(UpdatePreferences(ctx, &UpdatePreferencesParams{Token: token, Topics: topics}), qt.IsNil)
+	}
+
+	token, err := encodePreferencesToken(devops)
+	c.Assert(err, qt.IsNil)
+	prefs, err := GetPreferences(ctx, &GetPreferencesParams{Token: token})
+	c.Assert(err, qt.IsNil)
+	c.Assert(prefs.Topics, qt.DeepEquals, []string{"devops"})
+	c.Assert(prefs.Available, qt.HasLen, 2)
+
+	// Tokens issued before addresses were normalized still find the subscriber.
+	token, err = encodePreferencesToken(" devops@Topics.Example.org")
+	c.Assert(err, qt.IsNil)
+	prefs, err = GetPreferences(ctx, &GetPreferencesParams{Token: token})
+	c.Assert(err, qt.IsNil)
+	c.Assert(prefs.Topics, qt.DeepEquals, []string{"devops"})
+	token, err = encodePreferencesToken(devops)
+	c.Assert(err, qt.IsNil)
+
+	// Unknown topics and invalid tokens are rejected.
+	err = UpdatePreferences(ctx, &UpdatePreferencesParams{Token: token, Topics: []string{"bogus"}})
+	c.Assert(errs.Code(err), qt.Equals, errs.InvalidArgument)
+	_, err = GetPreferences(ctx, &GetPreferencesParams{Token: "bogus"})
+	c.Assert(errs.Code(err), qt.Equals, errs.InvalidArgument)
+
+	tmplID := c.Name()
+	err = CreateTemplate(ctx, tmplID, &CreateTemplateParams{
+		Sender:   "sender@example.org",
+		Subject:  "subject",
+		BodyText: "text body {{.PreferencesURL}}",
+		BodyHTML: "html body",
+	})
+	c.Assert(err, qt.IsNil)
+	_, err = ScheduleAll(ctx, &ScheduleAllParams{
+		TemplateID: tmplID,
+		Segment:    &Segment{Topics: []string{"devops", "golang"}},
+	})
+	c.Assert(err, qt.IsNil)
+
+	// Subscribers of the topic and of every topic are included.
+	recipients := scheduledRecipients(c, ctx, tmplID)
+	c.Assert(recipients, qt.Contains, everything)
+	c.Assert(recipients, qt.Contains, devops)
+	c.Assert(recipients, qt.Not(qt.Contains), bytes)
+}
+
+// useTopics makes the given topic slugs available for the duration of the test.
+func useTopics(c *qt.C, slugs ...string) {
+	orig := availableTopics
+	c.Cleanup(func() { availableTopics = orig })
+	availableTopics = func(ctx context.Context) ([]*Topic, error) {
+		var topics []*Topic
+		for _, s := range slugs {
+			topics = append(topics, &Topic{Slug: s, Name: s})
+		}
+		return topics, nil
+	}
+}
+
+// scheduledRecipients returns the sorted addresses of the messages scheduled with a template.
+func scheduledRecipients(c *qt.C, ctx context.Context, templateID string) []string {
+	rows, err := sqldb.Query(ctx, `
+		SELECT email_address FROM message WHERE template_id = $1
+	`, templateID)
+	c.Assert(err, qt.IsNil)
+	defer rows.Close()
+	var emails []string
+	for rows.Next() {
+		var email string
+		c.Assert(rows.Scan(&email), qt.IsNil)
+		emails = append(emails, email)
+	}
+	c.Assert(rows.Err(), qt.IsNil)
+	sort.Strings(emails)
+	return emails
+}
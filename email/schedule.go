@@ -7,7 +7,9 @@ import (
 
 	"golang.org/x/sync/errgroup"
 
+	"encore.dev/beta/errs"
 	"encore.dev/cron"
+	"encore.dev/rlog"
 	"encore.dev/storage/sqldb"
 )
 
@@ -26,16 +28,32 @@ type ScheduleParams struct {
 type ScheduleResponse struct {
 	// MessageIDs are the ids for the messages that were scheduled.
 	MessageIDs []int64 `json:"message_i_ds,omitempty"`
+
+	// CampaignID is the campaign the messages are part of, if any.
+	CampaignID int64 `json:"campaign_id,omitempty"`
 }
 
 // Schedule schedules emails to be sent.
 func Schedule(ctx context.Context, p *ScheduleParams) (*ScheduleResponse, error) {
+	// Normalize the addresses, sending only once to each.
+	var emails []string
+	seen := make(map[string]bool)
+	for _, addr := range p.EmailAddresses {
+		email, err := normalizeEmailArg(addr)
+		if err != nil {
+			return nil, err
+		} else if !seen[email] {
+			seen[email] = true
+			emails = append(emails, email)
+		}
+	}
+
 	// Ensure the emails all exist in the user database.
 	_, err := sqldb.Exec(ctx, `
-		INSERT INTO "user" (email_address, optin, optin_changed)
-		VALUES (unnest($1::text[]), true, NOW())
+		INSERT INTO "user" (email_address, optin, optin_changed, optin_source)
+		VALUES (unnest($1::text[]), true, NOW(), 'schedule')
 		ON CONFLICT (email_address) DO NOTHING
-	`, p.EmailAddresses)
+	`, emails)
 	if err != nil {
 		return nil, err
 	}
@@ -50,7 +68,7 @@ func Schedule(ctx context.Context, p *ScheduleParams) (*ScheduleResponse, error)
 		INSERT INTO "message" (email_address, template_id, scheduled_at)
 		VALUES (unnest($1::text[]), $2, $3)
 		RETURNING id
-	`, p.EmailAddresses, p.TemplateID, sendAt)
+	`, emails, p.TemplateID, sendAt)
 	if err != nil {
 		return nil, err
 	}
@@ -78,26 +96,63 @@ type ScheduleAllParams struct {
 	// SendAt is the time to send the email.
 	// If nil it defaults to the current time.
 	SendAt *time.Time `json:"send_at,omitempty"`
+
+	// Segment optionally limits which subscribers the email is sent to.
+	// If nil it is sent to all subscribers.
+	Segment *Segment `json:"segment,omitempty"`
 }
 
-// ScheduleAll schedules emails to be sent to all subscribers.
+// ScheduleAll schedules emails to be sent to all subscribers,
+// or the subscribers in a segment, as a new campaign.
 //encore:api private
 func ScheduleAll(ctx context.Context, p *ScheduleAllParams) (*ScheduleResponse, error) {
-	// Schedule the email messages to be sent.
+	eb := errs.B().Meta("template_id", p.TemplateID)
 	sendAt := time.Now()
 	if p.SendAt != nil {
 		sendAt = *p.SendAt
 	}
+	topics := []string{}
+	if p.Segment != nil && p.Segment.Topics != nil {
+		topics = p.Segment.Topics
+	}
+	segment, err := marshalNullable(p.Segment)
+	if err != nil {
+		return nil, eb.Cause(err).Err()
+	}
 
-	rows, err := sqldb.Query(ctx, `
-		INSERT INTO "message" (email_address, template_id, scheduled_at)
-		SELECT email_address, $1, $2
-			FROM "user"
-			WHERE optin
+	tx, err := sqldb.Begin(ctx)
+	if err != nil {
+		return nil, eb.Cause(err).Err()
+	}
+	defer tx.Rollback() // committed explicitly on success
+
+	var campaignID int64
+	err = tx.QueryRow(ctx, `
+		INSERT INTO "campaign" (template_id, segment)
+		VALUES ($1, $2)
 		RETURNING id
-	`, p.TemplateID, sendAt)
+	`, p.TemplateID, segment).Scan(&campaignID)
 	if err != nil {
-		return nil, err
+		return nil, eb.Cause(err).Msg("unable to create campaign").Err()
+	}
+
+	// Schedule the email messages to be sent.
+	rows, err := tx.Query(ctx, `
+		INSERT INTO "message" (email_address, template_id, scheduled_at, campaign_id)
+		SELECT u.email_address, $1, $2, $5
+			FROM "user" u
+			WHERE u.optin
+			AND (NOT $3 OR NOT EXISTS (
+				SELECT 1 FROM topic_subscription t
+				WHERE t.email_address = u.email_address
+			) OR EXISTS (
+				SELECT 1 FROM topic_subscription t
+				WHERE t.email_address = u.email_address AND t.topic = ANY($4::text[])
+			))
+		RETURNING id
+	`, p.TemplateID, sendAt, p.Segment != nil, topics, campaignID)
+	if err != nil {
+		return nil, eb.Cause(err).Err()
 	}
 	defer rows.Close()
 
@@ -105,57 +160,106 @@ func ScheduleAll(ctx context.Context, p *ScheduleAllParams) (*ScheduleResponse,
 	for rows.Next() {
 		var id int64
 		if err := rows.Scan(&id); err != nil {
-			return nil, err
+			return nil, eb.Cause(err).Err()
 		}
 		ids = append(ids, id)
 	}
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, eb.Cause(err).Err()
+	}
+	rows.Close()
+	if err := tx.Commit(); err != nil {
+		return nil, eb.Cause(err).Err()
 	}
 
-	return &ScheduleResponse{MessageIDs: ids}, nil
+	return &ScheduleResponse{MessageIDs: ids, CampaignID: campaignID}, nil
 }
 
 type CreateTemplateParams struct {
 	Sender   string `json:"sender,omitempty"`    // sender email
-	Subject  string `json:"subject,omitempty"`   // subject line to use
-	BodyText string `json:"body_text,omitempty"` // plaintext body
-	BodyHTML string `json:"body_html,omitempty"` // html body
+	Subject  string `json:"subject,omitempty"`   // subject line template
+	BodyText string `json:"body_text,omitempty"` // plaintext body template
+	BodyHTML string `json:"body_html,omitempty"` // html body template
+
+	// Post is the post the email is about, if any.
+	// It is available to the templates as {{.Post}}.
+	Post *PostData `json:"post,omitempty"`
+
+	// Digest is the content of a newsletter digest, if any.
+	// It is available to the templates as {{.Digest}}.
+	Digest *DigestData `json:"digest,omitempty"`
 }
 
 // CreateTemplate creates an email template.
 // If the template with that id already exists it is updated.
+// The subject and bodies are Go templates rendered with TemplateData.
 //encore:api private method=PUT path=/email/templates/:id
 func CreateTemplate(ctx context.Context, id string, p *CreateTemplateParams) error {
-	_, err := sqldb.Exec(ctx, `
-		INSERT INTO "template" (id, sender, subject, body_text, body_html)
-		VALUES ($1, $2, $3, $4, $5)
+	eb := errs.B().Meta("template_id", id)
+	if err := validateTemplate(p); err != nil {
+		return eb.Cause(err).Code(errs.InvalidArgument).Msg("invalid template").Err()
+	}
+	post, err := marshalNullable(p.Post)
+	if err != nil {
+		return eb.Cause(err).Err()
+	}
+	digest, err := marshalNullable(p.Digest)
+	if err != nil {
+		return eb.Cause(err).Err()
+	}
+
+	_, err = sqldb.Exec(ctx, `
+		INSERT INTO "template" (id, sender, subject, body_text, body_html, post, digest)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		ON CONFLICT (id) DO UPDATE SET
-		sender = $2, subject = $3, body_text = $4, body_html = $5, updated_at = NOW()
-	`, id, p.Sender, p.Subject, p.BodyText, p.BodyHTML)
+		sender = $2, subject = $3, body_text = $4, body_html = $5, post = $6, digest = $7, updated_at = NOW()
+	`, id, p.Sender, p.Subject, p.BodyText, p.BodyHTML, post, digest)
 	return err
 }
 
 type SendDueEmailsResponse struct {
-	NumSent int // number of emails successfully sent
+	NumSent   int // number of emails successfully sent
+	NumFailed int // number of emails that failed to send
 }
 
+// claimLease is how long a send run may work on the messages it claimed
+// before other runs consider them abandoned and may claim them again.
+const claimLease = 5 * time.Minute
+
 // SendDueEmails sends emails that are due to for delivery.
+// It sends at most cfg.Sending.Concurrency emails in parallel and
+// no more than cfg.Sending.PerMinute emails per minute.
 //encore:api private method=POST path=/email/send-due
 func SendDueEmails(ctx context.Context) (*SendDueEmailsResponse, error) {
-	ids, err := queryDueEmails(ctx, time.Now())
+	budget, err := sendBudget(ctx)
+	if err != nil {
+		return nil, err
+	} else if budget <= 0 {
+		return &SendDueEmailsResponse{}, nil
+	}
+	ids, err := queryDueEmails(ctx, time.Now(), budget)
 	if err != nil && len(ids) == 0 {
 		return nil, err
 	}
 
-	g, ctx := errgroup.WithContext(ctx)
-	var successes int64
+	var (
+		g                   errgroup.Group
+		sem                 = make(chan struct{}, cfg.Sending.Concurrency)
+		successes, failures int64
+	)
 	for _, id := range ids {
 		id := id // capture for closure
+		sem <- struct{}{}
 		g.Go(func() error {
+			defer func() { <-sem }()
 			_, err := Send(ctx, id)
 			if err == nil {
 				atomic.AddInt64(&successes, 1)
+				return nil
+			}
+			atomic.AddInt64(&failures, 1)
+			if err := recordSendFailure(ctx, id, err); err != nil {
+				rlog.Error("failed to record send failure", "err", err, "message_id", id)
 			}
 			return err
 		})
@@ -166,17 +270,44 @@ func SendDueEmails(ctx context.Context) (*SendDueEmailsResponse, error) {
 		// If we successfully sent some emails always treat it as successful.
 		err = nil
 	}
-	return &SendDueEmailsResponse{NumSent: int(successes)}, err
+	return &SendDueEmailsResponse{NumSent: int(successes), NumFailed: int(failures)}, err
 }
 
-// queryDueEmails reports the message ids that are due to be sent at time t.
-func queryDueEmails(ctx context.Context, t time.Time) (ids []int64, err error) {
-	rows, err := sqldb.Query(ctx, `
-		SELECT id
+// sendBudget reports how many more emails may be sent this minute.
+// Messages claimed by runs that haven't sent them yet count against it,
+// so that concurrent runs don't each use the whole budget.
+func sendBudget(ctx context.Context) (int, error) {
+	var recent, claimed int
+	err := sqldb.QueryRow(ctx, `
+		SELECT
+			COUNT(*) FILTER (WHERE sent_at > NOW() - INTERVAL '1 minute'),
+			COUNT(*) FILTER (WHERE sent_at IS NULL AND claimed_until > NOW())
 		FROM message
-		WHERE sent_at IS NULL AND scheduled_at <= $1
-		LIMIT 100
-	`, t)
+		WHERE sent_at > NOW() - INTERVAL '1 minute' OR claimed_until > NOW()
+	`).Scan(&recent, &claimed)
+	if err != nil {
+		return 0, err
+	}
+	return cfg.Sending.PerMinute - recent - claimed, nil
+}
+
+// queryDueEmails claims up to limit messages that are due to be sent at time t,
+// and reports their ids. Messages claimed by a concurrent run are skipped.
+func queryDueEmails(ctx context.Context, t time.Time, limit int) (ids []int64, err error) {
+	rows, err := sqldb.Query(ctx, `
+		UPDATE message SET claimed_until = $2
+		WHERE id IN (
+			SELECT id
+			FROM message
+			WHERE sent_at IS NULL AND failed_at IS NULL AND cancelled_at IS NULL AND scheduled_at <= $1
+			AND (retry_at IS NULL OR retry_at <= $1)
+			AND (claimed_until IS NULL OR claimed_until <= $1)
+			ORDER BY scheduled_at, id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id
+	`, t, t.Add(claimLease), limit)
 	if err != nil {
 		return nil, err
 	}
@@ -192,6 +323,22 @@ func queryDueEmails(ctx context.Context, t time.Time) (ids []int64, err error) {
 	return ids, rows.Err()
 }
 
+// recordSendFailure records a failed attempt at sending a message.
+// The message is retried with exponential backoff until it has been
+// attempted cfg.Sending.MaxAttempts times, after which it is marked as failed.
+func recordSendFailure(ctx context.Context, id int64, sendErr error) error {
+	_, err := sqldb.Exec(ctx, `
+		UPDATE message SET
+			attempts = attempts + 1,
+			last_error = $2,
+			claimed_until = NULL,
+			retry_at = NOW() + $3 * power(2, attempts) * INTERVAL '1 second',
+			failed_at = CASE WHEN attempts + 1 >= $4 THEN NOW() END
+		WHERE id = $1
+	`, id, sendErr.Error(), retryBackoff.Seconds(), cfg.Sending.MaxAttempts)
+	return err
+}
+
 // Send emails due to be delivered every minute.
 var _ = cron.NewJob("send-due-emails", cron.JobConfig{
 	Title:    "Send due emails",
@@ -2,12 +2,14 @@ package email
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
 	qt "github.com/frankban/quicktest"
 
 	"encore.dev/beta/auth"
+	"encore.dev/storage/sqldb"
 )
 
 func TestQueryDueEmails(t *testing.T) {
@@ -40,7 +42,86 @@ func TestQueryDueEmails(t *testing.T) {
 	c.Assert(err, qt.IsNil)
 
 	// The first two emails should be due now, but not the third.
-	due, err := queryDueEmails(ctx, now)
+	budget, err := sendBudget(ctx)
+	c.Assert(err, qt.IsNil)
+	due, err := queryDueEmails(ctx, now, 100)
 	c.Assert(err, qt.IsNil)
 	c.Assert(due, qt.DeepEquals, scheduled.MessageIDs)
+
+	// Claimed emails count against the budget until they're sent.
+	left, err := sendBudget(ctx)
+	c.Assert(err, qt.IsNil)
+	c.Assert(left, qt.Equals, budget-len(due))
+
+	// Claimed emails aren't returned again until the claim expires.
+	due, err = queryDueEmails(ctx, now, 100)
+	c.Assert(err, qt.IsNil)
+	c.Assert(due, qt.HasLen, 0)
+}
+
+func TestSendRetries(t *testing.T) {
+	c := qt.New(t)
+	ctx := auth.WithContext(context.Background(), "user-id", nil)
+
+	orig := transport
+	c.Cleanup(func() { transport = orig })
+	transport = failingTransport{}
+
+	tmplID := c.Name()
+	err := CreateTemplate(ctx, tmplID, &CreateTemplateParams{
+		Sender:   "sender@example.org",
+		Subject:  "subject",
+		BodyText: "text body",
+		BodyHTML: "html body",
+	})
+	c.Assert(err, qt.IsNil)
+	sendAt := time.Now().Add(-time.Hour)
+	scheduled, err := Schedule(ctx, &ScheduleParams{
+		TemplateID:     tmplID,
+		EmailAddresses: []string{"retry@example.org"},
+		SendAt:         &sendAt,
+	})
+	c.Assert(err, qt.IsNil)
+	id := scheduled.MessageIDs[0]
+
+	_, err = Send(ctx, id)
+	c.Assert(err, qt.Not(qt.IsNil))
+	c.Assert(recordSendFailure(ctx, id, err), qt.IsNil)
+
+	// The message is retried only after the backoff.
+	c.Assert(isDue(c, ctx, id, time.Now()), qt.IsFalse)
+	c.Assert(isDue(c, ctx, id, time.Now().Add(2*retryBackoff)), qt.IsTrue)
+
+	// After too many attempts the message is given up on.
+	for i := 1; i < cfg.Sending.MaxAttempts; i++ {
+		c.Assert(recordSendFailure(ctx, id, err), qt.IsNil)
+	}
+	var attempts int
+	var failedAt *time.Time
+	err = sqldb.QueryRow(ctx, `
+		SELECT attempts, failed_at FROM message WHERE id = $1
+	`, id).Scan(&attempts, &failedAt)
+	c.Assert(err, qt.IsNil)
+	c.Assert(attempts, qt.Equals, cfg.Sending.MaxAttempts)
+	c.Assert(failedAt, qt.Not(qt.IsNil))
+	c.Assert(isDue(c, ctx, id, time.Now().Add(24*time.Hour*365)), qt.IsFalse)
+}
+
+// isDue reports whether queryDueEmails returns the message at time t.
+func isDue(c *qt.C, ctx context.Context, id int64, t time.Time) bool {
+	due, err := queryDueEmails(ctx, t, 1000)
+	c.Assert(err, qt.IsNil)
+	for _, d := range due {
+		if d == id {
+			return true
+		}
+	}
+	return false
+}
+
+// failingTransport is a Transport that always fails.
+type failingTransport struct{}
+
+func (failingTransport) Send(ctx context.Context, m *Mail) (string, error) {
+	return "", errors.New("delivery failed")
 }
@@ -2,11 +2,9 @@ package email
 
 import (
 	"context"
-	"strings"
+	"net/url"
 	"time"
 
-	"github.com/mailgun/mailgun-go/v4"
-
 	"encore.dev/beta/errs"
 	"encore.dev/rlog"
 	"encore.dev/storage/sqldb"
@@ -38,34 +36,65 @@ func Send(ctx context.Context, messageID int64) (*SendResponse, error) {
 		return nil, eb.Cause(err).Err()
 	}
 
+	// Don't send the same message twice, for example if
+	// it was sent by a concurrent run while we waited for the lock.
+	if m.ProviderID != nil {
+		return &SendResponse{Sent: true, ProviderID: *m.ProviderID}, nil
+	}
+
+	// The message may have been cancelled while we waited for the lock.
+	if m.Cancelled {
+		return &SendResponse{Sent: false}, nil
+	}
+
 	// Ensure the user exists and is opted in.
 	if status, err := isOptedIn(ctx, m.EmailAddress); err != nil {
 		return nil, eb.Cause(err).Err()
 	} else if !status {
+		// Stop trying to send the message.
+		_, err := tx.Exec(ctx, `
+			UPDATE message SET failed_at = NOW(), last_error = 'recipient is not opted in', claimed_until = NULL
+			WHERE id = $1
+		`, m.ID)
+		if err != nil {
+			return nil, eb.Cause(err).Err()
+		} else if err := tx.Commit(); err != nil {
+			return nil, eb.Cause(err).Err()
+		}
 		return &SendResponse{Sent: false}, nil
 	}
 
-	token, err := encodeUnsubscribeToken(m.EmailAddress, m.ID)
+	// Render the template for the recipient.
+	data, err := templateData(Recipient{Email: m.EmailAddress, Name: m.RecipientName}, m.ID, m.Post, m.Digest)
 	if err != nil {
-		return nil, err
+		return nil, eb.Cause(err).Err()
+	}
+	r, err := renderTemplate(m.Subject, m.BodyText, m.BodyHTML, data)
+	if err != nil {
+		return nil, eb.Cause(err).Msg("unable to render template").Err()
 	}
 
-	// Add the token to the email.
-	plaintext := strings.ReplaceAll(string(m.BodyText), "{{Token}}", token)
-	html := strings.ReplaceAll(string(m.BodyHTML), "{{Token}}", token)
-
-	mg := mailgun.NewMailgun(cfg.MailgunDomain, secrets.MailGunAPIKey)
-	msg := mg.NewMessage(m.Sender, m.Subject, plaintext, m.EmailAddress)
-	msg.SetTrackingOpens(true)
-	msg.SetTrackingClicks(false)
-	msg.SetHtml(html)
+	// Support RFC 8058 one-click unsubscribe from the mail client.
+	oneClick := cfg.APIURL + "/email/unsubscribe/one-click?token=" + url.QueryEscape(data.Token)
+	mail := &Mail{
+		From:    m.Sender,
+		To:      m.EmailAddress,
+		Subject: r.Subject,
+		Text:    r.BodyText,
+		HTML:    r.BodyHTML,
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + oneClick + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+		TrackOpens: true,
+	}
 
 	// Use a different context for sending so we don't accidentally
 	// send duplicate mails if the client disconnects.
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
-	mailgunID, err := sendEmail(ctx, mg, msg)
+	providerID, err := transport.Send(ctx, mail)
 	if err != nil {
 		return nil, eb.Cause(err).Code(errs.Unavailable).Err()
 	}
@@ -75,22 +104,15 @@ func Send(ctx context.Context, messageID int64) (*SendResponse, error) {
 		UPDATE message
 		SET provider_id = $2, sent_at = NOW()
 		WHERE id = $1
-	`, m.ID, mailgunID)
+	`, m.ID, providerID)
 	if err != nil {
-		rlog.Error("failed to store mailgun id", "err", err)
+		rlog.Error("failed to store provider id", "err", err)
 	}
 	if err := tx.Commit(); err != nil {
 		rlog.Error("failed to commit tx", "err", err)
 	}
 
-	return &SendResponse{Sent: true, ProviderID: mailgunID}, nil
-}
-
-// sendEmail sends an email using mailgun.
-// It is a variable to allow for mocking in tests.
-var sendEmail = func(ctx context.Context, mg *mailgun.MailgunImpl, msg *mailgun.Message) (providerID string, err error) {
-	_, mailgunID, err := mg.Send(ctx, msg)
-	return mailgunID, err
+	return &SendResponse{Sent: true, ProviderID: providerID}, nil
 }
 
 // message represents a single email message to be sent.
@@ -98,23 +120,41 @@ type message struct {
 	ID           int64   `json:"id,omitempty"` // message id
 	EmailAddress string  `json:"email_address,omitempty"`
 	ProviderID   *string `json:"provider_id,omitempty"` // nil if not yet sent
+	Cancelled    bool    `json:"cancelled,omitempty"`
+
+	// RecipientName is the name of the recipient, if known.
+	RecipientName string `json:"recipient_name,omitempty"`
 
 	// Inlined template data
-	Sender   string `json:"sender,omitempty"`
-	Subject  string `json:"subject,omitempty"`
-	BodyText string `json:"body_text,omitempty"`
-	BodyHTML string `json:"body_html,omitempty"`
+	Sender   string      `json:"sender,omitempty"`
+	Subject  string      `json:"subject,omitempty"`
+	BodyText string      `json:"body_text,omitempty"`
+	BodyHTML string      `json:"body_html,omitempty"`
+	Post     *PostData   `json:"post,omitempty"`
+	Digest   *DigestData `json:"digest,omitempty"`
 }
 
 // lockMessage reads a message from the database and locks it for the duration of the tx.
 func lockMessage(ctx context.Context, tx *sqldb.Tx, id int64) (*message, error) {
-	var m message
+	var (
+		m            message
+		post, digest []byte
+	)
 	err := tx.QueryRow(ctx, `
-		SELECT m.id, m.email_address, m.provider_id, t.sender, t.subject, t.body_text, t.body_html
+		SELECT m.id, m.email_address, m.provider_id, m.cancelled_at IS NOT NULL, u.name, t.sender, t.subject, t.body_text, t.body_html, t.post, t.digest
 		FROM message m
 		INNER JOIN template t ON (t.id = m.template_id)
+		INNER JOIN "user" u ON (u.email_address = m.email_address)
 		WHERE m.id = $1
-		FOR UPDATE
-	`, id).Scan(&m.ID, &m.EmailAddress, &m.ProviderID, &m.Sender, &m.Subject, &m.BodyText, &m.BodyHTML)
-	return &m, err
+		FOR UPDATE OF m
+	`, id).Scan(&m.ID, &m.EmailAddress, &m.ProviderID, &m.Cancelled, &m.RecipientName, &m.Sender, &m.Subject, &m.BodyText, &m.BodyHTML, &post, &digest)
+	if err != nil {
+		return nil, err
+	}
+	if err := unmarshalNullable(post, &m.Post); err != nil {
+		return nil, err
+	} else if err := unmarshalNullable(digest, &m.Digest); err != nil {
+		return nil, err
+	}
+	return &m, nil
 }
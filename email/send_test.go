@@ -2,17 +2,21 @@ package email
 
 import (
 	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	qt "github.com/frankban/quicktest"
-	"github.com/mailgun/mailgun-go/v4"
 
 	"encore.dev/beta/auth"
 )
 
 func TestEndToEnd(t *testing.T) {
 	c := qt.New(t)
-	sent := useSendMock(c)
+	sent := useFakeSMTP(c)
 	ctx := auth.WithContext(context.Background(), "user-id", nil)
 
 	// Create an email template
@@ -37,20 +41,115 @@ func TestEndToEnd(t *testing.T) {
 	for _, id := range scheduled.MessageIDs {
 		resp, err := Send(ctx, id)
 		c.Assert(err, qt.IsNil)
-		c.Assert(resp, qt.DeepEquals, &SendResponse{Sent: true, ProviderID: "msg-id"})
+		c.Assert(resp.Sent, qt.IsTrue)
+		c.Assert(resp.ProviderID, qt.Not(qt.Equals), "")
 	}
 	c.Assert(*sent, qt.HasLen, len(scheduled.MessageIDs))
+	c.Assert((*sent)[0].Data, qt.Contains, "List-Unsubscribe-Post: List-Unsubscribe=One-Click")
 }
 
-func useSendMock(c *qt.C) *[]*mailgun.Message {
-	var msgs []*mailgun.Message
-	orig := sendEmail
-	sendEmail = func(ctx context.Context, mg *mailgun.MailgunImpl, msg *mailgun.Message) (providerID string, err error) {
-		msgs = append(msgs, msg)
-		return "msg-id", nil
-	}
+func TestSMTPTransportCancel(t *testing.T) {
+	c := qt.New(t)
+	// A server that accepts connections but never responds.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, qt.IsNil)
+	c.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.Cleanup(func() { conn.Close() })
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	t0 := time.Now()
+	tr := &smtpTransport{Addr: ln.Addr().String()}
+	_, err = tr.Send(ctx, &Mail{From: "sender@example.org", To: "john@example.org", Subject: "subject", Text: "text"})
+	c.Assert(err, qt.ErrorIs, context.DeadlineExceeded)
+	c.Assert(time.Since(t0) < 5*time.Second, qt.IsTrue)
+}
+
+// receivedMail is an email received by the fake SMTP server.
+type receivedMail struct {
+	From string
+	To   []string
+	Data string
+}
+
+// useFakeSMTP starts a fake SMTP server and sends emails to it using
+// the smtp transport for the duration of the test.
+// It reports the emails the server received.
+func useFakeSMTP(c *qt.C) *[]*receivedMail {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, qt.IsNil)
+
+	var (
+		mu   sync.Mutex
+		msgs []*receivedMail
+	)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, func(m *receivedMail) {
+				mu.Lock()
+				defer mu.Unlock()
+				msgs = append(msgs, m)
+			})
+		}
+	}()
+
+	orig := transport
+	transport = &smtpTransport{Addr: ln.Addr().String()}
 	c.Cleanup(func() {
-		sendEmail = orig
+		transport = orig
+		ln.Close()
 	})
 	return &msgs
 }
+
+// serveSMTP implements just enough of SMTP to receive emails from net/smtp.
+func serveSMTP(conn net.Conn, deliver func(*receivedMail)) {
+	defer conn.Close()
+	tc := textproto.NewConn(conn)
+	tc.PrintfLine("220 localhost fake SMTP")
+
+	var m *receivedMail
+	for {
+		line, err := tc.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			tc.PrintfLine("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			m = &receivedMail{From: strings.Trim(line[len("MAIL FROM:"):], "<> ")}
+			tc.PrintfLine("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			m.To = append(m.To, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			tc.PrintfLine("250 OK")
+		case cmd == "DATA":
+			tc.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := tc.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			m.Data = string(data)
+			deliver(m)
+			tc.PrintfLine("250 OK")
+		case cmd == "QUIT":
+			tc.PrintfLine("221 Bye")
+			return
+		default:
+			tc.PrintfLine("250 OK")
+		}
+	}
+}
@@ -3,28 +3,101 @@ package email
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"log"
+	"net/http"
 
 	"github.com/gorilla/securecookie"
 
+	"encore.app/ratelimit"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
 	"encore.dev/storage/sqldb"
 )
 
 type SubscribeParams struct {
 	Email string `json:"email,omitempty"`
+	Name  string `json:"name,omitempty"` // optional name of the subscriber
+
+	// Website is a honeypot field that the subscribe form hides from people.
+	// Requests that fill it in are assumed to come from bots and are ignored.
+	Website string `json:"website,omitempty"`
+
+	// ForwardedFor identifies the client for rate limiting.
+	// It is set from the X-Forwarded-For header.
+	ForwardedFor string `json:"-"`
 }
 
+// subscribeRate and subscribeBurst limit how often a client may subscribe.
+const (
+	subscribeRate  = 5.0 / 3600 // 5 per hour
+	subscribeBurst = 5
+)
+
 // Subscribe subscribes to the email newsletter for a given email.
-//encore:api public method=POST path=/email/subscribe
-func Subscribe(ctx context.Context, p *SubscribeParams) error {
-	_, err := sqldb.Exec(ctx, `
-		INSERT INTO "user" (email_address, optin)
-		VALUES ($1, true)
+// The subscription is pending until it is confirmed using the link
+// in the confirmation email that is sent to the address.
+// It takes SubscribeParams as JSON, and is raw so that it can set
+// the Retry-After header when rate limited.
+//encore:api public raw method=POST path=/email/subscribe
+func Subscribe(w http.ResponseWriter, req *http.Request) {
+	var p SubscribeParams
+	if err := json.NewDecoder(req.Body).Decode(&p); err != nil {
+		errs.HTTPError(w, errs.B().Code(errs.InvalidArgument).Cause(err).Msg("invalid request body").Err())
+		return
+	}
+	p.ForwardedFor = req.Header.Get("X-Forwarded-For")
+	if err := subscribe(req.Context(), &p); err != nil {
+		if retry, ok := errs.Details(err).(ratelimit.RetryAfter); ok {
+			retry.SetHeader(w.Header())
+		}
+		errs.HTTPError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// subscribe subscribes email to the newsletter, pending confirmation.
+func subscribe(ctx context.Context, p *SubscribeParams) error {
+	err := ratelimit.Take(ctx, &ratelimit.TakeParams{
+		Route:        "email.Subscribe",
+		ForwardedFor: p.ForwardedFor,
+		Rate:         subscribeRate,
+		Burst:        subscribeBurst,
+	})
+	if errs.Code(err) == errs.ResourceExhausted {
+		return err
+	} else if err != nil {
+		// Don't stop people from subscribing because of the rate limiter.
+		rlog.Error("failed to rate limit subscribe", "err", err)
+	}
+	if p.Website != "" {
+		// Pretend to succeed so bots don't learn about the honeypot.
+		return nil
+	}
+
+	email, err := normalizeEmailArg(p.Email)
+	if err != nil {
+		return err
+	}
+
+	var optin bool
+	err = sqldb.QueryRow(ctx, `
+		INSERT INTO "user" (email_address, name, optin, optin_source, pending_since)
+		VALUES ($1, $2, false, 'website', NOW())
 		ON CONFLICT (email_address) DO UPDATE
-		SET optin = true, optin_changed = NOW()
-	`, p.Email)
-	return err
+		SET pending_since = CASE WHEN "user".optin THEN NULL ELSE NOW() END,
+			name = CASE WHEN NOT "user".optin AND $2 <> '' THEN $2 ELSE "user".name END
+		RETURNING optin
+	`, email, p.Name).Scan(&optin)
+	if err != nil {
+		return err
+	} else if optin {
+		// Already subscribed, nothing to confirm.
+		return nil
+	}
+	return sendConfirmation(ctx, email)
 }
 
 // getAllSubscribers returns all the subscribers to the email newsletter.
@@ -56,9 +129,29 @@ type UnsubscribeParams struct {
 // Unsubscribe unsubscribes the user from the email list.
 //encore:api public method=POST path=/email/unsubscribe
 func Unsubscribe(ctx context.Context, params *UnsubscribeParams) error {
-	email, emailID, err := decodeUnsubscribeToken(params.Token)
+	return unsubscribe(ctx, params.Token)
+}
+
+// OneClickUnsubscribe handles RFC 8058 one-click unsubscribe requests
+// made by mail clients using the List-Unsubscribe header of an email.
+//encore:api public raw method=POST path=/email/unsubscribe/one-click
+func OneClickUnsubscribe(w http.ResponseWriter, req *http.Request) {
+	if req.PostFormValue("List-Unsubscribe") != "One-Click" {
+		errs.HTTPError(w, errs.B().Code(errs.InvalidArgument).Msg("not a one-click unsubscribe request").Err())
+		return
+	}
+	if err := unsubscribe(req.Context(), req.URL.Query().Get("token")); err != nil {
+		errs.HTTPError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// unsubscribe unsubscribes the user identified by the unsubscribe token.
+func unsubscribe(ctx context.Context, token string) error {
+	email, emailID, err := decodeUnsubscribeToken(token)
 	if err != nil {
-		return err
+		return errs.B().Cause(err).Code(errs.InvalidArgument).Msg("invalid or expired token").Err()
 	}
 	_, err = sqldb.Exec(ctx, `
 		UPDATE "user" SET optin = false, optin_changed = NOW()
@@ -97,21 +190,31 @@ type unsubscribeTokenData struct {
 
 // encodeUnsubscribeToken encodes an email address and message id as a token using HMAC.
 func encodeUnsubscribeToken(email string, messageID int64) (string, error) {
-	return tokenCookie.Encode("token", unsubscribeTokenData{Email: email, MessageID: messageID})
+	return unsubscribeCookie().Encode("token", unsubscribeTokenData{Email: email, MessageID: messageID})
 }
 
 // decodeUnsubscribeToken decodes a token into the email and message id that it contains.
+// Tokens older than the configured unsubscribe token TTL are rejected.
 func decodeUnsubscribeToken(token string) (email string, messageID int64, err error) {
 	var data unsubscribeTokenData
-	err = tokenCookie.Decode("token", token, &data)
-	return data.Email, data.MessageID, nil
+	if err := unsubscribeCookie().Decode("token", token, &data); err != nil {
+		return "", 0, err
+	} else if data.Email == "" || data.MessageID == 0 {
+		return "", 0, errors.New("incomplete unsubscribe token")
+	}
+	return canonicalEmail(data.Email), data.MessageID, nil
 }
 
-// tokenCookie is the securecookie for encoding email unsubscribe tokens.
-var tokenCookie = func() *securecookie.SecureCookie {
+// tokenHashKey is the decoded key for signing email tokens.
+var tokenHashKey = func() []byte {
 	hashKey, err := base64.RawURLEncoding.DecodeString(secrets.TokenHashKey)
 	if err != nil {
 		log.Fatalln("bad TokenHashKey:", err)
 	}
-	return securecookie.New(hashKey, nil)
+	return hashKey
 }()
+
+// unsubscribeCookie returns the securecookie for encoding email unsubscribe tokens.
+func unsubscribeCookie() *securecookie.SecureCookie {
+	return securecookie.New(tokenHashKey, nil).MaxAge(int(unsubscribeTTL.Seconds()))
+}
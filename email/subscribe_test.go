@@ -0,0 +1,95 @@
+package email
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"encore.dev/beta/errs"
+)
+
+func TestUnsubscribeInvalidToken(t *testing.T) {
+	c := qt.New(t)
+	err := Unsubscribe(context.Background(), &UnsubscribeParams{Token: "bogus"})
+	c.Assert(errs.Code(err), qt.Equals, errs.InvalidArgument)
+
+	// A validly signed token without a message is rejected too.
+	token, err := encodeUnsubscribeToken("john@example.org", 0)
+	c.Assert(err, qt.IsNil)
+	err = Unsubscribe(context.Background(), &UnsubscribeParams{Token: token})
+	c.Assert(errs.Code(err), qt.Equals, errs.InvalidArgument)
+}
+
+func TestOneClickUnsubscribe(t *testing.T) {
+	c := qt.New(t)
+	useFakeSMTP(c)
+	ctx := context.Background()
+	email := "one-click@example.org"
+	subscribeConfirmed(c, ctx, email)
+
+	tmplID := c.Name()
+	err := CreateTemplate(ctx, tmplID, &CreateTemplateParams{
+		Sender:   "sender@example.org",
+		Subject:  "subject",
+		BodyText: "text body",
+		BodyHTML: "html body",
+	})
+	c.Assert(err, qt.IsNil)
+	scheduled, err := Schedule(ctx, &ScheduleParams{
+		TemplateID:     tmplID,
+		EmailAddresses: []string{email},
+	})
+	c.Assert(err, qt.IsNil)
+
+	token, err := encodeUnsubscribeToken(email, scheduled.MessageIDs[0])
+	c.Assert(err, qt.IsNil)
+	body := url.Values{"List-Unsubscribe": []string{"One-Click"}}.Encode()
+	req := httptest.NewRequest("POST", "/email/unsubscribe/one-click?token="+url.QueryEscape(token), strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	OneClickUnsubscribe(w, req)
+	c.Assert(w.Code, qt.Equals, http.StatusOK)
+
+	optedIn, err := isOptedIn(ctx, email)
+	c.Assert(err, qt.IsNil)
+	c.Assert(optedIn, qt.IsFalse)
+}
+
+func TestSubscribeHoneypot(t *testing.T) {
+	c := qt.New(t)
+	sent := useFakeSMTP(c)
+	ctx := context.Background()
+	email := "bot@honeypot.example.org"
+
+	err := subscribe(ctx, &SubscribeParams{Email: email, Website: "http://spam.example.org", ForwardedFor: "192.0.2.3"})
+	c.Assert(err, qt.IsNil)
+	c.Assert(*sent, qt.HasLen, 0)
+
+	list, err := ListSubscribers(ctx, &ListSubscribersParams{Query: email, All: true})
+	c.Assert(err, qt.IsNil)
+	c.Assert(list.Subscribers, qt.HasLen, 0)
+}
+
+func TestSubscribeRetryAfter(t *testing.T) {
+	c := qt.New(t)
+	// Invalid addresses are rate limited before they are rejected,
+	// so no confirmation emails are sent.
+	post := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/email/subscribe", strings.NewReader(`{"email": "not an email"}`))
+		req.Header.Set("X-Forwarded-For", "192.0.2.4")
+		w := httptest.NewRecorder()
+		Subscribe(w, req)
+		return w
+	}
+	for i := 0; i < subscribeBurst; i++ {
+		c.Assert(post().Code, qt.Equals, http.StatusBadRequest)
+	}
+	w := post()
+	c.Assert(w.Code, qt.Equals, http.StatusTooManyRequests)
+	c.Assert(w.Header().Get("Retry-After"), qt.Not(qt.Equals), "")
+}
@@ -0,0 +1,185 @@
+package email
+
+import (
+	"context"
+	"time"
+
+	"encore.dev/beta/errs"
+	"encore.dev/storage/sqldb"
+)
+
+// Subscriber describes a newsletter subscriber and their opt-in history.
+type Subscriber struct {
+	Email        string    `json:"email,omitempty"`
+	Name         string    `json:"name,omitempty"`
+	OptIn        bool      `json:"optin,omitempty"`
+	OptInChanged time.Time `json:"optin_changed,omitempty"`
+	OptInSource  string    `json:"optin_source,omitempty"` // how the subscriber opted in, such as "website" or "import"
+	Pending      bool      `json:"pending,omitempty"`      // awaiting confirmation
+
+	// Unsubscribes are the times the subscriber unsubscribed, newest first.
+	Unsubscribes []time.Time `json:"unsubscribes,omitempty"`
+}
+
+type ListSubscribersParams struct {
+	// Query optionally filters subscribers by a substring of their email or name.
+	Query string `json:"query,omitempty"`
+
+	// All includes subscribers that have opted out or are pending.
+	All bool `json:"all,omitempty"`
+
+	Limit  int `json:"limit,omitempty"`
+	Offset int `json:"offset,omitempty"`
+}
+
+type ListSubscribersResponse struct {
+	Subscribers []*Subscriber `json:"subscribers"`
+}
+
+// ListSubscribers lists and searches newsletter subscribers.
+//encore:api auth method=GET path=/email/subscribers
+func ListSubscribers(ctx context.Context, p *ListSubscribersParams) (*ListSubscribersResponse, error) {
+	limit := p.Limit
+	if limit < 0 {
+		return nil, errs.B().Code(errs.InvalidArgument).Meta("limit", limit).Msg("limit must not be negative").Err()
+	} else if p.Offset < 0 {
+		return nil, errs.B().Code(errs.InvalidArgument).Meta("offset", p.Offset).Msg("offset must not be negative").Err()
+	} else if limit == 0 {
+		limit = 100
+	}
+	rows, err := sqldb.Query(ctx, `
+		SELECT u.email_address, u.name, u.optin, u.optin_changed, u.optin_source, u.pending_since IS NOT NULL,
+			COALESCE(
+				(SELECT array_agg(e.unsubscribed_at ORDER BY e.unsubscribed_at DESC)
+				FROM unsubscribe_event e WHERE e.email_address = u.email_address),
+				'{}'
+			)
+		FROM "user" u
+		WHERE ($1 OR u.optin)
+		AND ($2 = '' OR u.email_address ILIKE '%' || $2 || '%' OR u.name ILIKE '%' || $2 || '%')
+		ORDER BY u.email_address
+		LIMIT $3
+		OFFSET $4
+	`, p.All, p.Query, limit, p.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []*Subscriber{}
+	for rows.Next() {
+		var s Subscriber
+		if err := rows.Scan(&s.Email, &s.Name, &s.OptIn, &s.OptInChanged, &s.OptInSource, &s.Pending, &s.Unsubscribes); err != nil {
+			return nil, err
+		}
+		subs = append(subs, &s)
+	}
+	return &ListSubscribersResponse{Subscribers: subs}, rows.Err()
+}
+
+type AddSubscriberParams struct {
+	Email string `json:"email,omitempty"`
+	Name  string `json:"name,omitempty"`
+}
+
+// AddSubscriber subscribes an address directly, without requiring confirmation.
+// It reports AlreadyExists if the address is known, even if it has unsubscribed,
+// since adding it must not resubscribe someone who has unsubscribed.
+//encore:api auth method=POST path=/email/subscribers
+func AddSubscriber(ctx context.Context, p *AddSubscriberParams) error {
+	resp, err := ImportSubscribers(ctx, &ImportSubscribersParams{
+		Source:      "admin",
+		Subscribers: []*ImportSubscriber{{Email: p.Email, Name: p.Name}},
+	})
+	if err != nil {
+		return err
+	} else if resp.NumImported == 0 {
+		return errs.B().Code(errs.AlreadyExists).Meta("email", p.Email).Msg("subscriber already exists").Err()
+	}
+	return nil
+}
+
+// RemoveSubscriber permanently removes a subscriber and their message history.
+//encore:api auth method=DELETE path=/email/subscribers/:email
+func RemoveSubscriber(ctx context.Context, email string) error {
+	eb := errs.B().Meta("email", email)
+	email = canonicalEmail(email)
+	tx, err := sqldb.Begin(ctx)
+	if err != nil {
+		return eb.Cause(err).Err()
+	}
+	defer tx.Rollback() // committed explicitly on success
+
+	for _, q := range []string{
+		`DELETE FROM unsubscribe_event WHERE email_address = $1`,
+		`DELETE FROM topic_subscription WHERE email_address = $1`,
+		`DELETE FROM message WHERE email_address = $1`,
+	} {
+		if _, err := tx.Exec(ctx, q, email); err != nil {
+			return eb.Cause(err).Err()
+		}
+	}
+	res, err := tx.Exec(ctx, `DELETE FROM "user" WHERE email_address = $1`, email)
+	if err != nil {
+		return eb.Cause(err).Err()
+	} else if res.RowsAffected() == 0 {
+		return eb.Code(errs.NotFound).Msg("subscriber not found").Err()
+	}
+	return tx.Commit()
+}
+
+// ImportSubscriber is a subscriber to import.
+type ImportSubscriber struct {
+	Email string `json:"email,omitempty"`
+	Name  string `json:"name,omitempty"`
+
+	// OptInAt is when the subscriber opted in. It defaults to the current time.
+	OptInAt *time.Time `json:"optin_at,omitempty"`
+}
+
+type ImportSubscribersParams struct {
+	// Source records where the subscribers opted in, such as the name of another newsletter.
+	Source string `json:"source,omitempty"`
+
+	Subscribers []*ImportSubscriber `json:"subscribers,omitempty"`
+}
+
+type ImportSubscribersResponse struct {
+	NumImported int `json:"num_imported,omitempty"` // number of new subscribers
+}
+
+// ImportSubscribers bulk-loads opted-in subscribers.
+// Addresses that already exist are left untouched, so that imports
+// never resubscribe someone who has unsubscribed.
+//encore:api auth method=POST path=/email/subscribers/import
+func ImportSubscribers(ctx context.Context, p *ImportSubscribersParams) (*ImportSubscribersResponse, error) {
+	if p.Source == "" {
+		return nil, errs.B().Code(errs.InvalidArgument).Msg("source is required").Err()
+	}
+
+	now := time.Now()
+	emails := make([]string, len(p.Subscribers))
+	names := make([]string, len(p.Subscribers))
+	optins := make([]time.Time, len(p.Subscribers))
+	for i, s := range p.Subscribers {
+		email, err := normalizeEmail(s.Email)
+		if err != nil {
+			return nil, errs.B().Cause(err).Code(errs.InvalidArgument).Meta("index", i, "email", s.Email).Msg("invalid email address").Err()
+		}
+		emails[i], names[i], optins[i] = email, s.Name, now
+		if s.OptInAt != nil {
+			optins[i] = *s.OptInAt
+		}
+	}
+
+	res, err := sqldb.Exec(ctx, `
+		INSERT INTO "user" (email_address, name, optin, optin_changed, optin_source)
+		SELECT email, name, true, optin_at, $4
+		FROM unnest($1::text[], $2::text[], $3::timestamptz[]) AS s (email, name, optin_at)
+		ON CONFLICT (email_address) DO NOTHING
+	`, emails, names, optins, p.Source)
+	if err != nil {
+		return nil, err
+	}
+	return &ImportSubscribersResponse{NumImported: int(res.RowsAffected())}, nil
+}
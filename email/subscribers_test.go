@@ -0,0 +1,107 @@
+package email
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+)
+
+func TestManageSubscribers(t *testing.T) {
+	c := qt.New(t)
+	ctx := auth.WithContext(context.Background(), "user-id", nil)
+	optinAt := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	resp, err := ImportSubscribers(ctx, &ImportSubscribersParams{
+		Source: "old-newsletter",
+		Subscribers: []*ImportSubscriber{
+			{Email: "imported-1@manage.example.org", Name: "Alice", OptInAt: &optinAt},
+			{Email: "imported-2@manage.example.org"},
+		},
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(resp.NumImported, qt.Equals, 2)
+
+	// Importing again skips known addresses.
+	resp, err = ImportSubscribers(ctx, &ImportSubscribersParams{
+		Source:      "old-newsletter",
+		Subscribers: []*ImportSubscriber{{Email: "imported-1@manage.example.org"}},
+	})
+	c.Assert(err, qt.IsNil)
+	c.Assert(resp.NumImported, qt.Equals, 0)
+
+	c.Assert(AddSubscriber(ctx, &AddSubscriberParams{Email: "added@manage.example.org"}), qt.IsNil)
+
+	// Adding an existing address is reported rather than silently ignored.
+	err = AddSubscriber(ctx, &AddSubscriberParams{Email: "added@Manage.Example.org"})
+	c.Assert(errs.Code(err), qt.Equals, errs.AlreadyExists)
+
+	list, err := ListSubscribers(ctx, &ListSubscribersParams{Query: "manage.example.org"})
+	c.Assert(err, qt.IsNil)
+	c.Assert(list.Subscribers, qt.HasLen, 3)
+	c.Assert(list.Subscribers[0].Email, qt.Equals, "added@manage.example.org")
+	c.Assert(list.Subscribers[0].OptInSource, qt.Equals, "admin")
+	c.Assert(list.Subscribers[1].Name, qt.Equals, "Alice")
+	c.Assert(list.Subscribers[1].OptInSource, qt.Equals, "old-newsletter")
+	c.Assert(list.Subscribers[1].OptInChanged.Equal(optinAt), qt.IsTrue)
+
+	// Searching by name works too.
+	list, err = ListSubscribers(ctx, &ListSubscribersParams{Query: "alice"})
+	c.Assert(err, qt.IsNil)
+	c.Assert(list.Subscribers, qt.HasLen, 1)
+
+	c.Assert(RemoveSubscriber(ctx, "added@manage.example.org"), qt.IsNil)
+	err = RemoveSubscriber(ctx, "added@manage.example.org")
+	c.Assert(errs.Code(err), qt.Equals, errs.NotFound)
+
+	list, err = ListSubscribers(ctx, &ListSubscribersParams{Query: "manage.example.org"})
+	c.Assert(err, qt.IsNil)
+	c.Assert(list.Subscribers, qt.HasLen, 2)
+
+	_, err = ListSubscribers(ctx, &ListSubscribersParams{Limit: -1})
+	c.Check(errs.Code(err), qt.Equals, errs.InvalidArgument)
+	_, err = ListSubscribers(ctx, &ListSubscribersParams{Offset: -1})
+	c.Check(errs.Code(err), qt.Equals, errs.InvalidArgument)
+}
+
+func TestListSubscribersHistory(t *testing.T) {
+	c := qt.New(t)
+	useFakeSMTP(c)
+	ctx := auth.WithContext(context.Background(), "user-id", nil)
+	email := "history@example.org"
+	subscribeConfirmed(c, ctx, email)
+
+	tmplID := c.Name()
+	err := CreateTemplate(ctx, tmplID, &CreateTemplateParams{
+		Sender:   "sender@example.org",
+		Subject:  "subject",
+		BodyText: "text body",
+		BodyHTML: "html body",
+	})
+	c.Assert(err, qt.IsNil)
+	scheduled, err := Schedule(ctx, &ScheduleParams{TemplateID: tmplID, EmailAddresses: []string{email}})
+	c.Assert(err, qt.IsNil)
+	token, err := encodeUnsubscribeToken(email, scheduled.MessageIDs[0])
+	c.Assert(err, qt.IsNil)
+	c.Assert(Unsubscribe(ctx, &UnsubscribeParams{Token: token}), qt.IsNil)
+
+	// Unsubscribed addresses are only listed when asked for.
+	list, err := ListSubscribers(ctx, &ListSubscribersParams{Query: email})
+	c.Assert(err, qt.IsNil)
+	c.Assert(list.Subscribers, qt.HasLen, 0)
+
+	list, err = ListSubscribers(ctx, &ListSubscribersParams{Query: email, All: true})
+	c.Assert(err, qt.IsNil)
+	c.Assert(list.Subscribers, qt.HasLen, 1)
+	s := list.Subscribers[0]
+	c.Assert(s.OptIn, qt.IsFalse)
+	c.Assert(s.OptInSource, qt.Equals, "website")
+	c.Assert(s.Unsubscribes, qt.HasLen, 1)
+
+	// Removing the subscriber removes their history too.
+	c.Assert(RemoveSubscriber(ctx, email), qt.IsNil)
+}
@@ -0,0 +1,209 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	htmltemplate "html/template"
+	"net/url"
+	"reflect"
+	"text/template"
+	"time"
+
+	"encore.dev/beta/errs"
+	"encore.dev/storage/sqldb"
+)
+
+// TemplateData is the data email templates are rendered with.
+//
+// Templates refer to it using the usual template syntax, for example
+// {{.Recipient.Name}}, {{.UnsubscribeURL}}, {{.PreferencesURL}} or {{.Post.Title}}.
+// For backwards compatibility {{Token}} renders the unsubscribe token.
+type TemplateData struct {
+	// Recipient is the person receiving the email.
+	Recipient Recipient
+
+	// UnsubscribeURL is the link for unsubscribing from future emails.
+	UnsubscribeURL string
+
+	// Token is the unsubscribe token contained in UnsubscribeURL.
+	Token string
+
+	// PreferencesURL is the link for choosing which topics to receive emails about.
+	PreferencesURL string
+
+	// Post is the post the email is about, if any.
+	Post *PostData
+
+	// Digest is the content of the newsletter digest, if the email is one.
+	Digest *DigestData
+
+	// SendDate is when the email is sent.
+	SendDate time.Time
+}
+
+// Recipient describes the recipient of an email.
+type Recipient struct {
+	Email string
+	Name  string // empty if unknown
+}
+
+// PostData describes the post that an email template is about.
+type PostData struct {
+	Title    string `json:"title,omitempty"`
+	Summary  string `json:"summary,omitempty"`
+	URL      string `json:"url,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+}
+
+// rendered is a rendered email template.
+type rendered struct {
+	Subject  string
+	BodyText string
+	BodyHTML string
+}
+
+// renderTemplate renders the subject and bodies of a template with data.
+// The subject and plaintext body use text/template while the html body uses html/template.
+func renderTemplate(subject, bodyText, bodyHTML string, data *TemplateData) (*rendered, error) {
+	funcs := map[string]interface{}{
+		"Token": func() string { return data.Token },
+	}
+	var r rendered
+	for _, t := range []struct {
+		name string
+		src  string
+		dst  *string
+	}{
+		{"subject", subject, &r.Subject},
+		{"body_text", bodyText, &r.BodyText},
+	} {
+		tmpl, err := template.New(t.name).Funcs(funcs).Option("missingkey=error").Parse(t.src)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+		*t.dst = buf.String()
+	}
+
+	tmpl, err := htmltemplate.New("body_html").Funcs(funcs).Option("missingkey=error").Parse(bodyHTML)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	r.BodyHTML = buf.String()
+	return &r, nil
+}
+
+// templateData returns the data for rendering a template for the
+// given recipient and message.
+func templateData(recipient Recipient, messageID int64, post *PostData, digest *DigestData) (*TemplateData, error) {
+	token, err := encodeUnsubscribeToken(recipient.Email, messageID)
+	if err != nil {
+		return nil, err
+	}
+	prefsToken, err := encodePreferencesToken(recipient.Email)
+	if err != nil {
+		return nil, err
+	}
+	return &TemplateData{
+		Recipient:      recipient,
+		UnsubscribeURL: cfg.SiteURL + "/newsletter/unsubscribe?token=" + url.QueryEscape(token),
+		Token:          token,
+		PreferencesURL: cfg.SiteURL + "/newsletter/preferences?token=" + url.QueryEscape(prefsToken),
+		Post:           post,
+		Digest:         digest,
+		SendDate:       time.Now(),
+	}, nil
+}
+
+type PreviewTemplateParams struct {
+	// EmailAddress is the address to render the preview for.
+	EmailAddress string `json:"email_address,omitempty"`
+}
+
+type PreviewTemplateResponse struct {
+	Subject  string `json:"subject,omitempty"`
+	BodyText string `json:"body_text,omitempty"`
+	BodyHTML string `json:"body_html,omitempty"`
+}
+
+// PreviewTemplate renders an email template as it would be sent to a given address.
+// The unsubscribe link in the preview is not valid.
+//encore:api auth method=POST path=/email/templates/:id/preview
+func PreviewTemplate(ctx context.Context, id string, p *PreviewTemplateParams) (*PreviewTemplateResponse, error) {
+	eb := errs.B().Meta("template_id", id)
+	var (
+		subject, bodyText, bodyHTML string
+		postData, digestData        []byte
+		post                        *PostData
+		digest                      *DigestData
+	)
+	err := sqldb.QueryRow(ctx, `
+		SELECT subject, body_text, body_html, post, digest
+		FROM template
+		WHERE id = $1
+	`, id).Scan(&subject, &bodyText, &bodyHTML, &postData, &digestData)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, eb.Code(errs.NotFound).Msg("template not found").Err()
+	} else if err != nil {
+		return nil, eb.Cause(err).Err()
+	}
+	if err := unmarshalNullable(postData, &post); err != nil {
+		return nil, eb.Cause(err).Err()
+	} else if err := unmarshalNullable(digestData, &digest); err != nil {
+		return nil, eb.Cause(err).Err()
+	}
+
+	recipient := Recipient{Email: p.EmailAddress}
+	err = sqldb.QueryRow(ctx, `
+		SELECT name FROM "user" WHERE email_address = $1
+	`, p.EmailAddress).Scan(&recipient.Name)
+	if err != nil && !errors.Is(err, sqldb.ErrNoRows) {
+		return nil, eb.Cause(err).Err()
+	}
+
+	data, err := templateData(recipient, 0, post, digest)
+	if err != nil {
+		return nil, eb.Cause(err).Err()
+	}
+	r, err := renderTemplate(subject, bodyText, bodyHTML, data)
+	if err != nil {
+		return nil, eb.Cause(err).Code(errs.InvalidArgument).Msg("unable to render template").Err()
+	}
+	return &PreviewTemplateResponse{Subject: r.Subject, BodyText: r.BodyText, BodyHTML: r.BodyHTML}, nil
+}
+
+// validateTemplate reports an error if the template can't be rendered.
+func validateTemplate(p *CreateTemplateParams) error {
+	data, err := templateData(Recipient{Email: "jane@example.org", Name: "Jane"}, 0, p.Post, p.Digest)
+	if err != nil {
+		return err
+	}
+	_, err = renderTemplate(p.Subject, p.BodyText, p.BodyHTML, data)
+	return err
+}
+
+// unmarshalNullable decodes a JSONB column that may be NULL into v,
+// which must be a pointer to a pointer. NULL leaves v unchanged.
+func unmarshalNullable(data []byte, v interface{}) error {
+	if data == nil {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+// marshalNullable encodes v for storing in a JSONB column, using NULL for nil values.
+func marshalNullable(v interface{}) ([]byte, error) {
+	if v == nil || reflect.ValueOf(v).IsNil() {
+		return nil, nil
+	}
+	return json.Marshal(v)
+}
@@ -0,0 +1,62 @@
+package email
+
+import (
+	"context"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	c := qt.New(t)
+	data := &TemplateData{
+		Recipient:      Recipient{Email: "jane@example.org", Name: "Jane <3"},
+		UnsubscribeURL: "https://example.org/unsubscribe?token=tok",
+		Token:          "tok",
+		Post:           &PostData{Title: "New post"},
+	}
+
+	r, err := renderTemplate(
+		"{{.Post.Title}}",
+		"Hi {{.Recipient.Name}}! {{Token}}",
+		`<p>Hi {{.Recipient.Name}}</p>{{if .Post}}<a href="{{.UnsubscribeURL}}">unsubscribe</a>{{end}}`,
+		data,
+	)
+	c.Assert(err, qt.IsNil)
+	c.Assert(r.Subject, qt.Equals, "New post")
+	c.Assert(r.BodyText, qt.Equals, "Hi Jane <3! tok")
+	c.Assert(r.BodyHTML, qt.Equals, `<p>Hi Jane &lt;3</p><a href="https://example.org/unsubscribe?token=tok">unsubscribe</a>`)
+
+	// Unknown fields are reported.
+	_, err = renderTemplate("{{.Nope}}", "", "", data)
+	c.Assert(err, qt.Not(qt.IsNil))
+}
+
+func TestCreateTemplateValidates(t *testing.T) {
+	c := qt.New(t)
+	ctx := auth.WithContext(context.Background(), "user-id", nil)
+	err := CreateTemplate(ctx, c.Name(), &CreateTemplateParams{
+		Sender:   "sender@example.org",
+		Subject:  "{{.Post.Title}}", // no post given
+		BodyText: "text body",
+		BodyHTML: "html body",
+	})
+	c.Assert(errs.Code(err), qt.Equals, errs.InvalidArgument)
+
+	err = CreateTemplate(ctx, c.Name(), &CreateTemplateParams{
+		Sender:   "sender@example.org",
+		Subject:  "{{.Post.Title}}",
+		BodyText: "Hi {{.Recipient.Email}}",
+		BodyHTML: "html body",
+		Post:     &PostData{Title: "A post"},
+	})
+	c.Assert(err, qt.IsNil)
+
+	preview, err := PreviewTemplate(ctx, c.Name(), &PreviewTemplateParams{EmailAddress: "preview@example.org"})
+	c.Assert(err, qt.IsNil)
+	c.Assert(preview.Subject, qt.Equals, "A post")
+	c.Assert(preview.BodyText, qt.Equals, "Hi preview@example.org")
+}
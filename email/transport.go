@@ -0,0 +1,276 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mailgun/mailgun-go/v4"
+)
+
+// Mail is a fully rendered email, ready to be delivered.
+type Mail struct {
+	From    string
+	To      string
+	Subject string
+	Text    string // plaintext body
+	HTML    string // html body
+
+	// Headers are additional headers to set on the email.
+	Headers map[string]string
+
+	// TrackOpens reports whether the transport should track opens,
+	// if it supports doing so.
+	TrackOpens bool
+}
+
+// Transport delivers emails.
+type Transport interface {
+	// Send delivers m and reports the transport's unique id for it.
+	Send(ctx context.Context, m *Mail) (providerID string, err error)
+}
+
+// transport is the Transport used for sending emails.
+// It is configured by the "transport" key in config.json.
+var transport Transport
+
+// newTransport returns the Transport with the given name.
+func newTransport(name string) (Transport, error) {
+	switch name {
+	case "mailgun":
+		return &mailgunTransport{mg: mailgun.NewMailgun(cfg.MailgunDomain, secrets.MailGunAPIKey)}, nil
+	case "smtp":
+		return &smtpTransport{Addr: cfg.SMTP.Addr, Username: cfg.SMTP.Username, Password: secrets.SMTPPassword}, nil
+	case "file":
+		return &fileTransport{Dir: cfg.FileDir}, nil
+	default:
+		return nil, fmt.Errorf("unknown email transport %q", name)
+	}
+}
+
+// mailgunTransport sends emails using Mailgun.
+type mailgunTransport struct {
+	mg *mailgun.MailgunImpl
+}
+
+func (t *mailgunTransport) Send(ctx context.Context, m *Mail) (string, error) {
+	msg := t.mg.NewMessage(m.From, m.Subject, m.Text, m.To)
+	msg.SetTrackingOpens(m.TrackOpens)
+	msg.SetTrackingClicks(false)
+	if m.HTML != "" {
+		msg.SetHtml(m.HTML)
+	}
+	for k, v := range m.Headers {
+		msg.AddHeader(k, v)
+	}
+	_, mailgunID, err := t.mg.Send(ctx, msg)
+	return mailgunID, err
+}
+
+// smtpTransport sends emails using an SMTP server.
+type smtpTransport struct {
+	Addr     string // host:port of the SMTP server
+	Username string // if empty no authentication is used
+	Password string
+}
+
+func (t *smtpTransport) Send(ctx context.Context, m *Mail) (string, error) {
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return "", fmt.Errorf("bad sender: %v", err)
+	}
+	to, err := mail.ParseAddress(m.To)
+	if err != nil {
+		return "", fmt.Errorf("bad recipient: %v", err)
+	}
+	msgID, data, err := buildMIME(m, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	host, _, err := net.SplitHostPort(t.Addr)
+	if err != nil {
+		return "", fmt.Errorf("bad smtp addr: %v", err)
+	}
+	var auth smtp.Auth
+	if t.Username != "" {
+		auth = smtp.PlainAuth("", t.Username, t.Password, host)
+	}
+	if err := sendSMTP(ctx, t.Addr, host, auth, from.Address, to.Address, data); err != nil {
+		return "", err
+	}
+	return msgID, nil
+}
+
+// sendSMTP is smtp.SendMail with support for contexts. The connection's
+// deadline follows ctx, so the exchange is aborted rather than left running
+// in the background, where it could deliver a message that is then retried.
+func sendSMTP(ctx context.Context, addr, host string, auth smtp.Auth, from, to string, data []byte) (err error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// Unblock any pending read or write.
+			conn.SetDeadline(time.Now())
+		case <-stop:
+		}
+	}()
+	defer func() {
+		if err != nil && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+	}()
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("smtp server doesn't support AUTH")
+		}
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	// The message has been accepted, so failing to quit cleanly
+	// mustn't cause it to be sent again.
+	c.Quit()
+	return nil
+}
+
+// fileTransport writes emails as .eml files to a directory.
+// It is meant for local development.
+type fileTransport struct {
+	Dir string
+}
+
+func (t *fileTransport) Send(ctx context.Context, m *Mail) (string, error) {
+	now := time.Now()
+	msgID, data, err := buildMIME(m, now)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(t.Dir, 0755); err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405"), strings.Trim(msgID, "<>"))
+	return msgID, os.WriteFile(filepath.Join(t.Dir, name), data, 0644)
+}
+
+// buildMIME renders m as a MIME message with plaintext and html alternatives.
+// It reports the generated Message-ID along with the message.
+func buildMIME(m *Mail, now time.Time) (msgID string, data []byte, err error) {
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(m.From); err == nil {
+		if i := strings.LastIndex(addr.Address, "@"); i >= 0 {
+			domain = addr.Address[i+1:]
+		}
+	}
+	var id [12]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", nil, err
+	}
+	msgID = "<" + hex.EncodeToString(id[:]) + "@" + domain + ">"
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	headers := map[string]string{
+		"From":         m.From,
+		"To":           m.To,
+		"Subject":      mime.QEncoding.Encode("utf-8", m.Subject),
+		"Date":         now.Format(time.RFC1123Z),
+		"Message-ID":   msgID,
+		"MIME-Version": "1.0",
+		"Content-Type": "multipart/alternative; boundary=" + mw.Boundary(),
+	}
+	for k, v := range m.Headers {
+		headers[k] = v
+	}
+	keys := make([]string, 0, len(headers))
+	for k := range headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "%s: %s\r\n", k, headers[k])
+	}
+	buf.WriteString("\r\n")
+
+	parts := []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	}
+	for _, p := range parts {
+		if p.body == "" {
+			continue
+		}
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return "", nil, err
+		}
+		qp := quotedprintable.NewWriter(pw)
+		if _, err := io.WriteString(qp, p.body); err != nil {
+			return "", nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return "", nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return "", nil, err
+	}
+	return msgID, buf.Bytes(), nil
+}
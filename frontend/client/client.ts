@@ -56,6 +56,11 @@ export namespace blog {
     export interface GetBlogPostsParams {
         limit: number
         offset: number
+
+        /**
+         * Since lists only posts published at or after it, if set.
+         */
+        since?: string
     }
 
     export interface GetBlogPostsResponse {
@@ -150,12 +155,13 @@ export namespace blog {
 
         /**
          * GetBlogPosts retrieves a list of blog posts with
-         * optional limit and offset.
+         * optional limit, offset and publication time.
          */
         public GetBlogPosts(params: GetBlogPostsParams): Promise<GetBlogPostsResponse> {
             const query: any[] = [
                 "limit", params.limit,
                 "offset", params.offset,
+                "since", params.since,
             ]
             return this.baseClient.do<GetBlogPostsResponse>("GET", `/blog?${encodeQuery(query)}`)
         }
@@ -233,23 +239,101 @@ export namespace blog {
 }
 
 export namespace bytes {
+    export interface ArchiveCountsParams {
+        /**
+         * Tag counts only bytes with the blog tag with this slug.
+         */
+        tag: string
+    }
+
+    export interface ArchiveCountsResponse {
+        /**
+         * Months are the months with any bytes published, newest first.
+         */
+        months: MonthCount[]
+    }
+
+    export interface ArchiveParams {
+        year: number
+        /**
+         * 1-12, or 0 for the whole year
+         */
+        month: number
+
+        /**
+         * Tag lists only bytes with the blog tag with this slug.
+         */
+        tag: string
+    }
+
+    export interface ArchiveResponse {
+        year: number
+        month: number
+        bytes: Byte[]
+    }
+
     export interface Byte {
         id: number
         title: string
         summary: string
         url: string
         created: string
+        /**
+         * image shown on the byte's card
+         */
+        image_url: string
+        /**
+         * name of the site the URL is on
+         */
+        site_name: string
+        /**
+         * canonical URL of the linked page
+         */
+        canonical_url: string
+        /**
+         * slugs of the byte's blog tags
+         */
+        tags: string[]
+
+        /**
+         * Link is the result of the latest check of URL, or nil if it hasn't been checked.
+         */
+        link?: linkcheck.Status
     }
 
     export interface ListParams {
         limit: number
         offset: number
+
+        /**
+         * Broken lists only bytes whose links were broken when last checked.
+         */
+        broken: boolean
+
+        /**
+         * Tag lists only bytes with the blog tag with this slug.
+         */
+        tag: string
+
+        /**
+         * Since lists only bytes published at or after it, if set.
+         */
+        since?: string
     }
 
     export interface ListResponse {
         bytes: Byte[]
     }
 
+    export interface MonthCount {
+        year: number
+        /**
+         * 1-12
+         */
+        month: number
+        count: number
+    }
+
     export interface PromoteParams {
         /**
          * Schedule decides how the promotion should be scheduled.
@@ -278,6 +362,30 @@ export namespace bytes {
             this.baseClient = baseClient
         }
 
+        /**
+         * Archive lists the bytes published in a month or year, newest first.
+         * It isn't under /bytes since a fixed path there would conflict with Get.
+         */
+        public Archive(params: ArchiveParams): Promise<ArchiveResponse> {
+            const query: any[] = [
+                "month", params.month,
+                "tag", params.tag,
+                "year", params.year,
+            ]
+            return this.baseClient.do<ArchiveResponse>("GET", `/archive/bytes?${encodeQuery(query)}`)
+        }
+
+        /**
+         * ArchiveCounts counts the bytes published per month, so the
+         * archive can be rendered without fetching every byte.
+         */
+        public ArchiveCounts(params: ArchiveCountsParams): Promise<ArchiveCountsResponse> {
+            const query: any[] = [
+                "tag", params.tag,
+            ]
+            return this.baseClient.do<ArchiveCountsResponse>("GET", `/archive/bytes/counts?${encodeQuery(query)}`)
+        }
+
         /**
          * Get retrieves a byte.
          */
@@ -290,8 +398,11 @@ export namespace bytes {
          */
         public List(params: ListParams): Promise<ListResponse> {
             const query: any[] = [
+                "broken", params.broken,
                 "limit", params.limit,
                 "offset", params.offset,
+                "since", params.since,
+                "tag", params.tag,
             ]
             return this.baseClient.do<ListResponse>("GET", `/bytes?${encodeQuery(query)}`)
         }
@@ -313,8 +424,38 @@ export namespace bytes {
 }
 
 export namespace email {
-    export interface SubscribeParams {
+    export interface ConfirmParams {
+        /**
+         * Token is the confirmation token from the confirmation email.
+         */
+        token: string
+    }
+
+    export interface GetPreferencesParams {
+        /**
+         * Token is the preferences token from an email.
+         */
+        token: string
+    }
+
+    export interface Preferences {
         email: string
+
+        /**
+         * Topics are the slugs of the topics the subscriber has chosen.
+         * If empty the subscriber receives emails about every topic.
+         */
+        topics: string[]
+
+        /**
+         * Available are the topics that can be chosen.
+         */
+        available: Topic[]
+    }
+
+    export interface Topic {
+        slug: string
+        name: string
     }
 
     export interface UnsubscribeParams {
@@ -324,6 +465,19 @@ export namespace email {
         token: string
     }
 
+    export interface UpdatePreferencesParams {
+        /**
+         * Token is the preferences token from an email.
+         */
+        token: string
+
+        /**
+         * Topics are the slugs of the topics to receive emails about,
+         * replacing any previous choice. Empty means every topic.
+         */
+        topics: string[]
+    }
+
     export class ServiceClient {
         private baseClient: BaseClient
 
@@ -332,10 +486,20 @@ export namespace email {
         }
 
         /**
-         * Subscribe subscribes to the email newsletter for a given email.
+         * Confirm confirms a pending subscription to the email newsletter.
+         */
+        public Confirm(params: ConfirmParams): Promise<void> {
+            return this.baseClient.doVoid("POST", `/email/confirm`, params)
+        }
+
+        /**
+         * GetPreferences returns the email preferences of a subscriber.
          */
-        public Subscribe(params: SubscribeParams): Promise<void> {
-            return this.baseClient.doVoid("POST", `/email/subscribe`, params)
+        public GetPreferences(params: GetPreferencesParams): Promise<Preferences> {
+            const query: any[] = [
+                "token", params.token,
+            ]
+            return this.baseClient.do<Preferences>("GET", `/email/preferences?${encodeQuery(query)}`)
         }
 
         /**
@@ -344,6 +508,32 @@ export namespace email {
         public Unsubscribe(params: UnsubscribeParams): Promise<void> {
             return this.baseClient.doVoid("POST", `/email/unsubscribe`, params)
         }
+
+        /**
+         * UpdatePreferences updates the email preferences of a subscriber.
+         */
+        public UpdatePreferences(params: UpdatePreferencesParams): Promise<void> {
+            return this.baseClient.doVoid("POST", `/email/preferences`, params)
+        }
+    }
+}
+
+export namespace linkcheck {
+    export interface Status {
+        /**
+         * HTTP status code, or 0 if the request failed
+         */
+        status: number
+        /**
+         * URL after following redirects
+         */
+        final_url: string
+        /**
+         * why the request failed, if it did
+         */
+        error: string
+        broken: boolean
+        checked_at: string
     }
 }
 
@@ -353,13 +543,6 @@ export namespace url {
         urls: URL[]
     }
 
-    export interface ShortenParams {
-        /**
-         * the URL to shorten
-         */
-        url: string
-    }
-
     export interface URL {
         /**
          * short-form URL id
@@ -397,13 +580,6 @@ export namespace url {
         public List(): Promise<GetListResponse> {
             return this.baseClient.do<GetListResponse>("GET", `/url`)
         }
-
-        /**
-         * Shorten shortens a URL.
-         */
-        public Shorten(params: ShortenParams): Promise<URL> {
-            return this.baseClient.do<URL>("POST", `/url`, params)
-        }
     }
 }
 
@@ -425,7 +601,7 @@ class BaseClient {
                 break
             default:
                 this.baseURL = `https://devweek-k65i.encoreapi.com/${environment}`
-            }
+        }
     }
 
     public async do<T>(method: string, path: string, req?: any): Promise<T> {
@@ -464,7 +640,9 @@ function encodeQuery(parts: any[]): string {
             val = [val]
         }
         for (const v of val) {
-            pairs.push(`${key}=${encodeURIComponent(v)}`)
+            if (v !== undefined) {
+                pairs.push(`${key}=${encodeURIComponent(v)}`)
+            }
         }
     }
     return pairs.join("&")
@@ -3,3 +3,12 @@ import Client from "./client";
 const env = process.env.NEXT_PUBLIC_ENCORE_ENV ?? "staging"
 
 export const DefaultClient = new Client(env)
+
+// APIBaseURL is the base URL of the API, for pages that post forms
+// to raw endpoints the client has no methods for.
+export const APIBaseURL =
+  env === "local"
+    ? "http://localhost:4000"
+    : env === "staging"
+    ? "https://api.brian.dev"
+    : `https://devweek-k65i.encoreapi.com/${env}`
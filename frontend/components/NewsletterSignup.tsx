@@ -1,5 +1,5 @@
 import { FC, useState } from 'react'
-import { DefaultClient } from '../client/default'
+import { APIBaseURL } from '../client/default'
 
 interface LoadingResult {
   result: 'loading'
@@ -19,6 +19,7 @@ type Result = LoadingResult | SuccessResult | ErrorResult
 const NewsletterSignup: FC = () => {
   const [result, setResult] = useState<Result | null>(null)
   const [email, setEmail] = useState('')
+  const [website, setWebsite] = useState('')
 
   const subscribe = async () => {
     if (email === '') {
@@ -27,7 +28,15 @@ const NewsletterSignup: FC = () => {
 
     setResult({ result: 'loading' })
     try {
-      await DefaultClient.email.Subscribe({ email: email })
+      // Subscribe is raw so it can set Retry-After, and isn't in the generated client.
+      const resp = await fetch(`${APIBaseURL}/email/subscribe`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ email: email, website: website }),
+      })
+      if (!resp.ok) {
+        throw new Error('request failed: ' + (await resp.text()))
+      }
       setResult({ result: 'success' })
     } catch (err) {
       setResult({ result: 'error', err: err as Error })
@@ -69,6 +78,17 @@ const NewsletterSignup: FC = () => {
                 value={email}
                 onChange={(e) => setEmail(e.target.value)}
               />
+              {/* Honeypot field for bots; hidden from people and assistive technology. */}
+              <input
+                name="website"
+                type="text"
+                tabIndex={-1}
+                autoComplete="off"
+                aria-hidden="true"
+                className="hidden"
+                value={website}
+                onChange={(e) => setWebsite(e.target.value)}
+              />
               <button
                 type="submit"
                 className="flex items-center justify-center px-5 py-3 mt-3 text-base font-medium border border-transparent rounded-md shadow text-primary-content bg-primary lg:w-36 hover:bg-purple-400 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-offset-indigo-700 focus:ring-white sm:mt-0 sm:ml-3 sm:w-auto sm:flex-shrink-0"
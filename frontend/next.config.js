@@ -52,6 +52,18 @@ const securityHeaders = [
   },
 ]
 
+const encoreEnv = process.env.NEXT_PUBLIC_ENCORE_ENV ?? 'staging'
+const apiURL =
+  encoreEnv === 'local'
+    ? 'http://localhost:4000'
+    : encoreEnv === 'staging'
+    ? 'https://api.brian.dev'
+    : `https://devweek-k65i.encoreapi.com/${encoreEnv}`
+
+// shortURLHost serves short URLs, as configured by short_url_base in url/config.json.
+// Its requests are rewritten to the redirect endpoint of the API.
+const shortURLHost = 'url.bjk.fyi'
+
 /**
  * @type {import('next/dist/next-server/server/config').NextConfig}
  **/
@@ -64,6 +76,15 @@ module.exports = withBundleAnalyzer({
   eslint: {
     dirs: ['pages', 'components', 'lib', 'layouts', 'scripts'],
   },
+  async rewrites() {
+    return [
+      {
+        source: '/:id',
+        has: [{ type: 'host', value: shortURLHost }],
+        destination: `${apiURL}/r/:id`,
+      },
+    ]
+  },
   async headers() {
     return [
       {
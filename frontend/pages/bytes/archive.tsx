@@ -0,0 +1,88 @@
+import { DateTime } from 'luxon'
+import Link from 'next/link'
+import { useRouter } from 'next/router'
+import { useEffect, useState } from 'react'
+import { bytes } from '../../client/client'
+import { DefaultClient } from '../../client/default'
+import BytesList from '../../components/BytesList'
+import Page from '../../components/Page'
+import { SEO } from '../../components/SEO'
+
+// BytesArchive lists the months with bytes published, and the bytes of the
+// month (or year, if no month is given) chosen with the year and month query parameters.
+function BytesArchive() {
+  const router = useRouter()
+  const [months, setMonths] = useState<bytes.MonthCount[] | null>(null)
+  const [archive, setArchive] = useState<bytes.ArchiveResponse | null>(null)
+  const [failed, setFailed] = useState(false)
+  const year = typeof router.query.year === 'string' ? parseInt(router.query.year, 10) || 0 : 0
+  const month = typeof router.query.month === 'string' ? parseInt(router.query.month, 10) || 0 : 0
+  const tag = typeof router.query.tag === 'string' ? router.query.tag : ''
+
+  useEffect(() => {
+    if (!router.isReady) {
+      return
+    }
+    DefaultClient.bytes
+      .ArchiveCounts({ tag: tag })
+      .then((res) => setMonths(res.months))
+      .catch(() => setFailed(true))
+  }, [router.isReady, tag])
+
+  useEffect(() => {
+    if (!router.isReady || year === 0) {
+      setArchive(null)
+      return
+    }
+    DefaultClient.bytes
+      .Archive({ year: year, month: month, tag: tag })
+      .then((res) => setArchive(res))
+      .catch(() => setFailed(true))
+  }, [router.isReady, year, month, tag])
+
+  const monthName = (y: number, m: number) => DateTime.utc(y, m, 1).toFormat('LLLL yyyy')
+  const monthHref = (m: bytes.MonthCount) => ({
+    pathname: '/bytes/archive',
+    query: tag === '' ? { year: m.year, month: m.month } : { year: m.year, month: m.month, tag: tag },
+  })
+
+  return (
+    <div>
+      <SEO title="Bytes archive" description="Every byte, by month" />
+      <Page title="Bytes" hero_text="" subtitle="Archive" />
+
+      <section className="text-base-content">
+        {failed ? (
+          <p className="text-center">The archive couldn&apos;t be loaded. Please try again later.</p>
+        ) : !months ? (
+          <div className="text-neutral-400">Loading...</div>
+        ) : months.length === 0 ? (
+          <p className="text-center">There are no bytes yet.</p>
+        ) : (
+          <ul className="flex flex-wrap justify-center gap-4">
+            {months.map((m) => (
+              <li key={`${m.year}-${m.month}`}>
+                <Link href={monthHref(m)}>
+                  <a className={m.year === year && m.month === month ? 'font-semibold text-primary' : 'hover-underline'}>
+                    {monthName(m.year, m.month)} ({m.count})
+                  </a>
+                </Link>
+              </li>
+            ))}
+          </ul>
+        )}
+      </section>
+
+      {archive && (
+        <section>
+          <h2 className="pt-8 text-xl font-bold text-primary">
+            {archive.month === 0 ? archive.year : monthName(archive.year, archive.month)}
+          </h2>
+          <BytesList bytes={archive.bytes} />
+        </section>
+      )}
+    </div>
+  )
+}
+
+export default BytesArchive
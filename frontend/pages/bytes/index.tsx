@@ -4,6 +4,7 @@ import BytesList from '../../components/BytesList';
 import { SEO } from '../../components/SEO';
 import { InferGetStaticPropsType } from 'next'
 import Page from '../../components/Page'
+import Link from 'next/link'
 
 import {  GetStaticProps } from 'next'
 function BytesIndex({bytes}: InferGetStaticPropsType<typeof getStaticProps>) {
@@ -24,6 +25,11 @@ function BytesIndex({bytes}: InferGetStaticPropsType<typeof getStaticProps>) {
           <BytesList bytes={bytes} />
         )}
       </section>
+      <p className="pt-8 text-center">
+        <Link href={'/bytes/archive'}>
+          <a className="hover-underline text-primary">Browse the archive</a>
+        </Link>
+      </p>
 
 
     </div>
@@ -31,7 +37,7 @@ function BytesIndex({bytes}: InferGetStaticPropsType<typeof getStaticProps>) {
 }
 export  const getStaticProps: GetStaticProps = async()=>{
 
-  const res = await DefaultClient.bytes.List({ offset: 0, limit: 20 })
+  const res = await DefaultClient.bytes.List({ offset: 0, limit: 20, broken: false, tag: "" })
    const bytes = res.bytes
 
   return {
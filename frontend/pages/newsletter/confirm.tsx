@@ -0,0 +1,56 @@
+import { useRouter } from 'next/router'
+import { useEffect, useState } from 'react'
+import { DefaultClient } from '../../client/default'
+import Page from '../../components/Page'
+import { SEO } from '../../components/SEO'
+
+type Result = 'loading' | 'success' | 'error'
+
+// NewsletterConfirm is linked to from the subscription confirmation email,
+// and posts the token from the link to the API to confirm the subscription.
+function NewsletterConfirm() {
+  const router = useRouter()
+  const [result, setResult] = useState<Result | null>(null)
+  const token = typeof router.query.token === 'string' ? router.query.token : ''
+
+  const confirm = async () => {
+    setResult('loading')
+    try {
+      await DefaultClient.email.Confirm({ token: token })
+      setResult('success')
+    } catch (err) {
+      setResult('error')
+    }
+  }
+
+  // Confirm as soon as the token is known, once the router is ready.
+  useEffect(() => {
+    if (router.isReady && token !== '' && result === null) {
+      confirm()
+    }
+  }, [router.isReady, token])
+
+  return (
+    <div>
+      <SEO title="Confirm your subscription" description="Confirm your newsletter subscription" />
+      <Page title="Newsletter" hero_text="" subtitle="Confirm your subscription" />
+
+      <section className="text-center text-base-content">
+        {result === 'success' ? (
+          <p>Thanks, your subscription is confirmed!</p>
+        ) : result === 'error' ? (
+          <p>
+            The confirmation link is invalid or has expired. Please subscribe again to get a new
+            one.
+          </p>
+        ) : router.isReady && token === '' ? (
+          <p>The confirmation link is missing its token.</p>
+        ) : (
+          <p className="text-neutral-400">Confirming...</p>
+        )}
+      </section>
+    </div>
+  )
+}
+
+export default NewsletterConfirm
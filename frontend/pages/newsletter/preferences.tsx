@@ -0,0 +1,94 @@
+import { useRouter } from 'next/router'
+import { useEffect, useState } from 'react'
+import { email } from '../../client/client'
+import { DefaultClient } from '../../client/default'
+import Page from '../../components/Page'
+import { SEO } from '../../components/SEO'
+
+type Result = 'saving' | 'saved' | 'error'
+
+// NewsletterPreferences is linked to from the footer of every email,
+// and lets subscribers choose which topics they get emails about.
+function NewsletterPreferences() {
+  const router = useRouter()
+  const [result, setResult] = useState<Result | null>(null)
+  const [prefs, setPrefs] = useState<email.Preferences | null>(null)
+  const [topics, setTopics] = useState<string[]>([])
+  const token = typeof router.query.token === 'string' ? router.query.token : ''
+
+  useEffect(() => {
+    if (!router.isReady) {
+      return
+    } else if (token === '') {
+      setResult('error')
+      return
+    }
+    DefaultClient.email
+      .GetPreferences({ token: token })
+      .then((p) => {
+        setPrefs(p)
+        setTopics(p.topics)
+      })
+      .catch(() => setResult('error'))
+  }, [router.isReady, token])
+
+  const toggle = (slug: string) => {
+    setTopics(topics.includes(slug) ? topics.filter((t) => t !== slug) : [...topics, slug])
+  }
+
+  const save = async () => {
+    setResult('saving')
+    try {
+      await DefaultClient.email.UpdatePreferences({ token: token, topics: topics })
+      setResult('saved')
+    } catch (err) {
+      setResult('error')
+    }
+  }
+
+  return (
+    <div>
+      <SEO title="Email preferences" description="Choose which topics you get emails about" />
+      <Page title="Newsletter" hero_text="" subtitle="Email preferences" />
+
+      <section className="max-w-md mx-auto text-base-content">
+        {result === 'error' ? (
+          <p className="text-center">
+            The preferences link is invalid or has expired. Please use the link in a newer email.
+          </p>
+        ) : !prefs ? (
+          <p className="text-center text-neutral-400">Loading...</p>
+        ) : (
+          <form>
+            <p className="mb-4">
+              Choose the topics you want emails about for {prefs.email}. If you don&apos;t choose
+              any, you get emails about everything.
+            </p>
+            {prefs.available.map((t) => (
+              <label key={t.slug} className="flex items-center my-2">
+                <input
+                  type="checkbox"
+                  className="mr-3"
+                  checked={topics.includes(t.slug)}
+                  onChange={() => toggle(t.slug)}
+                />
+                {t.name}
+              </label>
+            ))}
+            <button
+              type="button"
+              className="px-5 py-3 mt-6 text-base font-medium border border-transparent rounded-md shadow text-primary-content bg-primary hover:bg-purple-400"
+              disabled={result === 'saving'}
+              onClick={save}
+            >
+              Save
+            </button>
+            {result === 'saved' && <p className="mt-3">Your preferences have been saved.</p>}
+          </form>
+        )}
+      </section>
+    </div>
+  )
+}
+
+export default NewsletterPreferences
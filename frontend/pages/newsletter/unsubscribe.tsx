@@ -0,0 +1,56 @@
+import { useRouter } from 'next/router'
+import { useState } from 'react'
+import { DefaultClient } from '../../client/default'
+import Page from '../../components/Page'
+import { SEO } from '../../components/SEO'
+
+type Result = 'loading' | 'success' | 'error'
+
+// NewsletterUnsubscribe is linked to from the footer of every email.
+// It asks before unsubscribing, so that link scanners opening the page don't unsubscribe.
+function NewsletterUnsubscribe() {
+  const router = useRouter()
+  const [result, setResult] = useState<Result | null>(null)
+  const token = typeof router.query.token === 'string' ? router.query.token : ''
+
+  const unsubscribe = async () => {
+    setResult('loading')
+    try {
+      await DefaultClient.email.Unsubscribe({ token: token })
+      setResult('success')
+    } catch (err) {
+      setResult('error')
+    }
+  }
+
+  return (
+    <div>
+      <SEO title="Unsubscribe" description="Unsubscribe from the newsletter" />
+      <Page title="Newsletter" hero_text="" subtitle="Unsubscribe" />
+
+      <section className="text-center text-base-content">
+        {result === 'success' ? (
+          <p>You have been unsubscribed and won&apos;t get any more emails.</p>
+        ) : result === 'error' ? (
+          <p>The unsubscribe link is invalid or has expired. Please use the link in a newer email.</p>
+        ) : router.isReady && token === '' ? (
+          <p>The unsubscribe link is missing its token.</p>
+        ) : (
+          <>
+            <p>Do you want to stop getting emails from me?</p>
+            <button
+              type="button"
+              className="px-5 py-3 mt-6 text-base font-medium border border-transparent rounded-md shadow text-primary-content bg-primary hover:bg-purple-400"
+              disabled={result === 'loading' || token === ''}
+              onClick={unsubscribe}
+            >
+              Unsubscribe
+            </button>
+          </>
+        )}
+      </section>
+    </div>
+  )
+}
+
+export default NewsletterUnsubscribe
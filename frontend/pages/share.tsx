@@ -0,0 +1,111 @@
+import { useRouter } from 'next/router'
+import { useEffect, useState } from 'react'
+import { APIBaseURL } from '../client/default'
+import Page from '../components/Page'
+import { SEO } from '../components/SEO'
+
+// tokenKey is where the API token for sharing bytes is kept on this device.
+const tokenKey = 'shareToken'
+
+type Result = 'setup' | 'missing' | 'ready'
+
+// Share is the Web Share Target of the site, and is opened by the bookmarklet.
+// It shows the shared page as a form, which is only posted to the API as a byte,
+// authenticated by the API token stored on this device, once it is submitted.
+// Any site can open this page, so it must never publish on its own.
+// The token is stored by opening the setup link printed by "bkml token create",
+// which has it in the fragment so it is never sent anywhere.
+function Share() {
+  const router = useRouter()
+  const [result, setResult] = useState<Result | null>(null)
+  const [token, setToken] = useState('')
+  const [url, setURL] = useState('')
+  const [title, setTitle] = useState('')
+  const [text, setText] = useState('')
+
+  useEffect(() => {
+    if (!router.isReady) {
+      return
+    }
+    const hash = new URLSearchParams(window.location.hash.slice(1))
+    if (hash.get('token')) {
+      localStorage.setItem(tokenKey, hash.get('token') as string)
+      window.history.replaceState(null, '', window.location.pathname)
+      setResult('setup')
+      return
+    }
+    const stored = localStorage.getItem(tokenKey)
+    if (!stored) {
+      setResult('missing')
+      return
+    }
+    const field = (name: string) =>
+      typeof router.query[name] === 'string' ? (router.query[name] as string) : ''
+    setToken(stored)
+    setURL(field('url'))
+    setTitle(field('title'))
+    setText(field('text'))
+    setResult('ready')
+  }, [router.isReady])
+
+  return (
+    <div>
+      <SEO title="Share" description="Share a page as a byte" />
+      <Page title="Share" hero_text="" subtitle="Share a page as a byte" />
+
+      <section className="max-w-md mx-auto text-base-content">
+        {result === 'setup' ? (
+          <p className="text-center">This device is set up for sharing bytes.</p>
+        ) : result === 'missing' ? (
+          <p className="text-center">
+            This device isn&apos;t set up for sharing. Open the link from bkml token create
+            first.
+          </p>
+        ) : result === 'ready' ? (
+          <form method="POST" action={`${APIBaseURL}/share/bytes`}>
+            <input type="hidden" name="token" value={token} />
+            <label className="block my-2">
+              URL
+              <input
+                type="text"
+                name="url"
+                className="w-full px-3 py-2 mt-1 border rounded-md"
+                value={url}
+                onChange={(e) => setURL(e.target.value)}
+              />
+            </label>
+            <label className="block my-2">
+              Title
+              <input
+                type="text"
+                name="title"
+                className="w-full px-3 py-2 mt-1 border rounded-md"
+                value={title}
+                onChange={(e) => setTitle(e.target.value)}
+              />
+            </label>
+            <label className="block my-2">
+              Summary
+              <textarea
+                name="text"
+                className="w-full px-3 py-2 mt-1 border rounded-md"
+                value={text}
+                onChange={(e) => setText(e.target.value)}
+              />
+            </label>
+            <button
+              type="submit"
+              className="px-5 py-3 mt-6 text-base font-medium border border-transparent rounded-md shadow text-primary-content bg-primary hover:bg-purple-400"
+            >
+              Publish
+            </button>
+          </form>
+        ) : (
+          <p className="text-center text-neutral-400">Loading...</p>
+        )}
+      </section>
+    </div>
+  )
+}
+
+export default Share
@@ -0,0 +1,100 @@
+package linkcheck
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// NewClient returns a client for fetching links chosen by others,
+// which only connects to public addresses, checked after DNS resolution
+// so that hostnames can't point it at internal services, and only
+// follows redirects to http and https URLs.
+func NewClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// No proxy, since the dialer would check the proxy's address instead.
+			DialContext: (&net.Dialer{
+				Timeout: 5 * time.Second,
+				Control: checkPublicAddr,
+			}).DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return CheckScheme(req.URL)
+		},
+	}
+}
+
+// CheckScheme reports an error unless u is an http or https URL.
+func CheckScheme(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported url scheme %q", u.Scheme)
+	}
+	return nil
+}
+
+// checkPublicAddr is a net.Dialer Control function that reports
+// an error unless address, the resolved IP address and port being
+// connected to, is a public unicast address.
+func checkPublicAddr(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("connecting to non-public address %s is not allowed", host)
+	}
+	return nil
+}
+
+// nonPublicNets are special-purpose networks not covered by the net.IP methods,
+// such as shared address space used for carrier-grade NAT.
+var nonPublicNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",      // "this" network
+		"100.64.0.0/10",  // shared address space
+		"192.0.0.0/24",   // IETF protocol assignments
+		"198.18.0.0/15",  // benchmarking
+		"240.0.0.0/4",    // reserved, including broadcast
+		"64:ff9b:1::/48", // local-use IPv4/IPv6 translation
+		"2001::/23",      // IETF protocol assignments
+		"2001:db8::/32",  // documentation
+	} {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// isPublicIP reports whether ip is a public unicast address,
+// rather than loopback, private (RFC 1918 or RFC 4193), link-local
+// (such as the 169.254.169.254 metadata service), multicast or otherwise special.
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, n := range nonPublicNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package linkcheck
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	c := qt.New(t)
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"224.0.0.1", false},
+		{"255.255.255.255", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+	}
+	for _, test := range tests {
+		c.Check(isPublicIP(net.ParseIP(test.ip)), qt.Equals, test.want, qt.Commentf("ip %s", test.ip))
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	c := qt.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	// The test server listens on loopback, so the default checker can't reach it.
+	res := New().Check(context.Background(), srv.URL)
+	c.Check(res.Status, qt.Equals, 0)
+	c.Check(res.Err, qt.Matches, ".*non-public address.*")
+
+	// Nor does it follow redirects to URLs of other schemes.
+	redirect := &http.Request{URL: &url.URL{Scheme: "file", Path: "/etc/passwd"}}
+	c.Check(NewClient(time.Second).CheckRedirect(redirect, nil), qt.ErrorMatches, `unsupported url scheme "file"`)
+}
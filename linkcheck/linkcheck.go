@@ -0,0 +1,167 @@
+// Package linkcheck checks whether links to external sites still work.
+package linkcheck
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Result is the outcome of checking a link.
+type Result struct {
+	URL      string // the URL that was checked
+	Status   int    // HTTP status code of the final response, or 0 if there was none
+	FinalURL string // URL after following redirects
+	Err      string // why the request failed, if it did
+}
+
+// Broken reports whether the link is considered broken: the request failed,
+// or the page is missing or the server is failing. Other client errors
+// like 401, 403 and 429 are often bot protection, so they don't count.
+func (r *Result) Broken() bool {
+	return r.Status == 0 || r.Status == http.StatusNotFound || r.Status == http.StatusGone || r.Status >= 500
+}
+
+// Checker checks links, limiting how hard it hits each site.
+type Checker struct {
+	// Client makes the requests. Its timeout bounds each request.
+	Client *http.Client
+
+	// UserAgent identifies the checker to the sites it checks.
+	UserAgent string
+
+	// Concurrency is the maximum number of hosts checked at once.
+	// Links to the same host are always checked one at a time.
+	Concurrency int
+
+	// HostDelay is the time to wait between requests to the same host.
+	HostDelay time.Duration
+}
+
+// New returns a Checker with polite defaults,
+// which only checks links to public addresses.
+func New() *Checker {
+	return &Checker{
+		Client:      NewClient(10 * time.Second),
+		UserAgent:   "Mozilla/5.0 (compatible; bjk-linkcheck/1.0; +https://brian.dev)",
+		Concurrency: 4,
+		HostDelay:   2 * time.Second,
+	}
+}
+
+// CheckAll checks the links and returns their results in the same order.
+func (c *Checker) CheckAll(ctx context.Context, urls []string) []*Result {
+	results := make([]*Result, len(urls))
+
+	// Group the links by host so each host is only checked one link at a time.
+	byHost := make(map[string][]int)
+	var hosts []string
+	for i, u := range urls {
+		host := ""
+		if parsed, err := url.Parse(u); err == nil {
+			host = parsed.Host
+		}
+		if _, ok := byHost[host]; !ok {
+			hosts = append(hosts, host)
+		}
+		byHost[host] = append(byHost[host], i)
+	}
+
+	concurrency := c.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, host := range hosts {
+		indices := byHost[host]
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			for n, i := range indices {
+				if n > 0 && !sleep(ctx, c.HostDelay) {
+					results[i] = &Result{URL: urls[i], Err: ctx.Err().Error()}
+					continue
+				}
+				results[i] = c.Check(ctx, urls[i])
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// Check checks a single link. It tries a HEAD request first and
+// falls back to GET for servers that don't support HEAD properly.
+func (c *Checker) Check(ctx context.Context, rawURL string) *Result {
+	res := c.do(ctx, http.MethodHead, rawURL)
+	switch res.Status {
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented, http.StatusForbidden, http.StatusNotFound:
+		res = c.do(ctx, http.MethodGet, rawURL)
+	}
+	return res
+}
+
+// maxBodyRead is how much of a GET response body is read before closing it,
+// so that connections can be reused without downloading large pages.
+const maxBodyRead = 64 << 10
+
+func (c *Checker) do(ctx context.Context, method, rawURL string) *Result {
+	res := &Result{URL: rawURL}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		res.Err = err.Error()
+		return res
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		res.Err = "unsupported url scheme"
+		return res
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		res.Err = err.Error()
+		return res
+	}
+	req.Header.Set("User-Agent", c.UserAgent)
+	req.Header.Set("Accept", "text/html,*/*;q=0.8")
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		res.Err = err.Error()
+		return res
+	}
+	defer resp.Body.Close()
+	io.CopyN(io.Discard, resp.Body, maxBodyRead)
+
+	res.Status = resp.StatusCode
+	res.FinalURL = resp.Request.URL.String()
+	return res
+}
+
+// sleep waits for d or until ctx is done, reporting whether it waited the full time.
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
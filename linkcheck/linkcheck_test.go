@@ -0,0 +1,137 @@
+package linkcheck
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func newTestServer(c *qt.C) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, req *http.Request) {
+		http.Redirect(w, req, "/ok", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/gone", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	})
+	mux.HandleFunc("/error", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/no-head", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Write([]byte("hello"))
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-req.Context().Done():
+		}
+	})
+	srv := httptest.NewServer(mux)
+	c.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCheck(t *testing.T) {
+	c := qt.New(t)
+	srv := newTestServer(c)
+	checker := New()
+	checker.Client = &http.Client{Timeout: 100 * time.Millisecond}
+	ctx := context.Background()
+
+	tests := []struct {
+		path     string
+		status   int
+		finalURL string
+		broken   bool
+	}{
+		{"/ok", 200, srv.URL + "/ok", false},
+		{"/moved", 200, srv.URL + "/ok", false},
+		{"/gone", 410, srv.URL + "/gone", true},
+		{"/missing", 404, srv.URL + "/missing", true},
+		{"/error", 500, srv.URL + "/error", true},
+		{"/no-head", 200, srv.URL + "/no-head", false},
+		{"/slow", 0, "", true},
+	}
+	for _, test := range tests {
+		res := checker.Check(ctx, srv.URL+test.path)
+		c.Check(res.URL, qt.Equals, srv.URL+test.path)
+		c.Check(res.Status, qt.Equals, test.status, qt.Commentf("%s: %s", test.path, res.Err))
+		c.Check(res.FinalURL, qt.Equals, test.finalURL, qt.Commentf("%s", test.path))
+		c.Check(res.Broken(), qt.Equals, test.broken, qt.Commentf("%s", test.path))
+		c.Check(res.Err != "", qt.Equals, test.status == 0, qt.Commentf("%s: %s", test.path, res.Err))
+	}
+
+	res := checker.Check(ctx, "mailto:me@example.org")
+	c.Check(res.Err, qt.Equals, "unsupported url scheme")
+	c.Check(res.Broken(), qt.IsTrue)
+}
+
+func TestCheckAllPoliteness(t *testing.T) {
+	c := qt.New(t)
+
+	// Record the times of requests and the user agent.
+	var (
+		mu    sync.Mutex
+		times []time.Time
+		agent string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		times = append(times, time.Now())
+		agent = req.UserAgent()
+		if req.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	c.Cleanup(srv.Close)
+
+	checker := New()
+	checker.Client = &http.Client{Timeout: time.Second} // the test server is on loopback
+	checker.HostDelay = 50 * time.Millisecond
+	urls := []string{srv.URL + "/a", srv.URL + "/missing", srv.URL + "/c", "not a url\x7f"}
+	results := checker.CheckAll(context.Background(), urls)
+	c.Assert(results, qt.HasLen, len(urls))
+	for i, res := range results {
+		c.Check(res.URL, qt.Equals, urls[i])
+	}
+	c.Check(results[0].Status, qt.Equals, 200)
+	c.Check(results[1].Status, qt.Equals, 404)
+	c.Check(results[2].Status, qt.Equals, 200)
+	c.Check(results[3].Status, qt.Equals, 0)
+	c.Check(results[3].Err, qt.Not(qt.Equals), "")
+	c.Check(agent, qt.Equals, checker.UserAgent)
+
+	// Requests to the same host are spaced out by the host delay.
+	// The 404 is checked again with GET, so there are four requests.
+	c.Assert(times, qt.HasLen, 4)
+	c.Check(times[1].Sub(times[0]) >= checker.HostDelay, qt.IsTrue)
+	c.Check(times[3].Sub(times[2]) >= checker.HostDelay, qt.IsTrue)
+}
+
+func TestCheckAllCancelled(t *testing.T) {
+	c := qt.New(t)
+	srv := newTestServer(c)
+	checker := New()
+	checker.Client = &http.Client{Timeout: time.Second} // the test server is on loopback
+	checker.HostDelay = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	results := checker.CheckAll(ctx, []string{srv.URL + "/ok", srv.URL + "/ok"})
+	c.Check(results[0].Status, qt.Equals, 200)
+	c.Check(results[1].Status, qt.Equals, 0)
+	c.Check(results[1].Err, qt.Equals, context.DeadlineExceeded.Error())
+}
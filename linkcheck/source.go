@@ -0,0 +1,61 @@
+package linkcheck
+
+import (
+	"context"
+	"time"
+)
+
+// Link is a stored link to check.
+type Link struct {
+	ID  interface{} // identifies the row the link is stored in
+	URL string
+}
+
+// Source is where a service stores its links and their link check status.
+type Source interface {
+	// Due returns up to limit links that have never been checked
+	// or were last checked before the given time, least recently checked first.
+	Due(ctx context.Context, checkedBefore time.Time, limit int) ([]*Link, error)
+
+	// Record stores the result of checking a link.
+	Record(ctx context.Context, link *Link, res *Result) error
+}
+
+// Summary counts the links checked by CheckDue.
+type Summary struct {
+	NumChecked int
+	NumBroken  int
+}
+
+// CheckDue checks the links from src that are due to be checked again,
+// in batches of BatchSize, and records the results in src.
+// It stops once no links are due or it has run for RunTime,
+// so that sources with many links don't fall further and further behind.
+func (c *Checker) CheckDue(ctx context.Context, src Source) (*Summary, error) {
+	sum := &Summary{}
+	start := time.Now()
+	for time.Since(start) < RunTime {
+		links, err := src.Due(ctx, time.Now().Add(-RecheckInterval), BatchSize)
+		if err != nil {
+			return nil, err
+		}
+		urls := make([]string, len(links))
+		for i, link := range links {
+			urls[i] = link.URL
+		}
+
+		for i, res := range c.CheckAll(ctx, urls) {
+			if err := src.Record(ctx, links[i], res); err != nil {
+				return nil, err
+			}
+			sum.NumChecked++
+			if res.Broken() {
+				sum.NumBroken++
+			}
+		}
+		if len(links) < BatchSize {
+			break
+		}
+	}
+	return sum, nil
+}
@@ -0,0 +1,72 @@
+package linkcheck
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// fakeSource is a Source of links kept in memory.
+type fakeSource struct {
+	links   []*Link
+	results map[interface{}]*Result
+}
+
+func (s *fakeSource) Due(ctx context.Context, checkedBefore time.Time, limit int) ([]*Link, error) {
+	var due []*Link
+	for _, link := range s.links {
+		if _, ok := s.results[link.ID]; !ok && len(due) < limit {
+			due = append(due, link)
+		}
+	}
+	return due, nil
+}
+
+func (s *fakeSource) Record(ctx context.Context, link *Link, res *Result) error {
+	s.results[link.ID] = res
+	return nil
+}
+
+func TestCheckDue(t *testing.T) {
+	c := qt.New(t)
+	srv := newTestServer(c)
+	checker := New()
+	checker.Client = &http.Client{Timeout: 100 * time.Millisecond}
+	checker.HostDelay = 0
+
+	src := &fakeSource{
+		links: []*Link{
+			{ID: int64(1), URL: srv.URL + "/ok"},
+			{ID: int64(2), URL: srv.URL + "/gone"},
+			{ID: int64(3), URL: srv.URL + "/moved"},
+		},
+		results: make(map[interface{}]*Result),
+	}
+	sum, err := checker.CheckDue(context.Background(), src)
+	c.Assert(err, qt.IsNil)
+	c.Assert(sum, qt.DeepEquals, &Summary{NumChecked: 3, NumBroken: 1})
+	c.Assert(src.results, qt.HasLen, 3)
+	c.Assert(src.results[int64(2)].Status, qt.Equals, http.StatusGone)
+	c.Assert(src.results[int64(3)].FinalURL, qt.Equals, srv.URL+"/ok")
+}
+
+func TestCheckDueBatches(t *testing.T) {
+	c := qt.New(t)
+	srv := newTestServer(c)
+	checker := New()
+	checker.Client = &http.Client{Timeout: 100 * time.Millisecond}
+	checker.HostDelay = 0
+
+	// More links than fit in a batch are all checked in one run.
+	src := &fakeSource{results: make(map[interface{}]*Result)}
+	for i := 0; i < 2*BatchSize+1; i++ {
+		src.links = append(src.links, &Link{ID: i, URL: srv.URL + "/ok"})
+	}
+	sum, err := checker.CheckDue(context.Background(), src)
+	c.Assert(err, qt.IsNil)
+	c.Assert(sum, qt.DeepEquals, &Summary{NumChecked: 2*BatchSize + 1})
+	c.Assert(src.results, qt.HasLen, 2*BatchSize+1)
+}
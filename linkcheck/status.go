@@ -0,0 +1,45 @@
+package linkcheck
+
+import "time"
+
+// Services that check their links store the latest result in their rows.
+// They check them in batches of BatchSize, rechecking each link
+// at most once per RecheckInterval. A run checks batches until
+// no links are due or it has run for RunTime.
+const (
+	BatchSize       = 100
+	RecheckInterval = 24 * time.Hour
+	RunTime         = time.Hour
+)
+
+// Status is the stored result of checking whether a link still works.
+type Status struct {
+	Status    int       `json:"status,omitempty"`    // HTTP status code, or 0 if the request failed
+	FinalURL  string    `json:"final_url,omitempty"` // URL after following redirects
+	Error     string    `json:"error,omitempty"`     // why the request failed, if it did
+	Broken    bool      `json:"broken"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Columns are the link check columns of a row, for scanning.
+// They are stored as link_status, link_final_url, link_error,
+// link_broken and link_checked_at.
+type Columns struct {
+	Status    *int
+	FinalURL  string
+	Err       string
+	Broken    bool
+	CheckedAt *time.Time
+}
+
+// LinkStatus returns the link status, or nil if the link hasn't been checked.
+func (c *Columns) LinkStatus() *Status {
+	if c.CheckedAt == nil {
+		return nil
+	}
+	s := &Status{FinalURL: c.FinalURL, Error: c.Err, Broken: c.Broken, CheckedAt: *c.CheckedAt}
+	if c.Status != nil {
+		s.Status = *c.Status
+	}
+	return s
+}
@@ -0,0 +1,29 @@
+package linkcheck
+
+import (
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestColumnsLinkStatus(t *testing.T) {
+	c := qt.New(t)
+
+	// Links that haven't been checked have no status.
+	c.Assert((&Columns{}).LinkStatus(), qt.IsNil)
+
+	checkedAt := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	c.Assert((&Columns{Err: "timeout", Broken: true, CheckedAt: &checkedAt}).LinkStatus(), qt.DeepEquals, &Status{
+		Error:     "timeout",
+		Broken:    true,
+		CheckedAt: checkedAt,
+	})
+
+	status := 301
+	c.Assert((&Columns{Status: &status, FinalURL: "https://example.org/new", CheckedAt: &checkedAt}).LinkStatus(), qt.DeepEquals, &Status{
+		Status:    301,
+		FinalURL:  "https://example.org/new",
+		CheckedAt: checkedAt,
+	})
+}
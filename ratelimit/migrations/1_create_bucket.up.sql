@@ -0,0 +1,18 @@
+-- bucket tracks the token bucket for each route and client.
+-- A missing row is equivalent to a full bucket.
+CREATE TABLE "bucket" (
+    -- route identifies the rate limited endpoint.
+    route TEXT NOT NULL,
+
+    -- client identifies the client, typically by IP address.
+    client TEXT NOT NULL,
+
+    -- tokens is the number of tokens left in the bucket as of updated_at.
+    tokens DOUBLE PRECISION NOT NULL,
+
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+    PRIMARY KEY (route, client)
+);
+
+CREATE INDEX bucket_updated_at_idx ON "bucket" (updated_at);
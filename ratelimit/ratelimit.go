@@ -0,0 +1,196 @@
+// Package ratelimit implements rate limiting of requests
+// using token buckets stored in the database.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"encore.dev/beta/errs"
+	"encore.dev/cron"
+	"encore.dev/storage/sqldb"
+)
+
+// unknownClient is the client of the bucket shared by requests
+// without a usable client address.
+const unknownClient = "unknown"
+
+// allClients is the client of the bucket shared by all requests
+// to a route when TakeParams.AllClients is set.
+const allClients = "all"
+
+type TakeParams struct {
+	// Route identifies the endpoint being rate limited, such as "email.Subscribe".
+	Route string
+
+	// ForwardedFor is the X-Forwarded-For header of the request,
+	// used to identify the client.
+	ForwardedFor string
+
+	// ClientIP is the client address as reported by a trusted proxy in front
+	// of the API, such as the CF-Connecting-IP header set by Cloudflare.
+	// If set it identifies the client instead of ForwardedFor, whose last
+	// address is the proxy's rather than the client's.
+	ClientIP string
+
+	// AllClients makes every client share a single bucket for the route,
+	// limiting the route as a whole regardless of who makes the requests.
+	AllClients bool
+
+	// Rate is the number of requests per second a client may sustain.
+	Rate float64
+
+	// Burst is the number of requests a client may make in a burst.
+	Burst int
+}
+
+// RetryAfter is the error details of errors returned when
+// a client has been rate limited.
+//
+// Rate limited endpoints are raw, since typed endpoints can't set
+// response headers, and set the Retry-After header using SetHeader.
+type RetryAfter struct {
+	// Seconds is how long to wait before retrying,
+	// in the same format as the Retry-After header.
+	Seconds int `json:"retry_after"`
+}
+
+func (RetryAfter) ErrDetails() {}
+
+// SetHeader sets the Retry-After header of a response.
+func (r RetryAfter) SetHeader(h http.Header) {
+	h.Set("Retry-After", strconv.Itoa(r.Seconds))
+}
+
+// Take takes a token from the client's bucket for a route.
+// If the bucket is empty it returns an errs.ResourceExhausted error
+// with RetryAfter details.
+//
+// Requests without a usable client address share a single bucket,
+// so that a missing or malformed X-Forwarded-For header doesn't
+// bypass the limit.
+//encore:api private
+func Take(ctx context.Context, p *TakeParams) error {
+	eb := errs.B().Meta("route", p.Route)
+	if p.Rate <= 0 || p.Burst < 1 {
+		return eb.Code(errs.InvalidArgument).Msg("rate and burst must be positive").Err()
+	}
+	client := clientIP(p.ForwardedFor)
+	if p.ClientIP != "" {
+		client = normalizeIP(p.ClientIP)
+	}
+	if p.AllClients {
+		client = allClients
+	} else if client == "" {
+		client = unknownClient
+	}
+
+	tx, err := sqldb.Begin(ctx)
+	if err != nil {
+		return eb.Cause(err).Err()
+	}
+	defer tx.Rollback() // committed explicitly on success
+
+	now := time.Now()
+	var (
+		tokens    float64
+		updatedAt time.Time
+	)
+	err = tx.QueryRow(ctx, `
+		SELECT tokens, updated_at
+		FROM bucket
+		WHERE route = $1 AND client = $2
+		FOR UPDATE
+	`, p.Route, client).Scan(&tokens, &updatedAt)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		tokens, updatedAt = float64(p.Burst), now
+	} else if err != nil {
+		return eb.Cause(err).Err()
+	}
+
+	tokens, ok, wait := take(tokens, now.Sub(updatedAt), p.Rate, p.Burst)
+	_, err = tx.Exec(ctx, `
+		INSERT INTO bucket (route, client, tokens, updated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (route, client) DO UPDATE
+		SET tokens = $3, updated_at = $4
+	`, p.Route, client, tokens, now)
+	if err != nil {
+		return eb.Cause(err).Err()
+	} else if err := tx.Commit(); err != nil {
+		return eb.Cause(err).Err()
+	}
+
+	if !ok {
+		return eb.Code(errs.ResourceExhausted).
+			Details(RetryAfter{Seconds: int(math.Ceil(wait.Seconds()))}).
+			Msg("too many requests, please try again later").Err()
+	}
+	return nil
+}
+
+// take refills a bucket holding tokens after elapsed time and takes a token from it.
+// It reports the tokens left, whether a token was taken and,
+// if not, how long until one is available.
+func take(tokens float64, elapsed time.Duration, rate float64, burst int) (left float64, ok bool, wait time.Duration) {
+	if elapsed > 0 {
+		tokens = math.Min(float64(burst), tokens+elapsed.Seconds()*rate)
+	}
+	if tokens >= 1 {
+		return tokens - 1, true, 0
+	}
+	return tokens, false, time.Duration((1 - tokens) / rate * float64(time.Second))
+}
+
+// clientIP returns the client IP address from an X-Forwarded-For header,
+// or "" if there is none. It uses the last address, which is the one added
+// by our own proxy; earlier addresses are provided by the client and can't be trusted.
+func clientIP(forwardedFor string) string {
+	parts := strings.Split(forwardedFor, ",")
+	return normalizeIP(parts[len(parts)-1])
+}
+
+// normalizeIP returns the IP address addr in canonical form, or "" if it is invalid.
+// IPv6 addresses are reduced to their /64 prefix, since clients typically
+// have a whole prefix to pick addresses from.
+func normalizeIP(addr string) string {
+	ip := net.ParseIP(strings.TrimSpace(addr))
+	if ip == nil {
+		return ""
+	} else if ip.To4() == nil {
+		ip = ip.Mask(net.CIDRMask(64, 128))
+	}
+	return ip.String()
+}
+
+// PruneResponse reports the number of buckets pruned.
+type PruneResponse struct {
+	NumPruned int
+}
+
+// Prune removes buckets that haven't been used for a day.
+// They have been refilled by now unless the rate is very low,
+// in which case the client is given a fresh bucket.
+//encore:api private method=POST path=/ratelimit/prune
+func Prune(ctx context.Context) (*PruneResponse, error) {
+	res, err := sqldb.Exec(ctx, `
+		DELETE FROM bucket WHERE updated_at < NOW() - INTERVAL '1 day'
+	`)
+	if err != nil {
+		return nil, err
+	}
+	return &PruneResponse{NumPruned: int(res.RowsAffected())}, nil
+}
+
+// Prune unused buckets every hour.
+var _ = cron.NewJob("prune-rate-limit-buckets", cron.JobConfig{
+	Title:    "Prune unused rate limit buckets",
+	Every:    1 * cron.Hour,
+	Endpoint: Prune,
+})
@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"encore.dev/beta/errs"
+)
+
+func TestTake(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+	p := &TakeParams{
+		Route:        c.Name(),
+		ForwardedFor: "203.0.113.7, 198.51.100.1",
+		Rate:         1.0 / 60,
+		Burst:        2,
+	}
+
+	c.Assert(Take(ctx, p), qt.IsNil)
+	c.Assert(Take(ctx, p), qt.IsNil)
+	err := Take(ctx, p)
+	c.Assert(errs.Code(err), qt.Equals, errs.ResourceExhausted)
+	retry, ok := errs.Details(err).(RetryAfter)
+	c.Assert(ok, qt.IsTrue)
+	c.Assert(retry.Seconds > 0 && retry.Seconds <= 60, qt.IsTrue)
+
+	// Other clients aren't affected.
+	c.Assert(Take(ctx, &TakeParams{Route: p.Route, ForwardedFor: "198.51.100.2", Rate: p.Rate, Burst: p.Burst}), qt.IsNil)
+
+	// A trusted client address takes precedence over X-Forwarded-For,
+	// so clients behind the same proxy don't share a bucket.
+	c.Assert(Take(ctx, &TakeParams{Route: p.Route, ForwardedFor: p.ForwardedFor, ClientIP: "203.0.113.8", Rate: p.Rate, Burst: p.Burst}), qt.IsNil)
+
+	// Requests without a usable client address share a bucket.
+	for _, fwd := range []string{"", "bogus"} {
+		c.Assert(Take(ctx, &TakeParams{Route: p.Route, ForwardedFor: fwd, Rate: p.Rate, Burst: p.Burst}), qt.IsNil)
+	}
+	err = Take(ctx, &TakeParams{Route: p.Route, Rate: p.Rate, Burst: p.Burst})
+	c.Assert(errs.Code(err), qt.Equals, errs.ResourceExhausted)
+
+	// All clients of a route can share a bucket, whatever their address.
+	for _, ip := range []string{"203.0.113.10", "203.0.113.11"} {
+		c.Assert(Take(ctx, &TakeParams{Route: p.Route, ClientIP: ip, AllClients: true, Rate: p.Rate, Burst: p.Burst}), qt.IsNil)
+	}
+	err = Take(ctx, &TakeParams{Route: p.Route, ClientIP: "203.0.113.12", AllClients: true, Rate: p.Rate, Burst: p.Burst})
+	c.Assert(errs.Code(err), qt.Equals, errs.ResourceExhausted)
+}
+
+func TestTakeRefill(t *testing.T) {
+	c := qt.New(t)
+	tests := []struct {
+		tokens   float64
+		elapsed  time.Duration
+		wantLeft float64
+		wantOK   bool
+		wantWait time.Duration
+	}{
+		{tokens: 2, elapsed: 0, wantLeft: 1, wantOK: true},
+		{tokens: 0, elapsed: 0, wantLeft: 0, wantOK: false, wantWait: 2 * time.Second},
+		{tokens: 0.5, elapsed: 0, wantLeft: 0.5, wantOK: false, wantWait: time.Second},
+		{tokens: 0, elapsed: 2 * time.Second, wantLeft: 0, wantOK: true},
+		{tokens: 0, elapsed: time.Hour, wantLeft: 2, wantOK: true}, // capped at burst
+	}
+	for _, test := range tests {
+		left, ok, wait := take(test.tokens, test.elapsed, 0.5, 3)
+		c.Check(left, qt.Equals, test.wantLeft)
+		c.Check(ok, qt.Equals, test.wantOK)
+		c.Check(wait, qt.Equals, test.wantWait)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	c := qt.New(t)
+	c.Check(clientIP(""), qt.Equals, "")
+	c.Check(clientIP("bogus"), qt.Equals, "")
+	c.Check(clientIP("203.0.113.7"), qt.Equals, "203.0.113.7")
+	c.Check(clientIP("10.0.0.1, 203.0.113.7"), qt.Equals, "203.0.113.7")
+	c.Check(clientIP("2001:db8:1:2:3:4:5:6"), qt.Equals, "2001:db8:1:2::")
+}
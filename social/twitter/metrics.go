@@ -0,0 +1,232 @@
+package twitter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"encore.dev/beta/errs"
+	"encore.dev/cron"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+)
+
+// metricsWindow is how long after sending we keep collecting metrics for a tweet.
+const metricsWindow = 14 * 24 * time.Hour
+
+// metricsBatchSize is the maximum number of tweet ids per lookup request,
+// as limited by the Twitter API.
+const metricsBatchSize = 100
+
+type CollectMetricsResponse struct {
+	NumTweets int // number of tweets that metrics were collected for
+	NumFailed int // number of tweets whose metrics couldn't be looked up
+}
+
+// CollectMetrics fetches public engagement metrics for recently sent tweets
+// and stores a snapshot of them. A batch that can't be looked up is skipped
+// and retried on the next run, rather than failing the other batches.
+//encore:api private method=POST path=/twitter/collect-metrics
+func CollectMetrics(ctx context.Context) (*CollectMetricsResponse, error) {
+	eb := errs.B()
+	tweets, err := querySentTweets(ctx, time.Now().Add(-metricsWindow))
+	if err != nil {
+		return nil, eb.Cause(err).Msg("unable to query sent tweets").Err()
+	}
+
+	var collected, failed int
+	for len(tweets) > 0 {
+		n := len(tweets)
+		if n > metricsBatchSize {
+			n = metricsBatchSize
+		}
+		batch := tweets[:n]
+		tweets = tweets[n:]
+
+		ids := make([]string, 0, len(batch))
+		for _, t := range batch {
+			ids = append(ids, t.TweetID)
+		}
+		metrics, err := lookupMetrics(ctx, ids)
+		if err != nil {
+			rlog.Error("unable to look up tweet metrics", "tweets", len(ids), "err", err)
+			failed += len(batch)
+			continue
+		}
+
+		for _, t := range batch {
+			m, ok := metrics[t.TweetID]
+			if !ok {
+				// The tweet may have been deleted.
+				continue
+			}
+			_, err := sqldb.Exec(ctx, `
+				INSERT INTO tweet_metric (scheduled_tweet_id, likes, reposts, replies, impressions)
+				VALUES ($1, $2, $3, $4, $5)
+			`, t.ID, m.Likes, m.Reposts, m.Replies, m.Impressions)
+			if err != nil {
+				return nil, eb.Cause(err).Msg("unable to insert metrics").Err()
+			}
+			collected++
+		}
+	}
+	return &CollectMetricsResponse{NumTweets: collected, NumFailed: failed}, nil
+}
+
+type StatsParams struct {
+	// Source optionally filters the results to a single kind of content,
+	// such as "byte" or "post".
+	Source string `json:"source,omitempty"`
+
+	// Limit is the maximum number of results. It defaults to 20.
+	Limit int `json:"limit,omitempty"`
+}
+
+// ContentStats describes the engagement of a promoted piece of content,
+// summed over the latest metrics of all the tweets promoting it.
+type ContentStats struct {
+	Source      string    `json:"source,omitempty"`    // kind of content, such as "byte" or "post"
+	SourceID    string    `json:"source_id,omitempty"` // byte id or post slug
+	Tweets      int       `json:"tweets,omitempty"`    // number of tweets with metrics
+	Likes       int       `json:"likes,omitempty"`
+	Reposts     int       `json:"reposts,omitempty"`
+	Replies     int       `json:"replies,omitempty"`
+	Impressions int       `json:"impressions,omitempty"`
+	Engagement  int       `json:"engagement,omitempty"`   // sum of likes, reposts and replies
+	CollectedAt time.Time `json:"collected_at,omitempty"` // when metrics were last collected
+}
+
+type StatsResponse struct {
+	Stats []*ContentStats `json:"stats"`
+}
+
+// Stats ranks promoted content by the engagement of its tweets.
+//encore:api auth method=GET path=/twitter/stats
+func Stats(ctx context.Context, p *StatsParams) (*StatsResponse, error) {
+	limit := p.Limit
+	if limit < 0 {
+		return nil, errs.B().Code(errs.InvalidArgument).Meta("limit", limit).Msg("limit must not be negative").Err()
+	} else if limit == 0 {
+		limit = 20
+	}
+	rows, err := sqldb.Query(ctx, `
+		SELECT source, source_id, COUNT(*), SUM(likes), SUM(reposts), SUM(replies), SUM(impressions), MAX(collected_at)
+		FROM (
+			SELECT DISTINCT ON (t.id)
+				t.source, COALESCE(t.source_id, '') AS source_id,
+				m.likes, m.reposts, m.replies, m.impressions, m.collected_at
+			FROM scheduled_tweet t
+			INNER JOIN tweet_metric m ON (m.scheduled_tweet_id = t.id)
+			WHERE t.source IS NOT NULL AND ($1 = '' OR t.source = $1)
+			ORDER BY t.id, m.collected_at DESC
+		) latest
+		GROUP BY source, source_id
+		ORDER BY SUM(likes + reposts + replies) DESC, SUM(impressions) DESC
+		LIMIT $2
+	`, p.Source, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []*ContentStats{}
+	for rows.Next() {
+		var s ContentStats
+		if err := rows.Scan(&s.Source, &s.SourceID, &s.Tweets, &s.Likes, &s.Reposts, &s.Replies, &s.Impressions, &s.CollectedAt); err != nil {
+			return nil, err
+		}
+		s.Engagement = s.Likes + s.Reposts + s.Replies
+		stats = append(stats, &s)
+	}
+	return &StatsResponse{Stats: stats}, rows.Err()
+}
+
+// sentTweet is a sent tweet whose metrics should be collected.
+type sentTweet struct {
+	ID      int64  // scheduled tweet id
+	TweetID string // id of the tweet on Twitter
+}
+
+// querySentTweets reports the tweets that were sent since the given time.
+// Tweets that were not posted to Twitter, like mock tweets, are skipped.
+func querySentTweets(ctx context.Context, since time.Time) ([]sentTweet, error) {
+	rows, err := sqldb.Query(ctx, `
+		SELECT id, tweet_id
+		FROM scheduled_tweet
+		WHERE tweet_id IS NOT NULL AND sent_at >= $1
+		ORDER BY id
+	`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tweets []sentTweet
+	for rows.Next() {
+		var t sentTweet
+		if err := rows.Scan(&t.ID, &t.TweetID); err != nil {
+			return nil, err
+		}
+		if _, err := strconv.ParseInt(t.TweetID, 10, 64); err != nil {
+			continue
+		}
+		tweets = append(tweets, t)
+	}
+	return tweets, rows.Err()
+}
+
+// publicMetrics are the engagement counters Twitter reports for a tweet.
+type publicMetrics struct {
+	Likes       int `json:"like_count"`
+	Reposts     int `json:"retweet_count"`
+	Replies     int `json:"reply_count"`
+	Impressions int `json:"impression_count"`
+}
+
+// lookupMetrics fetches the public metrics for the given tweet ids,
+// keyed by tweet id. It is a variable to allow for mocking in tests.
+var lookupMetrics = func(ctx context.Context, ids []string) (map[string]publicMetrics, error) {
+	q := url.Values{
+		"ids":          []string{strings.Join(ids, ",")},
+		"tweet.fields": []string{"public_metrics"},
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://api.twitter.com/2/tweets?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := twitterHTTPClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("twitter lookup: got status %s", resp.Status)
+	}
+
+	var body struct {
+		Data []struct {
+			ID            string        `json:"id"`
+			PublicMetrics publicMetrics `json:"public_metrics"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	metrics := make(map[string]publicMetrics, len(body.Data))
+	for _, d := range body.Data {
+		metrics[d.ID] = d.PublicMetrics
+	}
+	return metrics, nil
+}
+
+// Collect tweet metrics every hour.
+var _ = cron.NewJob("collect-tweet-metrics", cron.JobConfig{
+	Title:    "Collect tweet engagement metrics",
+	Every:    1 * cron.Hour,
+	Endpoint: CollectMetrics,
+})
@@ -0,0 +1,97 @@
+package twitter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"encore.dev/storage/sqldb"
+)
+
+func TestCollectMetrics(t *testing.T) {
+	c := qt.New(t)
+	ctx := auth.WithContext(context.Background(), "user-id", nil)
+	useLookupMock(c, map[string]publicMetrics{
+		"1001": {Likes: 1, Reposts: 1, Replies: 0, Impressions: 100},
+		"1002": {Likes: 10, Reposts: 3, Replies: 2, Impressions: 500},
+		"1003": {Likes: 1, Reposts: 0, Replies: 0, Impressions: 50},
+	})
+
+	// Schedule three promotions of two pieces of content and mark them as sent.
+	source := c.Name()
+	for i, tweetID := range []string{"1001", "1002", "1003"} {
+		resp, err := Schedule(ctx, &ScheduleParams{
+			Tweet:    &TweetParams{Text: "promoting"},
+			SendAt:   time.Now(),
+			Source:   source,
+			SourceID: []string{"low", "high", "high"}[i],
+		})
+		c.Assert(err, qt.IsNil)
+		_, err = sqldb.Exec(ctx, `
+			UPDATE scheduled_tweet SET sent_at = NOW(), tweet_id = $2 WHERE id = $1
+		`, resp.ID, tweetID)
+		c.Assert(err, qt.IsNil)
+	}
+
+	collected, err := CollectMetrics(ctx)
+	c.Assert(err, qt.IsNil)
+	c.Assert(collected.NumTweets >= 3, qt.IsTrue)
+
+	// The most engaging content should be ranked first,
+	// summed over all the tweets promoting it.
+	stats, err := Stats(ctx, &StatsParams{Source: source})
+	c.Assert(err, qt.IsNil)
+	c.Assert(stats.Stats, qt.HasLen, 2)
+	c.Assert(stats.Stats[0].SourceID, qt.Equals, "high")
+	c.Assert(stats.Stats[0].Tweets, qt.Equals, 2)
+	c.Assert(stats.Stats[0].Engagement, qt.Equals, 16)
+	c.Assert(stats.Stats[0].Impressions, qt.Equals, 550)
+	c.Assert(stats.Stats[1].SourceID, qt.Equals, "low")
+
+	_, err = Stats(ctx, &StatsParams{Limit: -1})
+	c.Check(errs.Code(err), qt.Equals, errs.InvalidArgument)
+}
+
+func TestCollectMetricsLookupError(t *testing.T) {
+	c := qt.New(t)
+	ctx := auth.WithContext(context.Background(), "user-id", nil)
+	orig := lookupMetrics
+	lookupMetrics = func(ctx context.Context, ids []string) (map[string]publicMetrics, error) {
+		return nil, errors.New("rate limited")
+	}
+	c.Cleanup(func() {
+		lookupMetrics = orig
+	})
+
+	resp, err := Schedule(ctx, &ScheduleParams{
+		Tweet:    &TweetParams{Text: "promoting"},
+		SendAt:   time.Now(),
+		Source:   c.Name(),
+		SourceID: "failing",
+	})
+	c.Assert(err, qt.IsNil)
+	_, err = sqldb.Exec(ctx, `
+		UPDATE scheduled_tweet SET sent_at = NOW(), tweet_id = '2001' WHERE id = $1
+	`, resp.ID)
+	c.Assert(err, qt.IsNil)
+
+	// A failed lookup is reported but doesn't fail the run.
+	collected, err := CollectMetrics(ctx)
+	c.Assert(err, qt.IsNil)
+	c.Assert(collected.NumFailed >= 1, qt.IsTrue)
+}
+
+func useLookupMock(c *qt.C, metrics map[string]publicMetrics) {
+	orig := lookupMetrics
+	lookupMetrics = func(ctx context.Context, ids []string) (map[string]publicMetrics, error) {
+		return metrics, nil
+	}
+	c.Cleanup(func() {
+		lookupMetrics = orig
+	})
+}
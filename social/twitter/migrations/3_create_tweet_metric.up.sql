@@ -0,0 +1,24 @@
+-- source and source_id identify the content a scheduled tweet promotes,
+-- such as ('byte', '42') or ('post', 'my-slug').
+ALTER TABLE "scheduled_tweet" ADD COLUMN source TEXT NULL;
+ALTER TABLE "scheduled_tweet" ADD COLUMN source_id TEXT NULL;
+
+-- tweet_metric is a time series of public engagement metrics for sent tweets.
+CREATE TABLE "tweet_metric" (
+    id BIGSERIAL PRIMARY KEY,
+
+    -- scheduled_tweet_id is the scheduled tweet the metrics belong to.
+    scheduled_tweet_id BIGINT NOT NULL REFERENCES "scheduled_tweet" (id),
+
+    -- likes, reposts, replies and impressions are the counters
+    -- reported by Twitter at the time of collection.
+    likes INTEGER NOT NULL,
+    reposts INTEGER NOT NULL,
+    replies INTEGER NOT NULL,
+    impressions INTEGER NOT NULL,
+
+    -- collected_at is when the metrics were fetched.
+    collected_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX tweet_metric_tweet_idx ON "tweet_metric" (scheduled_tweet_id, collected_at DESC);
@@ -2,19 +2,25 @@
 package twitter
 
 import (
+	"net/http"
+
 	"github.com/dghubble/go-twitter/twitter"
 	"github.com/dghubble/oauth1"
 )
 
 func twitterClient() *twitter.Client {
+	// twitter client
+	client := twitter.NewClient(twitterHTTPClient())
+	return client
+}
+
+// twitterHTTPClient returns an http.Client that authorizes requests
+// to the Twitter API with the account's OAuth1 credentials.
+func twitterHTTPClient() *http.Client {
 	config := oauth1.NewConfig(secrets.TwitterAPIKey, secrets.TwitterAPISecret)
 	token := oauth1.NewToken(secrets.TwitterAccessToken, secrets.TwitterAccessSecret)
 	// http.Client will automatically authorize Requests
-	httpClient := config.Client(oauth1.NoContext, token)
-
-	// twitter client
-	client := twitter.NewClient(httpClient)
-	return client
+	return config.Client(oauth1.NoContext, token)
 }
 
 var secrets struct {
@@ -56,6 +56,13 @@ type ScheduleParams struct {
 
 	// SendAt is the time to send it at.
 	SendAt time.Time `json:"send_at,omitempty"`
+
+	// Source optionally identifies the kind of content the tweet promotes,
+	// such as "byte" or "post". It is used for engagement reporting.
+	Source string `json:"source,omitempty"`
+
+	// SourceID is the id of the promoted content, such as the byte id or post slug.
+	SourceID string `json:"source_id,omitempty"`
 }
 
 type ScheduleResponse struct {
@@ -74,10 +81,10 @@ func Schedule(ctx context.Context, p *ScheduleParams) (*ScheduleResponse, error)
 
 	var id int64
 	err = sqldb.QueryRow(ctx, `
-		INSERT INTO scheduled_tweet (tweet_data, scheduled_at)
-		VALUES ($1, $2)
+		INSERT INTO scheduled_tweet (tweet_data, scheduled_at, source, source_id)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''))
 		RETURNING id
-	`, data, p.SendAt).Scan(&id)
+	`, data, p.SendAt, p.Source, p.SourceID).Scan(&id)
 	if err != nil {
 		return nil, eb.Cause(err).Msg("unable to insert row").Err()
 	}
@@ -2,8 +2,98 @@ package url
 
 import (
 	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
 )
 
+//go:embed config.json
+var cfgData []byte
+
+var cfg struct {
+	// AllowedDomains are the only destination domains that may be shortened,
+	// including their subdomains. If empty, all domains are allowed
+	// except for DeniedDomains.
+	AllowedDomains []string `json:"allowed_domains"`
+
+	// DeniedDomains are destination domains that may not be shortened,
+	// including their subdomains. It takes precedence over AllowedDomains.
+	DeniedDomains []string `json:"denied_domains"`
+
+	// CountryHeader is the request header set by the CDN or load balancer
+	// in front of the redirect endpoint with the client's country code.
+	CountryHeader string `json:"country_header"`
+
+	// ClientIPHeader is the request header set by the CDN or load balancer
+	// in front of the redirect endpoint with the client's IP address.
+	// Passphrase attempts are limited per address in it, since short URLs
+	// reach the redirect endpoint through the frontend, whose address is
+	// the last one in X-Forwarded-For for every visitor.
+	ClientIPHeader string `json:"client_ip_header"`
+
+	// EdgeSecretHeader is the request header the CDN sets to the EdgeSecret
+	// secret. ClientIPHeader is only trusted on requests that have it, since
+	// anyone calling the API directly can set ClientIPHeader themselves.
+	EdgeSecretHeader string `json:"edge_secret_header"`
+
+	// ShortURLBase is the base URL short ids are appended to.
+	// It must route to the Redirect endpoint, at /r/ on the API,
+	// which the frontend does for url.bjk.fyi. Its host is always denied
+	// as a destination, so short URLs can't redirect to short URLs.
+	ShortURLBase string `json:"short_url_base"`
+
+	// IDAlphabet are the characters generated ids consist of.
+	// It should leave out characters that are easily confused, like 0 and O.
+	IDAlphabet string `json:"id_alphabet"`
+
+	// IDLength is the number of characters in generated ids.
+	IDLength int `json:"id_length"`
+}
+
+func init() {
+	if err := json.Unmarshal(cfgData, &cfg); err != nil {
+		log.Fatalln("could not decode config:", err)
+	}
+	if !strings.HasSuffix(cfg.ShortURLBase, "/") {
+		cfg.ShortURLBase += "/"
+	}
+	base, err := url.Parse(cfg.ShortURLBase)
+	if err != nil || base.Hostname() == "" {
+		log.Fatalln("invalid config: bad short_url_base", cfg.ShortURLBase)
+	}
+	cfg.DeniedDomains = append(cfg.DeniedDomains, base.Hostname())
+	if err := checkIDConfig(cfg.IDAlphabet, cfg.IDLength); err != nil {
+		log.Fatalln("invalid config:", err)
+	}
+}
+
+// checkIDConfig reports an error if ids generated from the alphabet
+// and length would be invalid or too easy to guess.
+func checkIDConfig(alphabet string, length int) error {
+	seen := make(map[rune]bool)
+	for _, r := range alphabet {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '-' || r == '_') {
+			return fmt.Errorf("id alphabet may only contain letters, digits, '-' and '_', not %q", r)
+		} else if seen[r] {
+			return fmt.Errorf("id alphabet contains %q more than once", r)
+		}
+		seen[r] = true
+	}
+	if len(seen) < 16 {
+		return errors.New("id alphabet must contain at least 16 characters")
+	} else if length < 4 {
+		return errors.New("id length must be at least 4")
+	}
+	return nil
+}
+
 var secrets struct {
 	AuthPassword string
+
+	// EdgeSecret is sent by the CDN in EdgeSecretHeader,
+	// identifying requests that came through it.
+	EdgeSecret string
 }
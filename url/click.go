@@ -0,0 +1,375 @@
+package url
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"encore.app/ratelimit"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
+	"encore.dev/storage/sqldb"
+)
+
+// Redirect redirects to the original URL for the short id in the path
+// and records the click. Short URLs on short_url_base are rewritten
+// to it by the frontend.
+//
+// It responds with 302 Found rather than 301 Moved Permanently
+// since browsers cache permanent redirects, so later clicks
+// would never reach us and couldn't be counted or limited.
+// Expired short URLs respond with 410 Gone, and protected ones
+// with a form for entering the passphrase, which is posted back.
+//
+//encore:api public raw method=GET,POST path=/r/:id
+func Redirect(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	id := strings.TrimPrefix(req.URL.Path, "/r/")
+	if unescaped, err := url.PathUnescape(id); err == nil {
+		id = unescaped
+	}
+
+	u := &URL{ID: id}
+	var passphraseHash string
+	var clicks int
+	err := sqldb.QueryRow(ctx, `
+        SELECT original_url, expires_at, max_clicks, disabled, passphrase_hash, `+countedClicks+`
+        FROM url u
+        WHERE id = $1
+    `, id).Scan(&u.URL, &u.ExpiresAt, &u.MaxClicks, &u.Disabled, &passphraseHash, &clicks)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		errs.HTTPError(w, errs.B().Code(errs.NotFound).Meta("id", id).Msg("short url not found").Err())
+		return
+	} else if err != nil {
+		errs.HTTPError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "private, no-store")
+	switch u.state(time.Now(), clicks) {
+	case linkDisabled:
+		// Disabled links may be enabled again, so they're not gone.
+		errs.HTTPError(w, errs.B().Code(errs.NotFound).Meta("id", id).Msg("short url not found").Err())
+		return
+	case linkExpired:
+		http.Error(w, "This link has expired.", http.StatusGone)
+		return
+	}
+
+	if passphraseHash != "" {
+		passphrase := req.PostFormValue("passphrase")
+		if passphrase != "" {
+			// Throttle attempts before checking them, so that guessing
+			// can't continue past the limit.
+			if err := takePassphraseAttempt(ctx, id, req); err != nil {
+				setRetryAfter(w, err)
+				errs.HTTPError(w, err)
+				return
+			}
+		}
+		if !checkPassphrase(passphraseHash, passphrase) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			if req.Method == http.MethodPost {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+			passphraseForm.Execute(w, passphrase != "")
+			return
+		}
+	}
+
+	ok, err := recordClick(ctx, id, u.MaxClicks, req)
+	if err != nil {
+		// Failing to record the click shouldn't break the link.
+		rlog.Error("failed to record click", "id", id, "err", err)
+	} else if !ok {
+		// Concurrent clicks used up the click limit.
+		http.Error(w, "This link has expired.", http.StatusGone)
+		return
+	}
+	http.Redirect(w, req, u.URL, http.StatusFound)
+}
+
+// passphraseRate and passphraseBurst limit how often a client
+// may try the passphrase of a short URL. passphraseLinkRate and
+// passphraseLinkBurst limit the attempts on a short URL from all clients
+// together, so that guessing can't be spread over many addresses.
+const (
+	passphraseRate      = 10.0 / 3600 // 10 per hour
+	passphraseBurst     = 5
+	passphraseLinkRate  = 30.0 / 3600 // 30 per hour
+	passphraseLinkBurst = 30
+)
+
+// takePassphraseAttempt takes a passphrase attempt for the short URL
+// with the given id from the client's rate limit bucket, and from the
+// bucket shared by all clients of the short URL.
+// It reports an errs.ResourceExhausted error if too many attempts have
+// been made, and denies the attempt if it can't be rate limited.
+func takePassphraseAttempt(ctx context.Context, id string, req *http.Request) error {
+	route := "url.Redirect/" + id
+	for _, p := range []*ratelimit.TakeParams{
+		{Route: route, ForwardedFor: req.Header.Get("X-Forwarded-For"), ClientIP: edgeClientIP(req), Rate: passphraseRate, Burst: passphraseBurst},
+		{Route: route, AllClients: true, Rate: passphraseLinkRate, Burst: passphraseLinkBurst},
+	} {
+		err := ratelimit.Take(ctx, p)
+		if errs.Code(err) == errs.ResourceExhausted {
+			return err
+		} else if err != nil {
+			rlog.Error("failed to rate limit passphrase attempt", "id", id, "err", err)
+			return errs.B().Code(errs.Unavailable).Meta("id", id).Msg("unable to check passphrase, please try again later").Err()
+		}
+	}
+	return nil
+}
+
+// edgeClientIP returns the client address set by the CDN in the configured
+// client IP header, or "" if the request didn't come through the CDN.
+func edgeClientIP(req *http.Request) string {
+	secret := req.Header.Get(cfg.EdgeSecretHeader)
+	if secrets.EdgeSecret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(secrets.EdgeSecret)) != 1 {
+		return ""
+	}
+	return req.Header.Get(cfg.ClientIPHeader)
+}
+
+// setRetryAfter sets the Retry-After header from the details of a rate limit error.
+func setRetryAfter(w http.ResponseWriter, err error) {
+	if retry, ok := errs.Details(err).(ratelimit.RetryAfter); ok {
+		retry.SetHeader(w.Header())
+	}
+}
+
+// passphraseForm asks for the passphrase of a protected short URL.
+// Its data reports whether a wrong passphrase was entered.
+var passphraseForm = template.Must(template.New("passphrase").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Passphrase required</title></head>
+<body>
+<form method="POST">
+<p><label for="passphrase">This link is protected. Enter the passphrase to continue.</label></p>
+{{if .}}<p>Wrong passphrase, please try again.</p>
+{{end}}<p><input id="passphrase" name="passphrase" type="password" autofocus required> <button type="submit">Continue</button></p>
+</form>
+</body>
+</html>
+`))
+
+// botAgent is the user agent family of bots, such as link previews.
+const botAgent = "Bot"
+
+// countedClicks is the SQL expression for the number of clicks counted
+// against the click limit of the short URL u, or 0 if it has no limit.
+// Every redirect counts, since the user agent is up to the client.
+const countedClicks = `CASE WHEN u.max_clicks > 0 THEN (
+            SELECT COUNT(*) FROM url_click c WHERE c.url_id = u.id
+        ) ELSE 0 END`
+
+// recordClick records a click on the short URL with the given id.
+// If the short URL has a click limit it locks the short URL while
+// counting its clicks, so concurrent clicks can't exceed the limit,
+// and reports false without recording the click if it was reached.
+func recordClick(ctx context.Context, id string, maxClicks int, req *http.Request) (ok bool, err error) {
+	agent := userAgentFamily(req.UserAgent())
+	tx, err := sqldb.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback() // committed explicitly on success
+
+	if maxClicks > 0 {
+		// Count in a separate statement after taking the lock,
+		// so the count includes clicks committed while waiting for it.
+		if _, err := tx.Exec(ctx, `SELECT id FROM url WHERE id = $1 FOR UPDATE`, id); err != nil {
+			return false, err
+		}
+		var clicks int
+		err := tx.QueryRow(ctx, `
+            SELECT `+countedClicks+`
+            FROM url u
+            WHERE id = $1
+        `, id).Scan(&clicks)
+		if err != nil {
+			return false, err
+		} else if clicks >= maxClicks {
+			return false, nil
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+        INSERT INTO url_click (url_id, referrer, user_agent, country)
+        VALUES ($1, $2, $3, $4)
+    `, id, referrerHost(req.Referer()), agent, country(req.Header.Get(cfg.CountryHeader)))
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+type StatsParams struct {
+	// Days is the number of days to report daily counts for,
+	// including today. It defaults to 30 and is at most 365.
+	Days int `json:"days,omitempty"`
+}
+
+type Stats struct {
+	ID string `json:"id,omitempty"`
+
+	// Total is the total number of clicks ever.
+	Total int `json:"total"`
+
+	// Daily are the number of clicks per day, oldest first.
+	Daily []*DailyClicks `json:"daily"`
+
+	// TopReferrers are the referring hosts with the most clicks
+	// over the reported days, most clicks first.
+	TopReferrers []*ReferrerClicks `json:"top_referrers"`
+}
+
+type DailyClicks struct {
+	Date   string `json:"date,omitempty"` // in YYYY-MM-DD format, UTC
+	Clicks int    `json:"clicks"`
+}
+
+type ReferrerClicks struct {
+	Referrer string `json:"referrer"` // empty for direct visits
+	Clicks   int    `json:"clicks"`
+}
+
+// maxTopReferrers is the number of referrers reported in Stats.
+const maxTopReferrers = 10
+
+// maxStatsDays is the maximum number of days reported in Stats.
+const maxStatsDays = 365
+
+// GetStats reports click statistics for a short URL.
+//
+//encore:api auth method=GET path=/url/:id/stats
+func GetStats(ctx context.Context, id string, p *StatsParams) (*Stats, error) {
+	eb := errs.B().Meta("id", id)
+	days := p.Days
+	if days <= 0 {
+		days = 30
+	} else if days > maxStatsDays {
+		days = maxStatsDays
+	}
+	since := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -(days - 1))
+
+	s := &Stats{ID: id, Daily: []*DailyClicks{}, TopReferrers: []*ReferrerClicks{}}
+	err := sqldb.QueryRow(ctx, `
+        SELECT (SELECT COUNT(*) FROM url_click c WHERE c.url_id = u.id)
+        FROM url u
+        WHERE u.id = $1
+    `, id).Scan(&s.Total)
+	if errors.Is(err, sqldb.ErrNoRows) {
+		return nil, eb.Code(errs.NotFound).Msg("short url not found").Err()
+	} else if err != nil {
+		return nil, eb.Cause(err).Err()
+	}
+
+	rows, err := sqldb.Query(ctx, `
+        SELECT to_char(d.day, 'YYYY-MM-DD'), COUNT(c.id)
+        FROM generate_series($2::timestamptz, NOW(), '1 day') AS d(day)
+        LEFT JOIN url_click c ON c.url_id = $1
+            AND c.clicked_at >= d.day AND c.clicked_at < d.day + INTERVAL '1 day'
+        GROUP BY d.day
+        ORDER BY d.day
+    `, id, since)
+	if err != nil {
+		return nil, eb.Cause(err).Err()
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d DailyClicks
+		if err := rows.Scan(&d.Date, &d.Clicks); err != nil {
+			return nil, eb.Cause(err).Err()
+		}
+		s.Daily = append(s.Daily, &d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, eb.Cause(err).Err()
+	}
+
+	rows, err = sqldb.Query(ctx, `
+        SELECT referrer, COUNT(*)
+        FROM url_click
+        WHERE url_id = $1 AND clicked_at >= $2
+        GROUP BY referrer
+        ORDER BY COUNT(*) DESC, referrer
+        LIMIT $3
+    `, id, since, maxTopReferrers)
+	if err != nil {
+		return nil, eb.Cause(err).Err()
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r ReferrerClicks
+		if err := rows.Scan(&r.Referrer, &r.Clicks); err != nil {
+			return nil, eb.Cause(err).Err()
+		}
+		s.TopReferrers = append(s.TopReferrers, &r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, eb.Cause(err).Err()
+	}
+	return s, nil
+}
+
+// referrerHost returns the host of the referring page, without any "www." prefix.
+// Only the host is kept so that full URLs, which may include private
+// information such as search terms, aren't stored.
+func referrerHost(referrer string) string {
+	u, err := url.Parse(referrer)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// userAgentFamily classifies a User-Agent header into a browser family.
+// Only the family is kept since full user agents are close to unique.
+func userAgentFamily(ua string) string {
+	lower := strings.ToLower(ua)
+	switch {
+	case ua == "":
+		return ""
+	case strings.Contains(lower, "bot"), strings.Contains(lower, "crawl"),
+		strings.Contains(lower, "spider"), strings.Contains(lower, "slurp"),
+		strings.Contains(lower, "facebookexternalhit"):
+		return botAgent
+	case strings.HasPrefix(lower, "curl/"), strings.HasPrefix(lower, "wget/"):
+		return "CLI"
+	// Check the browsers based on Chrome before Chrome itself,
+	// and Chrome before Safari since all of them claim to be Safari.
+	case strings.Contains(ua, "Edg/"), strings.Contains(ua, "EdgA/"), strings.Contains(ua, "EdgiOS/"):
+		return "Edge"
+	case strings.Contains(ua, "OPR/"):
+		return "Opera"
+	case strings.Contains(ua, "Firefox/"), strings.Contains(ua, "FxiOS/"):
+		return "Firefox"
+	case strings.Contains(ua, "Chrome/"), strings.Contains(ua, "CriOS/"):
+		return "Chrome"
+	case strings.Contains(ua, "Safari/"):
+		return "Safari"
+	default:
+		return "Other"
+	}
+}
+
+// country validates a country code from the CDN's country header.
+func country(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 2 {
+		return ""
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return ""
+		}
+	}
+	return code
+}
@@ -0,0 +1,95 @@
+package url
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"encore.dev/beta/errs"
+)
+
+func TestReferrerHost(t *testing.T) {
+	c := qt.New(t)
+	c.Check(referrerHost(""), qt.Equals, "")
+	c.Check(referrerHost("https://www.Google.com/search?q=secret"), qt.Equals, "google.com")
+	c.Check(referrerHost("https://news.ycombinator.com/item?id=1"), qt.Equals, "news.ycombinator.com")
+	c.Check(referrerHost("android-app://com.slack"), qt.Equals, "com.slack")
+	c.Check(referrerHost("%zz"), qt.Equals, "")
+}
+
+func TestUserAgentFamily(t *testing.T) {
+	c := qt.New(t)
+	tests := []struct {
+		ua, family string
+	}{
+		{"", ""},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/100.0.4896.75 Safari/537.36", "Chrome"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/100.0.4896.75 Safari/537.36 Edg/100.0.1185.39", "Edge"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/100.0.4896.75 Safari/537.36 OPR/86.0.4363.23", "Opera"},
+		{"Mozilla/5.0 (X11; Linux x86_64; rv:99.0) Gecko/20100101 Firefox/99.0", "Firefox"},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 15_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/15.4 Mobile/15E148 Safari/604.1", "Safari"},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", "Bot"},
+		{"Twitterbot/1.0", "Bot"},
+		{"curl/7.79.1", "CLI"},
+		{"Lynx/2.8.9rel.1", "Other"},
+	}
+	for _, test := range tests {
+		c.Check(userAgentFamily(test.ua), qt.Equals, test.family, qt.Commentf("%s", test.ua))
+	}
+}
+
+func TestCountry(t *testing.T) {
+	c := qt.New(t)
+	c.Check(country("us"), qt.Equals, "US")
+	c.Check(country(" DE "), qt.Equals, "DE")
+	c.Check(country(""), qt.Equals, "")
+	c.Check(country("T1"), qt.Equals, "")
+	c.Check(country("USA"), qt.Equals, "")
+}
+
+func TestTakePassphraseAttempt(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+	id := "passphrase-" + c.Name()
+	orig := secrets.EdgeSecret
+	secrets.EdgeSecret = "edge-secret"
+	c.Cleanup(func() { secrets.EdgeSecret = orig })
+
+	// attempt makes an attempt from ip through the frontend proxy,
+	// having come through the CDN if edgeSecret is set.
+	attempt := func(ip, edgeSecret string) error {
+		req := httptest.NewRequest("POST", "/r/"+id, nil)
+		req.Header.Set("X-Forwarded-For", ip+", 198.51.100.1")
+		req.Header.Set(cfg.ClientIPHeader, ip)
+		if edgeSecret != "" {
+			req.Header.Set(cfg.EdgeSecretHeader, edgeSecret)
+		}
+		return takePassphraseAttempt(ctx, id, req)
+	}
+
+	for i := 0; i < passphraseBurst; i++ {
+		c.Assert(attempt("203.0.113.7", "edge-secret"), qt.IsNil)
+	}
+	c.Assert(errs.Code(attempt("203.0.113.7", "edge-secret")), qt.Equals, errs.ResourceExhausted)
+
+	// Visitors behind the same frontend proxy don't share a bucket,
+	// so one of them using up their attempts doesn't lock out the others.
+	c.Assert(attempt("203.0.113.8", "edge-secret"), qt.IsNil)
+
+	// Without the edge secret the client IP header isn't trusted,
+	// so changing it doesn't give a fresh bucket.
+	for i := 0; i < passphraseBurst; i++ {
+		c.Assert(attempt("203.0.113.9", "wrong"), qt.IsNil)
+	}
+	c.Assert(errs.Code(attempt("203.0.113.10", "wrong")), qt.Equals, errs.ResourceExhausted)
+
+	// Attempts from all clients together are limited too.
+	var err error
+	for i := 0; i < passphraseLinkBurst && err == nil; i++ {
+		err = attempt(fmt.Sprintf("192.0.2.%d", i), "edge-secret")
+	}
+	c.Assert(errs.Code(err), qt.Equals, errs.ResourceExhausted)
+}
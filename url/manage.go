@@ -0,0 +1,194 @@
+package url
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"encore.dev/storage/sqldb"
+)
+
+type UpdateParams struct {
+	// ExpiresAt, if set, is the new time the short URL stops redirecting.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// NoExpiry removes the expiry time of the short URL.
+	NoExpiry bool `json:"no_expiry,omitempty"`
+
+	// MaxClicks, if set, is the new click limit. 0 removes the limit.
+	MaxClicks *int `json:"max_clicks,omitempty"`
+
+	// Disabled, if set, disables or enables the short URL.
+	Disabled *bool `json:"disabled,omitempty"`
+
+	// Passphrase, if set, is the new passphrase. Empty removes the passphrase.
+	Passphrase *string `json:"passphrase,omitempty"`
+}
+
+// Update updates the expiry, click limit, disabled flag or passphrase of a short URL.
+// Only the user who created the short URL can update it.
+//
+//encore:api auth method=PATCH path=/url/:id
+func Update(ctx context.Context, id string, p *UpdateParams) (*URL, error) {
+	uid, _ := auth.UserID()
+	eb := errs.B().Meta("id", id)
+	if p.ExpiresAt != nil && p.NoExpiry {
+		return nil, eb.Code(errs.InvalidArgument).Msg("can't both set and remove the expiry time").Err()
+	}
+	var maxClicks int
+	if p.MaxClicks != nil {
+		maxClicks = *p.MaxClicks
+	}
+	if err := checkLimits(p.ExpiresAt, maxClicks); err != nil {
+		return nil, eb.Code(errs.InvalidArgument).Msg(err.Error()).Err()
+	}
+
+	var passphraseHash *string
+	if p.Passphrase != nil {
+		var hash string
+		if *p.Passphrase != "" {
+			var err error
+			if hash, err = hashPassphrase(*p.Passphrase); err != nil {
+				return nil, eb.Cause(err).Err()
+			}
+		}
+		passphraseHash = &hash
+	}
+
+	res, err := sqldb.Exec(ctx, `
+        UPDATE url SET
+            expires_at = CASE WHEN $2 THEN NULL ELSE COALESCE($3, expires_at) END,
+            max_clicks = COALESCE($4, max_clicks),
+            disabled = COALESCE($5, disabled),
+            passphrase_hash = COALESCE($6, passphrase_hash)
+        WHERE id = $1 AND owner = $7
+    `, id, p.NoExpiry, p.ExpiresAt, p.MaxClicks, p.Disabled, passphraseHash, string(uid))
+	if err != nil {
+		return nil, eb.Cause(err).Err()
+	} else if res.RowsAffected() == 0 {
+		return nil, eb.Code(errs.NotFound).Msg("short url not found").Err()
+	}
+	u, err := Get(ctx, id)
+	if err != nil {
+		return nil, eb.Cause(err).Err()
+	}
+	u.ShortURL = FormatShortURL(id)
+	return u, nil
+}
+
+// Delete deletes a short URL and its click history.
+// Only the user who created the short URL can delete it.
+//
+//encore:api auth method=DELETE path=/url/:id
+func Delete(ctx context.Context, id string) error {
+	uid, _ := auth.UserID()
+	eb := errs.B().Meta("id", id)
+	tx, err := sqldb.Begin(ctx)
+	if err != nil {
+		return eb.Cause(err).Err()
+	}
+	defer tx.Rollback() // committed explicitly on success
+
+	if _, err := tx.Exec(ctx, `
+        DELETE FROM url_click
+        WHERE url_id IN (SELECT id FROM url WHERE id = $1 AND owner = $2)
+    `, id, string(uid)); err != nil {
+		return eb.Cause(err).Err()
+	}
+	res, err := tx.Exec(ctx, `DELETE FROM url WHERE id = $1 AND owner = $2`, id, string(uid))
+	if err != nil {
+		return eb.Cause(err).Err()
+	} else if res.RowsAffected() == 0 {
+		return eb.Code(errs.NotFound).Msg("short url not found").Err()
+	}
+	return tx.Commit()
+}
+
+// checkLimits reports an error if the expiry time or click limit is invalid.
+func checkLimits(expiresAt *time.Time, maxClicks int) error {
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return errors.New("expiry time must be in the future")
+	} else if maxClicks < 0 {
+		return errors.New("max clicks must not be negative")
+	}
+	return nil
+}
+
+// linkState describes whether a short URL redirects.
+type linkState int
+
+const (
+	linkActive linkState = iota
+	linkDisabled
+	linkExpired // past its expiry time or click limit
+)
+
+// state returns the state of a short URL at the time now,
+// given the number of times it has been clicked.
+func (u *URL) state(now time.Time, clicks int) linkState {
+	switch {
+	case u.Disabled:
+		return linkDisabled
+	case u.ExpiresAt != nil && !now.Before(*u.ExpiresAt):
+		return linkExpired
+	case u.MaxClicks > 0 && clicks >= u.MaxClicks:
+		return linkExpired
+	default:
+		return linkActive
+	}
+}
+
+// hideURL removes the owner of a short URL unless the request is
+// authenticated, and likewise the original URL if the short URL doesn't
+// redirect without a passphrase, given the number of times it has been
+// clicked. Otherwise the URL could be looked up to get around the
+// passphrase or the 410 Gone.
+func hideURL(u *URL, clicks int) {
+	if _, ok := auth.UserID(); ok {
+		return
+	}
+	u.Owner = ""
+	if u.Protected || u.state(time.Now(), clicks) != linkActive {
+		u.URL = ""
+	}
+}
+
+// hashPassphrase hashes a passphrase with a random salt
+// into the form "<salt>$<hash>", both hex-encoded.
+//
+// Passphrases guard links to things like slides rather than accounts,
+// so a salted SHA-256 is enough to avoid storing them in plain text.
+func hashPassphrase(passphrase string) (string, error) {
+	var salt [16]byte
+	if _, err := rand.Read(salt[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(salt[:]) + "$" + passphraseDigest(salt[:], passphrase), nil
+}
+
+// checkPassphrase reports whether passphrase matches a hash from hashPassphrase.
+func checkPassphrase(hash, passphrase string) bool {
+	i := strings.IndexByte(hash, '$')
+	if i < 0 {
+		return false
+	}
+	salt, err := hex.DecodeString(hash[:i])
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hash[i+1:]), []byte(passphraseDigest(salt, passphrase))) == 1
+}
+
+func passphraseDigest(salt []byte, passphrase string) string {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(passphrase))
+	return hex.EncodeToString(h.Sum(nil))
+}
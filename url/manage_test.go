@@ -0,0 +1,89 @@
+package url
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+)
+
+func TestLinkState(t *testing.T) {
+	c := qt.New(t)
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+
+	c.Check((&URL{}).state(now, 100), qt.Equals, linkActive)
+	c.Check((&URL{Disabled: true}).state(now, 0), qt.Equals, linkDisabled)
+	c.Check((&URL{ExpiresAt: &future}).state(now, 0), qt.Equals, linkActive)
+	c.Check((&URL{ExpiresAt: &past}).state(now, 0), qt.Equals, linkExpired)
+	c.Check((&URL{ExpiresAt: &now}).state(now, 0), qt.Equals, linkExpired)
+	c.Check((&URL{MaxClicks: 3}).state(now, 2), qt.Equals, linkActive)
+	c.Check((&URL{MaxClicks: 3}).state(now, 3), qt.Equals, linkExpired)
+
+	// Disabled takes precedence so that it's not reported as gone.
+	c.Check((&URL{Disabled: true, ExpiresAt: &past}).state(now, 0), qt.Equals, linkDisabled)
+}
+
+func TestHideURL(t *testing.T) {
+	c := qt.New(t)
+	// Unauthenticated requests never see the owner, and only see
+	// the original URL of short URLs that redirect without a passphrase.
+	u := &URL{URL: "https://example.org", Owner: "admin"}
+	hideURL(u, 0)
+	c.Check(u.Owner, qt.Equals, "")
+	c.Check(u.URL, qt.Equals, "https://example.org")
+
+	u = &URL{URL: "https://example.org", Owner: "admin", Protected: true}
+	hideURL(u, 0)
+	c.Check(u.Owner, qt.Equals, "")
+	c.Check(u.URL, qt.Equals, "")
+}
+
+func TestCheckLimits(t *testing.T) {
+	c := qt.New(t)
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+	c.Check(checkLimits(nil, 0), qt.IsNil)
+	c.Check(checkLimits(&future, 10), qt.IsNil)
+	c.Check(checkLimits(&past, 0), qt.ErrorMatches, "expiry time must be in the future")
+	c.Check(checkLimits(nil, -1), qt.ErrorMatches, "max clicks must not be negative")
+}
+
+func TestPassphrase(t *testing.T) {
+	c := qt.New(t)
+	hash, err := hashPassphrase("gophers rule")
+	c.Assert(err, qt.IsNil)
+	c.Check(checkPassphrase(hash, "gophers rule"), qt.IsTrue)
+	c.Check(checkPassphrase(hash, "gophers drool"), qt.IsFalse)
+	c.Check(checkPassphrase(hash, ""), qt.IsFalse)
+	c.Check(checkPassphrase("", "gophers rule"), qt.IsFalse)
+	c.Check(checkPassphrase("zz$abc", "gophers rule"), qt.IsFalse)
+
+	// The same passphrase hashes differently each time.
+	other, err := hashPassphrase("gophers rule")
+	c.Assert(err, qt.IsNil)
+	c.Check(other, qt.Not(qt.Equals), hash)
+}
+
+func TestUpdateDeleteOwner(t *testing.T) {
+	c := qt.New(t)
+	owner := auth.WithContext(context.Background(), "owner", nil)
+	other := auth.WithContext(context.Background(), "other", nil)
+	id := "owner-" + time.Now().Format("150405.000000")
+	c.Assert(insert(owner, &URL{ID: id, URL: "https://example.org", Owner: "owner"}, "", ""), qt.IsNil)
+
+	// Other users can neither update nor delete the short URL.
+	disabled := true
+	_, err := Update(other, id, &UpdateParams{Disabled: &disabled})
+	c.Check(errs.Code(err), qt.Equals, errs.NotFound)
+	c.Check(errs.Code(Delete(other, id)), qt.Equals, errs.NotFound)
+
+	u, err := Update(owner, id, &UpdateParams{Disabled: &disabled})
+	c.Assert(err, qt.IsNil)
+	c.Check(u.Disabled, qt.IsTrue)
+	c.Assert(Delete(owner, id), qt.IsNil)
+	c.Check(errs.Code(Delete(owner, id)), qt.Equals, errs.NotFound)
+}
@@ -0,0 +1,8 @@
+-- owner is the user who created the short URL.
+-- It is empty for URLs created before owners were recorded.
+ALTER TABLE url ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+
+-- created_at is when the short URL was created.
+-- It is NULL for URLs created before it was recorded.
+ALTER TABLE url ADD COLUMN created_at TIMESTAMP WITH TIME ZONE NULL;
+ALTER TABLE url ALTER COLUMN created_at SET DEFAULT NOW();
@@ -0,0 +1,17 @@
+-- url_click records each time a short URL is followed.
+CREATE TABLE url_click (
+    id BIGSERIAL PRIMARY KEY,
+    url_id TEXT NOT NULL REFERENCES url (id),
+    clicked_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    -- referrer is the host of the referring page, or empty if unknown.
+    referrer TEXT NOT NULL DEFAULT '',
+
+    -- user_agent is the browser family of the client, like "Firefox" or "Bot".
+    user_agent TEXT NOT NULL DEFAULT '',
+
+    -- country is the ISO 3166-1 alpha-2 country code of the client, or empty if unknown.
+    country TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX url_click_url_idx ON url_click (url_id, clicked_at);
@@ -0,0 +1,6 @@
+-- canonical_url is the canonical form of original_url for URLs
+-- shortened with canonicalization, so they can be reused.
+-- It is NULL for URLs shortened as given.
+ALTER TABLE url ADD COLUMN canonical_url TEXT NULL;
+
+CREATE UNIQUE INDEX url_canonical_url_idx ON url (canonical_url);
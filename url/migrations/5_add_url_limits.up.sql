@@ -0,0 +1,13 @@
+-- expires_at is when the short URL stops redirecting, if ever.
+ALTER TABLE url ADD COLUMN expires_at TIMESTAMP WITH TIME ZONE NULL;
+
+-- max_clicks is the number of clicks after which the short URL
+-- stops redirecting, or 0 for no limit.
+ALTER TABLE url ADD COLUMN max_clicks INTEGER NOT NULL DEFAULT 0;
+
+-- disabled short URLs don't redirect until enabled again.
+ALTER TABLE url ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT false;
+
+-- passphrase_hash is the hash of the passphrase required to follow
+-- the short URL, in the format of url.hashPassphrase, or empty if none.
+ALTER TABLE url ADD COLUMN passphrase_hash TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,9 @@
+-- The result of the latest check of whether original_url still works.
+-- link_checked_at is NULL if it hasn't been checked yet.
+ALTER TABLE url ADD COLUMN link_status INTEGER NULL; -- NULL if the request failed
+ALTER TABLE url ADD COLUMN link_final_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE url ADD COLUMN link_error TEXT NOT NULL DEFAULT '';
+ALTER TABLE url ADD COLUMN link_broken BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE url ADD COLUMN link_checked_at TIMESTAMP WITH TIME ZONE NULL;
+
+CREATE INDEX url_link_checked_idx ON url (link_checked_at NULLS FIRST);
@@ -0,0 +1,184 @@
+package url
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+
+	"encore.dev/beta/errs"
+	"encore.dev/storage/sqldb"
+)
+
+// qrOptions are the options for rendering a QR code.
+type qrOptions struct {
+	Format string // "png" or "svg"
+	Size   int    // width and height in pixels
+	Margin int    // quiet zone around the code, in modules
+}
+
+// Limits and defaults for QR code options.
+const (
+	defaultQRSize   = 256
+	maxQRSize       = 2048
+	defaultQRMargin = 4 // the minimum quiet zone required by the spec
+	maxQRMargin     = 16
+)
+
+// QRCode renders a QR code for the short URL with the id in the path.
+// The query parameters "format" ("png" or "svg", default "png"),
+// "size" (in pixels, default 256) and "margin" (in modules, default 4)
+// control how it is rendered. Short URLs that don't redirect,
+// because they are disabled or expired, are reported as not found.
+//
+//encore:api public raw method=GET path=/url/:id/qr
+func QRCode(w http.ResponseWriter, req *http.Request) {
+	id := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/url/"), "/qr")
+	if unescaped, err := url.PathUnescape(id); err == nil {
+		id = unescaped
+	}
+	eb := errs.B().Meta("id", id)
+
+	opts, err := parseQROptions(req.URL.Query())
+	if err != nil {
+		errs.HTTPError(w, eb.Code(errs.InvalidArgument).Msg(err.Error()).Err())
+		return
+	}
+
+	// Only short URLs that redirect have a QR code, so that it
+	// can't be used to find out which other ids exist.
+	var (
+		u      URL
+		clicks int
+	)
+	err = sqldb.QueryRow(req.Context(), `
+        SELECT expires_at, max_clicks, disabled, `+countedClicks+`
+        FROM url u
+        WHERE id = $1
+    `, id).Scan(&u.ExpiresAt, &u.MaxClicks, &u.Disabled, &clicks)
+	if err != nil && !errors.Is(err, sqldb.ErrNoRows) {
+		errs.HTTPError(w, eb.Cause(err).Err())
+		return
+	} else if err != nil || u.state(time.Now(), clicks) != linkActive {
+		errs.HTTPError(w, eb.Code(errs.NotFound).Msg("short url not found").Err())
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := renderQR(&buf, FormatShortURL(id), opts); err != nil {
+		errs.HTTPError(w, eb.Code(errs.InvalidArgument).Msg(err.Error()).Err())
+		return
+	}
+	if opts.Format == "svg" {
+		w.Header().Set("Content-Type", "image/svg+xml")
+	} else {
+		w.Header().Set("Content-Type", "image/png")
+	}
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write(buf.Bytes())
+}
+
+// parseQROptions parses QR code options from query parameters,
+// using the defaults for those that are missing.
+func parseQROptions(q url.Values) (qrOptions, error) {
+	opts := qrOptions{Format: "png", Size: defaultQRSize, Margin: defaultQRMargin}
+	if f := q.Get("format"); f != "" {
+		opts.Format = strings.ToLower(f)
+		if opts.Format != "png" && opts.Format != "svg" {
+			return opts, fmt.Errorf("unsupported format %q: must be png or svg", f)
+		}
+	}
+	if s := q.Get("size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxQRSize {
+			return opts, fmt.Errorf("size must be between 1 and %d", maxQRSize)
+		}
+		opts.Size = n
+	}
+	if s := q.Get("margin"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 || n > maxQRMargin {
+			return opts, fmt.Errorf("margin must be between 0 and %d", maxQRMargin)
+		}
+		opts.Margin = n
+	}
+	return opts, nil
+}
+
+// renderQR renders a QR code encoding content to w.
+//
+// PNGs are scaled by a whole number of pixels per module so that the
+// modules stay sharp, and centered in the requested size. The size must
+// be large enough for at least one pixel per module. SVGs scale freely.
+func renderQR(w io.Writer, content string, opts qrOptions) error {
+	code, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		return err
+	}
+	code.DisableBorder = true // we add our own margin
+	modules := code.Bitmap()
+	if opts.Format == "svg" {
+		return renderQRSVG(w, modules, opts)
+	}
+
+	total := len(modules) + 2*opts.Margin
+	scale := opts.Size / total
+	if scale < 1 {
+		return fmt.Errorf("size must be at least %d pixels for this qr code", total)
+	}
+	offset := (opts.Size-scale*total)/2 + scale*opts.Margin
+
+	img := image.NewPaletted(image.Rect(0, 0, opts.Size, opts.Size), color.Palette{color.White, color.Black})
+	for y, row := range modules {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			r := image.Rect(offset+x*scale, offset+y*scale, offset+(x+1)*scale, offset+(y+1)*scale)
+			for py := r.Min.Y; py < r.Max.Y; py++ {
+				for px := r.Min.X; px < r.Max.X; px++ {
+					img.SetColorIndex(px, py, 1)
+				}
+			}
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// renderQRSVG renders QR code modules as an SVG image with one
+// unit per module, drawing each horizontal run of dark modules
+// as a single rectangle to keep the output small.
+func renderQRSVG(w io.Writer, modules [][]bool, opts qrOptions) error {
+	if len(modules) == 0 {
+		return errors.New("empty qr code")
+	}
+	total := len(modules) + 2*opts.Margin
+	var path strings.Builder
+	for y, row := range modules {
+		for x := 0; x < len(row); {
+			if !row[x] {
+				x++
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", start+opts.Margin, y+opts.Margin, x-start, x-start)
+		}
+	}
+	_, err := fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+		`<rect width="100%%" height="100%%" fill="#fff"/><path fill="#000" d="%s"/></svg>`+"\n",
+		opts.Size, opts.Size, total, total, path.String())
+	return err
+}
@@ -0,0 +1,90 @@
+package url
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestParseQROptions(t *testing.T) {
+	c := qt.New(t)
+	opts, err := parseQROptions(url.Values{})
+	c.Assert(err, qt.IsNil)
+	c.Check(opts, qt.Equals, qrOptions{Format: "png", Size: defaultQRSize, Margin: defaultQRMargin})
+
+	opts, err = parseQROptions(url.Values{"format": {"SVG"}, "size": {"512"}, "margin": {"0"}})
+	c.Assert(err, qt.IsNil)
+	c.Check(opts, qt.Equals, qrOptions{Format: "svg", Size: 512, Margin: 0})
+
+	for _, q := range []url.Values{
+		{"format": {"gif"}},
+		{"size": {"0"}},
+		{"size": {"4096"}},
+		{"size": {"big"}},
+		{"margin": {"-1"}},
+		{"margin": {"100"}},
+	} {
+		_, err := parseQROptions(q)
+		c.Check(err, qt.Not(qt.IsNil), qt.Commentf("%v", q))
+	}
+}
+
+func TestRenderQR(t *testing.T) {
+	c := qt.New(t)
+	content := "https://url.bjk.fyi/gophercon"
+
+	var buf bytes.Buffer
+	err := renderQR(&buf, content, qrOptions{Format: "png", Size: 300, Margin: 4})
+	c.Assert(err, qt.IsNil)
+	img, err := png.Decode(&buf)
+	c.Assert(err, qt.IsNil)
+	c.Check(img.Bounds().Dx(), qt.Equals, 300)
+	c.Check(img.Bounds().Dy(), qt.Equals, 300)
+
+	// The margin is white and the top-left finder pattern is black.
+	r, _, _, _ := img.At(1, 1).RGBA()
+	c.Check(r, qt.Equals, uint32(0xffff))
+	total := 29 + 2*4 // a version 3 code plus the margin
+	scale := 300 / total
+	offset := (300-scale*total)/2 + scale*4
+	r, _, _, _ = img.At(offset, offset).RGBA()
+	c.Check(r, qt.Equals, uint32(0))
+
+	buf.Reset()
+	err = renderQR(&buf, content, qrOptions{Format: "svg", Size: 300, Margin: 2})
+	c.Assert(err, qt.IsNil)
+	svg := buf.String()
+	c.Check(strings.HasPrefix(svg, `<svg xmlns="http://www.w3.org/2000/svg" width="300" height="300" viewBox="0 0 33 33"`), qt.IsTrue, qt.Commentf("%s", svg))
+	c.Check(svg, qt.Contains, `d="M2 2h7v1h-7z`)
+
+	// Too small to fit one pixel per module.
+	err = renderQR(&buf, content, qrOptions{Format: "png", Size: 20, Margin: 4})
+	c.Check(err, qt.ErrorMatches, "size must be at least 37 pixels for this qr code")
+}
+
+func TestQRCodeActiveOnly(t *testing.T) {
+	c := qt.New(t)
+	ctx := context.Background()
+	prefix := "qr-" + time.Now().Format("150405.000000")
+	c.Assert(insert(ctx, &URL{ID: prefix + "-active", URL: "https://example.org"}, "", ""), qt.IsNil)
+	c.Assert(insert(ctx, &URL{ID: prefix + "-disabled", URL: "https://example.org", Disabled: true}, "", ""), qt.IsNil)
+
+	get := func(id string) int {
+		w := httptest.NewRecorder()
+		QRCode(w, httptest.NewRequest("GET", "/url/"+id+"/qr", nil))
+		return w.Code
+	}
+	c.Check(get(prefix+"-active"), qt.Equals, http.StatusOK)
+
+	// Short URLs that don't redirect look the same as ones that don't exist.
+	c.Check(get(prefix+"-disabled"), qt.Equals, http.StatusNotFound)
+	c.Check(get(prefix+"-missing"), qt.Equals, http.StatusNotFound)
+}
@@ -3,16 +3,42 @@ package url
 import (
 	"context"
 	"crypto/rand"
-	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
+	"encore.app/linkcheck"
+	"encore.app/ratelimit"
+	"encore.dev/beta/auth"
+	"encore.dev/beta/errs"
+	"encore.dev/rlog"
 	"encore.dev/storage/sqldb"
 )
 
 type URL struct {
-	ID       string `json:"id,omitempty"`        // short-form URL id
-	URL      string `json:"url,omitempty"`       // original URL, in long form
-	ShortURL string `json:"short_url,omitempty"` // short URL
+	ID        string     `json:"id,omitempty"`         // short-form URL id
+	URL       string     `json:"url,omitempty"`        // original URL, in long form
+	ShortURL  string     `json:"short_url,omitempty"`  // short URL
+	Owner     string     `json:"owner,omitempty"`      // user who created the short URL; empty unless authenticated
+	CreatedAt *time.Time `json:"created_at,omitempty"` // nil if unknown
+
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // when it stops redirecting; nil if never
+	MaxClicks int        `json:"max_clicks,omitempty"` // clicks after which it stops redirecting; 0 if unlimited
+	Disabled  bool       `json:"disabled,omitempty"`   // whether redirecting is turned off
+
+	// Protected reports whether a passphrase is required to follow the short URL.
+	// The original URL of protected short URLs, as well as of disabled and
+	// expired ones, is only shown to authenticated users.
+	Protected bool `json:"protected,omitempty"`
+
+	// Link is the result of the latest check of the original URL,
+	// or nil if it hasn't been checked.
+	Link *linkcheck.Status `json:"link,omitempty"`
 }
 type GetListResponse struct {
 	Count int    `json:"count,omitempty"`
@@ -21,41 +47,182 @@ type GetListResponse struct {
 
 type ShortenParams struct {
 	URL string `json:"url,omitempty"` // the URL to shorten
+
+	// Alias is an optional vanity id for the short URL, like "gophercon".
+	// If empty a random id is generated.
+	Alias string `json:"alias,omitempty"`
+
+	// Canonicalize reuses the existing short URL of a URL with the same
+	// canonical form, as computed by canonicalizeURL, if one has been
+	// shortened before with Canonicalize set. The URL itself is still
+	// what the short URL redirects to, since canonicalizing may change it.
+	Canonicalize bool `json:"canonicalize,omitempty"`
+
+	// ExpiresAt is when the short URL stops redirecting.
+	// If nil it never expires.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// MaxClicks is the number of clicks after which the short URL
+	// stops redirecting. If 0 the number of clicks is unlimited.
+	MaxClicks int `json:"max_clicks,omitempty"`
+
+	// Disabled creates the short URL without enabling it.
+	Disabled bool `json:"disabled,omitempty"`
+
+	// Passphrase, if set, must be entered to follow the short URL.
+	Passphrase string `json:"passphrase,omitempty"`
+
+	// ForwardedFor identifies the client for rate limiting.
+	// It is set from the X-Forwarded-For header.
+	ForwardedFor string `json:"-"`
 }
 
-// Shorten shortens a URL.
-//encore:api public method=POST path=/url
-func Shorten(ctx context.Context, p *ShortenParams) (*URL, error) {
-	id, err := generateID()
+// shortenRate and shortenBurst limit how often a client may shorten URLs.
+const (
+	shortenRate  = 10.0 / 60 // 10 per minute
+	shortenBurst = 20
+)
+
+// Shorten shortens a URL. It takes ShortenParams and returns the URL as JSON.
+// It is raw so that it can set the Retry-After header when rate limited.
+//
+//encore:api auth raw method=POST path=/url
+func Shorten(w http.ResponseWriter, req *http.Request) {
+	var p ShortenParams
+	if err := json.NewDecoder(req.Body).Decode(&p); err != nil {
+		errs.HTTPError(w, errs.B().Code(errs.InvalidArgument).Cause(err).Msg("invalid request body").Err())
+		return
+	}
+	p.ForwardedFor = req.Header.Get("X-Forwarded-For")
+	u, err := shorten(req.Context(), &p)
 	if err != nil {
+		setRetryAfter(w, err)
+		errs.HTTPError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(u)
+}
+
+// shorten shortens a URL.
+func shorten(ctx context.Context, p *ShortenParams) (*URL, error) {
+	err := ratelimit.Take(ctx, &ratelimit.TakeParams{
+		Route:        "url.Shorten",
+		ForwardedFor: p.ForwardedFor,
+		Rate:         shortenRate,
+		Burst:        shortenBurst,
+	})
+	if errs.Code(err) == errs.ResourceExhausted {
 		return nil, err
-	} else if err := insert(ctx, id, p.URL); err != nil {
-		return nil, err
+	} else if err != nil {
+		rlog.Error("failed to rate limit shorten", "err", err)
+	}
+
+	if err := checkDestination(p.URL); err != nil {
+		return nil, errs.B().Code(errs.InvalidArgument).Meta("url", p.URL).Msg(err.Error()).Err()
+	}
+
+	if err := checkLimits(p.ExpiresAt, p.MaxClicks); err != nil {
+		return nil, errs.B().Code(errs.InvalidArgument).Msg(err.Error()).Err()
+	}
+
+	var canonical string
+	if p.Canonicalize {
+		// Reused short URLs would share their limits with the earlier caller.
+		if p.ExpiresAt != nil || p.MaxClicks != 0 || p.Disabled || p.Passphrase != "" {
+			return nil, errs.B().Code(errs.InvalidArgument).Msg("canonicalized urls can't have an expiry, click limit, passphrase or be disabled").Err()
+		}
+		if canonical, err = canonicalizeURL(p.URL); err != nil {
+			return nil, errs.B().Code(errs.InvalidArgument).Meta("url", p.URL).Msg("invalid url").Err()
+		}
+		if u, err := getCanonical(ctx, canonical, p.Alias); !errors.Is(err, sqldb.ErrNoRows) {
+			return u, err
+		}
+	}
+
+	if p.Alias != "" {
+		if err := validateAlias(p.Alias); err != nil {
+			return nil, errs.B().Code(errs.InvalidArgument).Meta("alias", p.Alias).Msg(err.Error()).Err()
+		}
+	}
+
+	var passphraseHash string
+	if p.Passphrase != "" {
+		if passphraseHash, err = hashPassphrase(p.Passphrase); err != nil {
+			return nil, err
+		}
+	}
+
+	uid, _ := auth.UserID()
+	for attempt := 1; ; attempt++ {
+		id := p.Alias
+		if id == "" {
+			if id, err = generateID(); err != nil {
+				return nil, err
+			}
+		}
+		u := &URL{
+			ID:        id,
+			URL:       p.URL,
+			ShortURL:  FormatShortURL(id),
+			Owner:     string(uid),
+			ExpiresAt: p.ExpiresAt,
+			MaxClicks: p.MaxClicks,
+			Disabled:  p.Disabled,
+			Protected: passphraseHash != "",
+		}
+		err = insert(ctx, u, canonical, passphraseHash)
+		if err == nil {
+			return u, nil
+		} else if !errors.Is(err, sqldb.ErrNoRows) {
+			return nil, err
+		}
+
+		// Either the id is taken or the canonical URL was
+		// shortened concurrently; reuse it in the latter case.
+		if canonical != "" {
+			if u, err := getCanonical(ctx, canonical, p.Alias); !errors.Is(err, sqldb.ErrNoRows) {
+				return u, err
+			}
+		}
+		if p.Alias != "" {
+			return nil, errs.B().Code(errs.AlreadyExists).Meta("id", id).Msg("short url id already taken").Err()
+		} else if attempt == maxIDAttempts {
+			return nil, errs.B().Code(errs.Unavailable).Msg("unable to generate an unused short url id").Err()
+		}
+		rlog.Info("generated short url id already taken, retrying", "id", id)
 	}
-	return &URL{
-		ID:       id,
-		URL:      p.URL,
-		ShortURL: FormatShortURL(id),
-	}, nil
 }
 
 // Get retrieves the original URL for the id.
+//
 //encore:api public method=GET path=/url/:id
 func Get(ctx context.Context, id string) (*URL, error) {
 	u := &URL{ID: id}
+	var (
+		link   linkcheck.Columns
+		clicks int
+	)
 	err := sqldb.QueryRow(ctx, `
-        SELECT original_url FROM url
+        SELECT original_url, owner, created_at, expires_at, max_clicks, disabled, passphrase_hash <> '',
+            link_status, link_final_url, link_error, link_broken, link_checked_at, `+countedClicks+`
+        FROM url u
         WHERE id = $1
-    `, id).Scan(&u.URL)
+    `, id).Scan(&u.URL, &u.Owner, &u.CreatedAt, &u.ExpiresAt, &u.MaxClicks, &u.Disabled, &u.Protected,
+		&link.Status, &link.FinalURL, &link.Err, &link.Broken, &link.CheckedAt, &clicks)
+	u.Link = link.LinkStatus()
+	hideURL(u, clicks)
 	return u, err
 }
 
 // List retrieves all shortened URLs
+//
 //encore:api public method=GET path=/url
 func List(ctx context.Context) (*GetListResponse, error) {
 	rows, err := sqldb.Query(ctx, `
-		SELECT id, original_url
-		FROM "url"
+		SELECT id, original_url, owner, created_at, expires_at, max_clicks, disabled, passphrase_hash <> '',
+			link_status, link_final_url, link_error, link_broken, link_checked_at, `+countedClicks+`
+		FROM "url" u
 	`)
 	if err != nil {
 		return &GetListResponse{
@@ -69,15 +236,20 @@ func List(ctx context.Context) (*GetListResponse, error) {
 	var i = 0
 	for rows.Next() {
 		var (
-			b URL
+			b      URL
+			link   linkcheck.Columns
+			clicks int
 		)
-		err := rows.Scan(&b.ID, &b.URL)
+		err := rows.Scan(&b.ID, &b.URL, &b.Owner, &b.CreatedAt, &b.ExpiresAt, &b.MaxClicks, &b.Disabled, &b.Protected,
+			&link.Status, &link.FinalURL, &link.Err, &link.Broken, &link.CheckedAt, &clicks)
 		if err != nil {
 			return &GetListResponse{
 				Count: 0,
 				URLS:  []*URL{},
 			}, err
 		}
+		b.Link = link.LinkStatus()
+		hideURL(&b, clicks)
 
 		q = append(q, &b)
 		i = i + 1
@@ -88,25 +260,168 @@ func List(ctx context.Context) (*GetListResponse, error) {
 	}, rows.Err()
 }
 
-// generateID generates a random short ID.
+// maxIDAttempts is the number of ids Shorten generates
+// before giving up if they are all taken.
+const maxIDAttempts = 5
+
+// generateID generates a random short ID of the configured
+// length from the characters in the configured alphabet.
 func generateID() (string, error) {
-	var data [6]byte // 6 bytes of entropy
-	if _, err := rand.Read(data[:]); err != nil {
+	alphabet := []rune(cfg.IDAlphabet)
+	n := big.NewInt(int64(len(alphabet)))
+	id := make([]rune, cfg.IDLength)
+	for i := range id {
+		j, err := rand.Int(rand.Reader, n)
+		if err != nil {
+			return "", err
+		}
+		id[i] = alphabet[j.Int64()]
+	}
+	return string(id), nil
+}
+
+// insert inserts a URL into the database and sets when it was created.
+// The canonical URL is stored only if it is non-empty.
+// If the id or canonical URL is already taken it reports sqldb.ErrNoRows.
+func insert(ctx context.Context, u *URL, canonical, passphraseHash string) error {
+	return sqldb.QueryRow(ctx, `
+        INSERT INTO url (id, original_url, canonical_url, owner, expires_at, max_clicks, disabled, passphrase_hash)
+        VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8)
+        ON CONFLICT DO NOTHING
+        RETURNING created_at
+    `, u.ID, u.URL, canonical, u.Owner, u.ExpiresAt, u.MaxClicks, u.Disabled, passphraseHash).Scan(&u.CreatedAt)
+}
+
+// getCanonical returns the existing short URL for a canonical URL.
+// If alias is non-empty and the URL was shortened with a different id
+// it reports an error, since it can't be shortened again.
+// If the URL hasn't been shortened it reports sqldb.ErrNoRows.
+func getCanonical(ctx context.Context, canonical, alias string) (*URL, error) {
+	// Canonicalized URLs have no limits, but they may have been added since.
+	var u URL
+	err := sqldb.QueryRow(ctx, `
+        SELECT id, original_url, owner, created_at, expires_at, max_clicks, disabled, passphrase_hash <> ''
+        FROM url
+        WHERE canonical_url = $1
+    `, canonical).Scan(&u.ID, &u.URL, &u.Owner, &u.CreatedAt, &u.ExpiresAt, &u.MaxClicks, &u.Disabled, &u.Protected)
+	if err != nil {
+		return nil, err
+	} else if alias != "" && alias != u.ID {
+		return nil, errs.B().Code(errs.AlreadyExists).Meta("url", canonical, "id", u.ID).Msg("url already shortened with a different id").Err()
+	}
+	u.ShortURL = FormatShortURL(u.ID)
+	return &u, nil
+}
+
+// trackingParams are query parameters removed by canonicalizeURL.
+// Parameters ending in '_' are prefixes.
+var trackingParams = []string{"utm_", "fbclid", "gclid", "dclid", "msclkid", "mc_cid", "mc_eid", "igshid"}
+
+// canonicalizeURL returns the canonical form of a URL, so that URLs
+// that lead to the same page share a short URL. The scheme and host are
+// lowercased, default ports, trailing slashes and tracking parameters
+// are removed and the remaining query parameters are sorted.
+func canonicalizeURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
 		return "", err
 	}
-	return base64.RawURLEncoding.EncodeToString(data[:]), nil
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		u.Host = u.Host[:len(u.Host)-len(port)-1]
+	}
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = strings.TrimRight(u.RawPath, "/")
+
+	if u.RawQuery != "" {
+		q := u.Query()
+		for name := range q {
+			for _, t := range trackingParams {
+				if name == t || (strings.HasSuffix(t, "_") && strings.HasPrefix(name, t)) {
+					q.Del(name)
+				}
+			}
+		}
+		u.RawQuery = q.Encode()
+	}
+	u.ForceQuery = false
+	return u.String(), nil
 }
 
-// insert inserts a URL into the database.
-func insert(ctx context.Context, id, url string) error {
-	_, err := sqldb.Exec(ctx, `
-        INSERT INTO url (id, original_url)
-        VALUES ($1, $2)
-    `, id, url)
-	return err
+// Aliases must be between minAliasLen and maxAliasLen characters long.
+const (
+	minAliasLen = 3
+	maxAliasLen = 64
+)
+
+// reservedAliases are aliases that can't be used because they
+// are or may become paths on the short URL domain.
+var reservedAliases = map[string]bool{
+	"admin":  true,
+	"api":    true,
+	"health": true,
+	"login":  true,
+	"logout": true,
+	"qr":     true,
+	"static": true,
+	"stats":  true,
+	"url":    true,
+	"www":    true,
+}
+
+// validateAlias reports an error if alias can't be used as a short URL id.
+// Aliases consist of letters, digits, '-' and '_' and may not start or end with a '-' or '_'.
+func validateAlias(alias string) error {
+	if len(alias) < minAliasLen || len(alias) > maxAliasLen {
+		return fmt.Errorf("alias must be between %d and %d characters", minAliasLen, maxAliasLen)
+	}
+	for _, r := range alias {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '-' || r == '_') {
+			return errors.New("alias may only contain letters, digits, '-' and '_'")
+		}
+	}
+	if strings.Trim(alias, "-_") != alias {
+		return errors.New("alias may not start or end with '-' or '_'")
+	}
+	if reservedAliases[strings.ToLower(alias)] {
+		return fmt.Errorf("alias %q is reserved", alias)
+	}
+	return nil
+}
+
+// checkDestination reports an error if rawURL may not be shortened,
+// either because it is not an absolute http(s) URL or because its
+// domain is not allowed by the configured allow and deny lists.
+func checkDestination(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return errors.New("invalid url")
+	} else if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("url must be an absolute http or https url")
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if matchDomain(host, cfg.DeniedDomains) {
+		return errors.New("destination domain is not allowed")
+	} else if len(cfg.AllowedDomains) > 0 && !matchDomain(host, cfg.AllowedDomains) {
+		return errors.New("destination domain is not allowed")
+	}
+	return nil
+}
+
+// matchDomain reports whether host is one of domains or a subdomain of one.
+func matchDomain(host string, domains []string) bool {
+	for _, d := range domains {
+		d = strings.ToLower(d)
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
 }
 
 // FormatShortURL formats a short id into the short URL.
 func FormatShortURL(id string) string {
-	return "https://url.bjk.fyi/" + url.PathEscape(id)
+	return cfg.ShortURLBase + url.PathEscape(id)
 }
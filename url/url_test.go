@@ -0,0 +1,126 @@
+package url
+
+import (
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestCheckDestination(t *testing.T) {
+	c := qt.New(t)
+	orig := cfg
+	c.Cleanup(func() { cfg = orig })
+	cfg.DeniedDomains = []string{"bjk.fyi", "evil.example"}
+
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://brian.dev/blog/hello", true},
+		{"http://example.org:8080/x", true},
+		{"/blog/hello", false},
+		{"javascript:alert(1)", false},
+		{"ftp://example.org/file", false},
+		{"https://bjk.fyi/abc", false},
+		{"https://url.bjk.fyi/abc", false},
+		{"https://EVIL.example./login", false},
+		{"https://notevil.example/login", true},
+	}
+	for _, test := range tests {
+		err := checkDestination(test.url)
+		c.Check(err == nil, qt.Equals, test.ok, qt.Commentf("%s: %v", test.url, err))
+	}
+
+	// With an allow list only those domains may be shortened.
+	cfg.AllowedDomains = []string{"brian.dev"}
+	c.Check(checkDestination("https://www.brian.dev/"), qt.IsNil)
+	c.Check(checkDestination("https://example.org/"), qt.Not(qt.IsNil))
+}
+
+func TestValidateAlias(t *testing.T) {
+	c := qt.New(t)
+	tests := []struct {
+		alias string
+		ok    bool
+	}{
+		{"gophercon", true},
+		{"Go-2022_talk", true},
+		{"abc", true},
+		{"ab", false},
+		{strings.Repeat("a", maxAliasLen+1), false},
+		{"has space", false},
+		{"slash/y", false},
+		{"dot.com", false},
+		{"-leading", false},
+		{"trailing_", false},
+		{"ünicode", false},
+		{"admin", false},
+		{"API", false},
+	}
+	for _, test := range tests {
+		err := validateAlias(test.alias)
+		c.Check(err == nil, qt.Equals, test.ok, qt.Commentf("%s: %v", test.alias, err))
+	}
+}
+
+func TestCanonicalizeURL(t *testing.T) {
+	c := qt.New(t)
+	tests := []struct {
+		in, want string
+	}{
+		{"https://brian.dev/blog/hello", "https://brian.dev/blog/hello"},
+		{"HTTPS://Brian.DEV/blog/Hello/", "https://brian.dev/blog/Hello"},
+		{"https://brian.dev/", "https://brian.dev"},
+		{"https://brian.dev:443/x", "https://brian.dev/x"},
+		{"http://brian.dev:80/x", "http://brian.dev/x"},
+		{"http://brian.dev:443/x", "http://brian.dev:443/x"},
+		{"https://brian.dev/x?utm_source=tw&utm_medium=social", "https://brian.dev/x"},
+		{"https://brian.dev/x?b=2&fbclid=abc&a=1", "https://brian.dev/x?a=1&b=2"},
+		{"https://brian.dev/x?utmost=1", "https://brian.dev/x?utmost=1"},
+		{"https://brian.dev/x?", "https://brian.dev/x"},
+		{"https://brian.dev/a%2Fb/", "https://brian.dev/a%2Fb"},
+		{"https://brian.dev/x/#section", "https://brian.dev/x#section"},
+	}
+	for _, test := range tests {
+		got, err := canonicalizeURL(test.in)
+		c.Assert(err, qt.IsNil)
+		c.Check(got, qt.Equals, test.want, qt.Commentf("%s", test.in))
+	}
+}
+
+func TestGenerateID(t *testing.T) {
+	c := qt.New(t)
+	orig := cfg
+	c.Cleanup(func() { cfg = orig })
+	cfg.IDAlphabet = "abcdefghijkmnpqr"
+	cfg.IDLength = 12
+
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id, err := generateID()
+		c.Assert(err, qt.IsNil)
+		c.Assert(id, qt.HasLen, 12)
+		c.Assert(strings.Trim(id, cfg.IDAlphabet), qt.Equals, "", qt.Commentf("%s", id))
+		c.Assert(seen[id], qt.IsFalse)
+		seen[id] = true
+	}
+}
+
+func TestCheckIDConfig(t *testing.T) {
+	c := qt.New(t)
+	c.Check(checkIDConfig("23456789abcdefghijkmnpqrstuvwxyz", 8), qt.IsNil)
+	c.Check(checkIDConfig("0123456789abcdef", 4), qt.IsNil)
+	c.Check(checkIDConfig("0123456789abcde", 8), qt.ErrorMatches, "id alphabet must contain at least 16 characters")
+	c.Check(checkIDConfig("0123456789abcdeff", 8), qt.ErrorMatches, `id alphabet contains 'f' more than once`)
+	c.Check(checkIDConfig("0123456789abcdef/", 8), qt.ErrorMatches, `id alphabet may only contain .*`)
+	c.Check(checkIDConfig("0123456789abcdef", 3), qt.ErrorMatches, "id length must be at least 4")
+}
+
+func TestFormatShortURL(t *testing.T) {
+	c := qt.New(t)
+	orig := cfg
+	c.Cleanup(func() { cfg = orig })
+	cfg.ShortURLBase = "https://short.example/"
+	c.Check(FormatShortURL("gophercon"), qt.Equals, "https://short.example/gophercon")
+}